@@ -5,9 +5,19 @@ import (
 	"os"
 
 	"eikcalb.dev/shark/src/app"
+	"eikcalb.dev/shark/src/cli"
 )
 
 func main() {
+	// Commands run on their own without starting the application.
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		if err := cli.Run(os.Args[1:], os.Stdout); err != nil {
+			slog.Error("Failed to run command", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	config, err := app.LoadConfig("config.json")
 	if err != nil {
 		slog.Error("Failed to load config", "error", err)
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"context"
+
 	"eikcalb.dev/shark/src/store"
 )
 
@@ -13,12 +15,53 @@ type Config struct {
 
 	Port uint16 `json:"port"`
 
-	storage *store.JSONFileStore[Config] `json:"-"`
+	// ReservationTTL is the number of seconds an order quote or
+	// reservation lasts before it expires. Zero uses the service default.
+	ReservationTTL uint `json:"reservationTTL"`
+	// SolutionCacheBound is the largest order count whose solution is
+	// cached for each item. Zero uses the service default.
+	SolutionCacheBound uint `json:"solutionCacheBound"`
+	// SolutionCacheLimit is the largest number of order solutions cached
+	// across all items. Zero uses the service default.
+	SolutionCacheLimit uint `json:"solutionCacheLimit,omitempty"`
+	// StorageBackups is the number of copies of the inventory storage to
+	// keep from before each save. Zero uses the service default.
+	StorageBackups uint `json:"storageBackups"`
+	// StorageBackend is how the inventory is stored: "json" for a snapshot
+	// file with a log of the changes since, or "kv" for an embedded
+	// key-value store that reads and writes each item on its own. Empty
+	// uses json.
+	StorageBackend string `json:"storageBackend,omitempty"`
+	// SnapshotInterval is the number of seconds between the snapshots of
+	// the inventory taken while it changes. Zero uses the service default.
+	SnapshotInterval uint `json:"snapshotInterval,omitempty"`
+	// SnapshotKeep is the number of the newest inventory snapshots kept,
+	// not counting those taken before a change, which are kept by age.
+	// Zero uses the service default.
+	SnapshotKeep uint `json:"snapshotKeep,omitempty"`
+	// SnapshotKeepBeforeChange is the number of the newest inventory
+	// snapshots taken before a change that are kept. Zero uses the service
+	// default.
+	SnapshotKeepBeforeChange uint `json:"snapshotKeepBeforeChange,omitempty"`
+	// SnapshotMaxAge is the number of seconds an inventory snapshot is
+	// kept. Zero uses the service default.
+	SnapshotMaxAge uint `json:"snapshotMaxAge,omitempty"`
+	// AdminToken is the token that admin requests present in the
+	// X-Admin-Token header. Admin requests are refused when it is empty.
+	AdminToken string `json:"adminToken,omitempty"`
+
+	storage store.Store[string, Config] `json:"-"`
+	// key is what the config is stored with in storage.
+	key string `json:"-"`
 }
 
+// ConfigSchema is the schema of the config file. Migrations are only ever
+// added to the end.
+var ConfigSchema = store.Schema{Name: "config"}
+
 // Save serializes the active config and persists it.
-func (c Config) Save() error {
-	err := c.storage.Save(c)
+func (c Config) Save(ctx context.Context) error {
+	err := c.storage.Set(ctx, c.key, c)
 	if err != nil {
 		// Failed to save config.
 		return err
@@ -30,14 +73,22 @@ func (c Config) Save() error {
 // LoadConfig reads the config from JSON and returns an instance
 // of the Config struct.
 func LoadConfig(path string) (*Config, error) {
-	jfs := store.JSONFileStore[Config]{Path: path}
-	config, err := jfs.Load()
+	fs, key := store.ForFile[Config](path)
+	fs.Schema = ConfigSchema
+	return LoadConfigFrom(context.Background(), fs, key)
+}
+
+// LoadConfigFrom reads the config stored with key in storage. Saving the
+// config writes it back to the same place.
+func LoadConfigFrom(ctx context.Context, storage store.Store[string, Config], key string) (*Config, error) {
+	config, err := storage.Get(ctx, key)
 	if err != nil {
 		// Failed to load config
 		return nil, err
 	}
 
-	config.storage = &jfs
+	config.storage = storage
+	config.key = key
 
-	return config, nil
+	return &config, nil
 }
@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"eikcalb.dev/shark/src/constants"
 	"eikcalb.dev/shark/src/service"
@@ -48,6 +49,50 @@ func (app Application) Run() (err error) {
 	// has exited.
 	defer cancel()
 
+	// Services read their configuration from the context, both when they
+	// are set up and when they run.
+	ctx = context.WithValue(ctx, constants.CONTEXT_APPLICATION_VERSION_KEY, app.config.Version)
+	ctx = context.WithValue(ctx, constants.CONTEXT_SERVICE_PORT_KEY, app.config.Port)
+	if app.config.ReservationTTL > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_RESERVATION_TTL_KEY, time.Duration(app.config.ReservationTTL)*time.Second)
+	}
+	if app.config.SolutionCacheBound > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SOLUTION_CACHE_BOUND_KEY, int(app.config.SolutionCacheBound))
+	}
+	if app.config.SolutionCacheLimit > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SOLUTION_CACHE_LIMIT_KEY, int(app.config.SolutionCacheLimit))
+	}
+
+	if app.config.StorageBackups > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_STORAGE_BACKUPS_KEY, int(app.config.StorageBackups))
+	}
+	if app.config.StorageBackend != "" {
+		ctx = context.WithValue(ctx, constants.CONTEXT_STORAGE_BACKEND_KEY, app.config.StorageBackend)
+	}
+	if app.config.SnapshotInterval > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SNAPSHOT_INTERVAL_KEY, time.Duration(app.config.SnapshotInterval)*time.Second)
+	}
+	if app.config.SnapshotKeep > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SNAPSHOT_KEEP_KEY, int(app.config.SnapshotKeep))
+	}
+	if app.config.SnapshotKeepBeforeChange > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SNAPSHOT_KEEP_BEFORE_CHANGE_KEY, int(app.config.SnapshotKeepBeforeChange))
+	}
+	if app.config.SnapshotMaxAge > 0 {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SNAPSHOT_MAX_AGE_KEY, time.Duration(app.config.SnapshotMaxAge)*time.Second)
+	}
+	if app.config.AdminToken != "" {
+		ctx = context.WithValue(ctx, constants.CONTEXT_ADMIN_TOKEN_KEY, app.config.AdminToken)
+	}
+	if envToken, ok := os.LookupEnv("ADMIN_TOKEN"); ok {
+		ctx = context.WithValue(ctx, constants.CONTEXT_ADMIN_TOKEN_KEY, envToken)
+	}
+
+	envPort, ok := os.LookupEnv("PORT")
+	if ok {
+		ctx = context.WithValue(ctx, constants.CONTEXT_SERVICE_PORT_KEY, envPort)
+	}
+
 	app.ctx = ctx
 	app.setupServices()
 
@@ -78,14 +123,6 @@ func (app Application) Run() (err error) {
 	}()
 
 	// Run registered services.
-	ctx = context.WithValue(ctx, constants.CONTEXT_APPLICATION_VERSION_KEY, app.config.Version)
-	ctx = context.WithValue(ctx, constants.CONTEXT_SERVICE_PORT_KEY, app.config.Port)
-
-	envPort, ok := os.LookupEnv("PORT")
-	if ok {
-		ctx = context.WithValue(ctx, constants.CONTEXT_SERVICE_PORT_KEY, envPort)
-	}
-
 	go app.sm.Run(ctx)
 
 	osSignalChannel := make(chan os.Signal, 1)
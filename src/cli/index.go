@@ -0,0 +1,58 @@
+/*
+Package cli implements the commands that can be run from the command
+line instead of starting the application.
+
+Each command reads its own flags and writes its result as JSON, so the
+output can be piped into other tools.
+*/
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var ErrUnknownCommand = errors.New("command is not known")
+
+// command runs with the arguments that follow its name and writes its
+// result to out.
+type command func(args []string, out io.Writer) error
+
+// commands holds every command, keyed by name.
+var commands = map[string]command{
+	"migrate":   migrate,
+	"recommend": recommend,
+	"simulate":  simulate,
+	"snapshot":  snapshot,
+}
+
+// IsCommand reports whether name is a command that Run can execute.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes the command named by the first argument with the rest of
+// the arguments.
+func Run(args []string, out io.Writer) error {
+	if len(args) == 0 || !IsCommand(args[0]) {
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%w: expected one of %v", ErrUnknownCommand, names)
+	}
+
+	return commands[args[0]](args[1:], out)
+}
+
+// writeJSON writes value to out as indented JSON.
+func writeJSON(out io.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"eikcalb.dev/shark/src/app"
+	"eikcalb.dev/shark/src/service/inventory"
+	"eikcalb.dev/shark/src/store"
+)
+
+var (
+	ErrNoFiles       = errors.New("no files were given")
+	ErrUnknownSchema = errors.New("schema is not known")
+)
+
+// schemas holds the schema of every kind of file that can be migrated,
+// keyed by name.
+var schemas = map[string]store.Schema{
+	inventory.StorageSchema.Name: inventory.StorageSchema,
+	app.ConfigSchema.Name:        app.ConfigSchema,
+}
+
+// migrate migrates stored files to the latest version of their schema and
+// prints what each migration changed. A backup of each file is kept
+// before it is replaced. The application should not be running.
+//
+//	shark migrate [-dry-run] [-schema storage] storage.json config.json
+func migrate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	name := flags.String("schema", "", "schema of the files; defaults to the schema saved in each file, or the start of its name")
+	dryRun := flags.Bool("dry-run", false, "report what would change without replacing the files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return ErrNoFiles
+	}
+
+	reports := []store.MigrationReport{}
+	for _, path := range flags.Args() {
+		schema, err := schemaOf(path, *name)
+		if err != nil {
+			return err
+		}
+
+		report, err := store.MigrateFile(path, schema, !*dryRun)
+		if err != nil {
+			return fmt.Errorf("migrate %s: %w", path, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return writeJSON(out, reports)
+}
+
+// schemaOf returns the schema named name, or the schema of the file at
+// path when name is empty. Files saved before they had a schema are named
+// after it, such as storage.json for the storage schema.
+func schemaOf(path string, name string) (store.Schema, error) {
+	if name == "" {
+		saved, err := store.SchemaOf(path)
+		if err != nil {
+			return store.Schema{}, err
+		}
+		name = saved
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(filepath.Base(path), ".")
+	}
+
+	schema, ok := schemas[name]
+	if !ok {
+		return store.Schema{}, fmt.Errorf("%w: %q for %s", ErrUnknownSchema, name, path)
+	}
+	return schema, nil
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eikcalb.dev/shark/src/service/inventory"
+	"eikcalb.dev/shark/src/store"
+)
+
+func TestMigrate(t *testing.T) {
+	// legacy is an inventory stored before the catalog existed, when every
+	// pack held a copy of its item.
+	legacy := `{
+		"299f6d20-cfbd-4bca-a2c7-3555da9cb0f2": {
+			"strategy": "minimal-overshoot",
+			"packs": [{"type": {"id": "299f6d20-cfbd-4bca-a2c7-3555da9cb0f2", "name": "Shoes", "forSale": true, "price": 5000}, "size": 250}]
+		}
+	}`
+
+	t.Run("migrate()", func(t *testing.T) {
+		t.Run("Should migrate a storage file to the latest schema", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			out := &bytes.Buffer{}
+			if err := migrate([]string{path}, out); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			var reports []store.MigrationReport
+			if err := json.Unmarshal(out.Bytes(), &reports); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if len(reports) != 1 || !reports[0].Saved || reports[0].Schema != inventory.StorageSchema.Name {
+				t.Fatalf("expected: %+v; got: %+v", "a saved storage migration", reports)
+			}
+
+			storage, key := inventory.StorageFile(path)
+			stored, err := storage.Get(context.Background(), key)
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if item := stored.Items["299f6d20-cfbd-4bca-a2c7-3555da9cb0f2"]; item.Name != "Shoes" {
+				t.Fatalf("expected: %+v; got: %+v", "Shoes", item)
+			}
+		})
+
+		t.Run("Should leave files as they are on a dry run", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			if err := migrate([]string{"-dry-run", path}, &bytes.Buffer{}); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if raw, _ := os.ReadFile(path); string(raw) != legacy {
+				t.Fatalf("expected: %+v; got: %+v", legacy, string(raw))
+			}
+		})
+	})
+}
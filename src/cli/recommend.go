@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"eikcalb.dev/shark/src/service/inventory"
+)
+
+// recommend prints the best sets of pack sizes for the order counts in a
+// CSV file or request log.
+//
+//	shark recommend -packs 3 -sizes 250,500,1000,2000 -file demand.csv
+func recommend(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("recommend", flag.ContinueOnError)
+	packs := flags.Int("packs", 3, "number of pack sizes to recommend")
+	rawSizes := flags.String("sizes", "", "comma separated pack sizes to pick from; defaults to the most requested counts")
+	path := flags.String("file", "", "CSV file or request log with the order counts; defaults to stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	sizes, err := parseSizes(*rawSizes)
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if *path != "" {
+		file, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	demand, err := inventory.ReadDemand(input)
+	if err != nil {
+		return err
+	}
+
+	recommendations, err := inventory.Recommend(demand, *packs, sizes)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(out, recommendations)
+}
+
+// parseSizes reads a comma separated list of pack sizes.
+func parseSizes(raw string) ([]uint, error) {
+	sizes := []uint{}
+	if raw == "" {
+		return sizes, nil
+	}
+
+	for _, rawSize := range strings.Split(raw, ",") {
+		size, err := strconv.ParseUint(strings.TrimSpace(rawSize), 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pack size %q: %w", rawSize, err)
+		}
+		sizes = append(sizes, uint(size))
+	}
+
+	return sizes, nil
+}
@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"eikcalb.dev/shark/src/service/inventory"
+)
+
+func TestRecommend(t *testing.T) {
+	t.Run("recommend()", func(t *testing.T) {
+		t.Run("Should rank the pack sizes that fit the demand first", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "demand.csv")
+			if err := os.WriteFile(path, []byte("count,frequency\n250,5\n500,3\n"), 0644); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			out := &bytes.Buffer{}
+			if err := recommend([]string{"-packs", "2", "-sizes", "100,250,500", "-file", path}, out); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			var recommendations []inventory.Recommendation
+			if err := json.Unmarshal(out.Bytes(), &recommendations); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if len(recommendations) == 0 || !slices.Equal(recommendations[0].Sizes, []uint{250, 500}) {
+				t.Fatalf("expected: %+v; got: %+v", []uint{250, 500}, recommendations)
+			}
+		})
+
+		t.Run("Should return an error for pack sizes that are not numbers", func(t *testing.T) {
+			if err := recommend([]string{"-sizes", "250,large"}, &bytes.Buffer{}); err == nil {
+				t.Fatalf("expected: %+v; got: %+v", "an error", err)
+			}
+		})
+	})
+}
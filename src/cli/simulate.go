@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"eikcalb.dev/shark/src/service/inventory"
+	"eikcalb.dev/shark/src/store"
+)
+
+// simulate prints how a proposed pack set for an item would fulfill a
+// sample of counts next to the packs the item has now. The stored
+// inventory is only read.
+//
+//	shark simulate -item <id> -packs 250,500,1000 -counts 1,250,251,501
+func simulate(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	itemID := flags.String("item", "", "ID of the item to simulate")
+	rawPacks := flags.String("packs", "", "comma separated sizes of the proposed packs")
+	strategy := flags.String("strategy", "", "strategy of the proposed pack set; defaults to the strategy of the item")
+	rawCounts := flags.String("counts", "", "comma separated order counts to simulate")
+	path := flags.String("file", "", "CSV file or request log with the order counts to simulate")
+	storagePath := flags.String("storage", inventory.STORAGE_PATH, "inventory storage file")
+	walPath := flags.String("log", inventory.WAL_PATH, "inventory log with the changes since the storage file was saved")
+	backend := flags.String("backend", inventory.STORAGE_BACKEND_JSON, "how the inventory is stored: json or kv")
+	dbPath := flags.String("db", inventory.KV_STORAGE_PATH, "inventory key-value store directory, used with -backend kv")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	sizes, err := parseSizes(*rawPacks)
+	if err != nil {
+		return err
+	}
+	proposed := inventory.PackSetJSONFormat{Strategy: *strategy, Packs: []inventory.Pack{}}
+	for _, size := range sizes {
+		proposed.Packs = append(proposed.Packs, inventory.Pack{Size: size})
+	}
+
+	counts := []int{}
+	if *rawCounts != "" {
+		for _, rawCount := range strings.Split(*rawCounts, ",") {
+			count, err := strconv.Atoi(strings.TrimSpace(rawCount))
+			if err != nil {
+				return fmt.Errorf("invalid count %q: %w", rawCount, err)
+			}
+			counts = append(counts, count)
+		}
+	}
+	if *path != "" {
+		file, err := os.Open(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		demand, err := inventory.ReadDemand(file)
+		if err != nil {
+			return err
+		}
+		// Each count is simulated once for every time it was requested, so
+		// the totals are weighted by demand.
+		for count, frequency := range demand {
+			for ; frequency > 0; frequency-- {
+				counts = append(counts, count)
+			}
+		}
+		slices.Sort(counts)
+	}
+
+	stored, err := readInventory(*backend, *storagePath, *walPath, *dbPath)
+	if err != nil {
+		return err
+	}
+	current, err := stored.PackSet(*itemID)
+	if err != nil {
+		return err
+	}
+
+	simulation, err := inventory.Simulate(current, proposed, counts)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(out, simulation)
+}
+
+// readInventory reads the stored inventory from the backend without
+// changing it, so it can be used while the service is running.
+func readInventory(backend string, storagePath string, walPath string, dbPath string) (*inventory.StorageJSONFormat, error) {
+	switch backend {
+	case inventory.STORAGE_BACKEND_JSON:
+		storage, key := inventory.StorageFile(storagePath)
+		return inventory.ReadStorage(context.Background(), storage, key, walPath)
+	case inventory.STORAGE_BACKEND_KV:
+		items, err := store.OpenKVStore[string, inventory.StoredItem](dbPath, store.KVOptions{ReadOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		defer items.Close()
+
+		return inventory.ReadItems(context.Background(), items)
+	default:
+		return nil, fmt.Errorf("%w: %q", inventory.ErrUnknownBackend, backend)
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eikcalb.dev/shark/src/service/inventory"
+	"github.com/google/uuid"
+)
+
+// writeStorage saves an inventory storage file in dir with one item that
+// has packs of sizes, and returns the path of the file and the item ID.
+func writeStorage(t *testing.T, dir string, sizes ...uint) (string, string) {
+	t.Helper()
+
+	item := inventory.Item{Id: uuid.New(), Name: "Shoes", ForSale: true, Price: 5000}
+	packs := inventory.StoredPackSet{Strategy: inventory.STRATEGY_MINIMAL_OVERSHOOT, Packs: []inventory.StoredPack{}}
+	for _, size := range sizes {
+		packs.Packs = append(packs.Packs, inventory.StoredPack{ItemID: item.Id, Size: size})
+	}
+
+	path := filepath.Join(dir, "storage.json")
+	storage, key := inventory.StorageFile(path)
+	data := inventory.StorageJSONFormat{
+		Items: map[string]inventory.Item{item.Id.String(): item},
+		Packs: map[string]inventory.StoredPackSet{item.Id.String(): packs},
+	}
+	if err := storage.Set(context.Background(), key, data); err != nil {
+		t.Fatalf("expected: %+v; got: %+v", nil, err)
+	}
+
+	return path, item.Id.String()
+}
+
+func TestSimulate(t *testing.T) {
+	t.Run("simulate()", func(t *testing.T) {
+		t.Run("Should simulate each count as often as it was requested", func(t *testing.T) {
+			dir := t.TempDir()
+			storagePath, itemID := writeStorage(t, dir, 250, 500)
+			demandPath := filepath.Join(dir, "demand.csv")
+			if err := os.WriteFile(demandPath, []byte("count,frequency\n250,2\n251,1\n"), 0644); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			out := &bytes.Buffer{}
+			err := simulate([]string{
+				"-item", itemID,
+				"-packs", "250",
+				"-file", demandPath,
+				"-storage", storagePath,
+				"-log", filepath.Join(dir, "storage.wal"),
+			}, out)
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			var simulation inventory.Simulation
+			if err := json.Unmarshal(out.Bytes(), &simulation); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			counts := []int{}
+			for _, line := range simulation.Lines {
+				counts = append(counts, line.Count)
+			}
+			if len(counts) != 3 || counts[0] != 250 || counts[1] != 250 || counts[2] != 251 {
+				t.Fatalf("expected: %+v; got: %+v", []int{250, 250, 251}, counts)
+			}
+			// The current packs send 249 extra items for 251 and the
+			// proposed packs send the same.
+			if simulation.Current.Overshoot != 249 || simulation.Proposed.Overshoot != 249 {
+				t.Fatalf("expected: %+v; got: %+v", 249, simulation)
+			}
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"eikcalb.dev/shark/src/constants"
+	"eikcalb.dev/shark/src/service/inventory"
+)
+
+var (
+	ErrUnknownSubcommand = errors.New("subcommand is not known")
+	ErrNoSnapshot        = errors.New("no snapshot was given")
+)
+
+// snapshot lists the snapshots of the inventory, compares one with the
+// stored inventory or another snapshot, or restores the inventory to one.
+// A restore opens the inventory at the paths given the way the application
+// does, and is refused with inventory.ErrStorageLocked while the
+// application has it open. A snapshot of the inventory is taken before it,
+// which undoes it.
+//
+//	shark snapshot list [-dir snapshots]
+//	shark snapshot diff [-dir snapshots] [-backend json] <id> [<other id>]
+//	shark snapshot restore [-dir snapshots] [-backend json] <id>
+func snapshot(args []string, out io.Writer) error {
+	subcommands := []string{"list", "diff", "restore"}
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected one of %v", ErrUnknownSubcommand, subcommands)
+	}
+
+	flags := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	dir := flags.String("dir", inventory.SNAPSHOT_PATH, "directory of the snapshots")
+	storagePath := flags.String("storage", inventory.STORAGE_PATH, "inventory storage file")
+	walPath := flags.String("log", inventory.WAL_PATH, "inventory log with the changes since the storage file was saved")
+	backend := flags.String("backend", inventory.STORAGE_BACKEND_JSON, "how the inventory is stored: json or kv")
+	dbPath := flags.String("db", inventory.KV_STORAGE_PATH, "inventory key-value store directory, used with -backend kv")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	snapshots := inventory.SnapshotFiles(*dir)
+	switch args[0] {
+	case "list":
+		infos, err := inventory.ListSnapshots(ctx, inventory.SnapshotInfoFiles(*dir))
+		if err != nil {
+			return err
+		}
+		return writeJSON(out, infos)
+	case "diff":
+		if flags.NArg() == 0 {
+			return ErrNoSnapshot
+		}
+		from, err := inventory.GetSnapshot(ctx, snapshots, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		var to inventory.Snapshot
+		if flags.Arg(1) != "" {
+			if to, err = inventory.GetSnapshot(ctx, snapshots, flags.Arg(1)); err != nil {
+				return err
+			}
+		} else {
+			stored, err := readInventory(*backend, *storagePath, *walPath, *dbPath)
+			if err != nil {
+				return err
+			}
+			to.Storage = *stored
+		}
+
+		return writeJSON(out, inventory.DiffSnapshots(from, to))
+	case "restore":
+		if flags.NArg() == 0 {
+			return ErrNoSnapshot
+		}
+
+		initCtx := context.WithValue(ctx, constants.CONTEXT_STORAGE_BACKEND_KEY, *backend)
+		initCtx = context.WithValue(initCtx, constants.CONTEXT_STORAGE_PATH_KEY, *storagePath)
+		initCtx = context.WithValue(initCtx, constants.CONTEXT_WAL_PATH_KEY, *walPath)
+		initCtx = context.WithValue(initCtx, constants.CONTEXT_KV_STORAGE_PATH_KEY, *dbPath)
+		initCtx = context.WithValue(initCtx, constants.CONTEXT_SNAPSHOT_PATH_KEY, *dir)
+
+		inv := &inventory.Inventory{}
+		if err := inv.Initialize(initCtx); err != nil {
+			return err
+		}
+		defer inv.Close()
+		backup, err := inv.RestoreSnapshot(ctx, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return writeJSON(out, map[string]any{"restored": flags.Arg(0), "backup": backup})
+	default:
+		return fmt.Errorf("%w: %q, expected one of %v", ErrUnknownSubcommand, args[0], subcommands)
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"eikcalb.dev/shark/src/constants"
+	"eikcalb.dev/shark/src/service/inventory"
+)
+
+func TestSnapshot(t *testing.T) {
+	// setup saves an inventory with one item in dir, takes a snapshot of
+	// it and then deletes the item. It returns the flags that point the
+	// command at the files, the item ID and the snapshot.
+	setup := func(t *testing.T, dir string) ([]string, string, inventory.SnapshotInfo) {
+		storagePath, itemID := writeStorage(t, dir, 250)
+		flags := []string{
+			"-storage", storagePath,
+			"-log", filepath.Join(dir, "storage.wal"),
+			"-dir", filepath.Join(dir, "snapshots"),
+		}
+
+		inv := open(t, dir)
+		defer inv.Close()
+		info, err := inv.TakeSnapshot(context.Background(), "before deleting")
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		if err := inv.DeleteItem(itemID); err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+
+		return flags, itemID, info
+	}
+
+	t.Run("snapshot()", func(t *testing.T) {
+		t.Run("Should list the snapshots newest first", func(t *testing.T) {
+			flags, _, info := setup(t, t.TempDir())
+
+			out := &bytes.Buffer{}
+			if err := snapshot(append([]string{"list"}, flags...), out); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			var infos []inventory.SnapshotInfo
+			if err := json.Unmarshal(out.Bytes(), &infos); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			// The item is kept in a snapshot of its own before it is
+			// deleted.
+			if len(infos) != 2 || infos[1].ID != info.ID || infos[0].ItemID == "" {
+				t.Fatalf("expected: %+v; got: %+v", "snapshots before the item and before deleting", infos)
+			}
+		})
+
+		t.Run("Should compare a snapshot with the stored inventory", func(t *testing.T) {
+			flags, itemID, info := setup(t, t.TempDir())
+
+			out := &bytes.Buffer{}
+			if err := snapshot(append(append([]string{"diff"}, flags...), info.ID), out); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			var diff inventory.StorageDiff
+			if err := json.Unmarshal(out.Bytes(), &diff); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if len(diff.Removed) != 1 || diff.Removed[0].ItemID != itemID {
+				t.Fatalf("expected: %+v; got: %+v", itemID, diff)
+			}
+		})
+
+		t.Run("Should restore the inventory to a snapshot", func(t *testing.T) {
+			dir := t.TempDir()
+			flags, itemID, info := setup(t, dir)
+
+			if err := snapshot(append(append([]string{"restore"}, flags...), info.ID), &bytes.Buffer{}); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+
+			storage, key := inventory.StorageFile(filepath.Join(dir, "storage.json"))
+			stored, err := inventory.ReadStorage(context.Background(), storage, key, filepath.Join(dir, "storage.wal"))
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if _, ok := stored.Items[itemID]; !ok {
+				t.Fatalf("expected: %+v; got: %+v", itemID, stored.Items)
+			}
+		})
+
+		t.Run("Should refuse to restore while the inventory is open", func(t *testing.T) {
+			dir := t.TempDir()
+			flags, _, info := setup(t, dir)
+
+			inv := open(t, dir)
+			defer inv.Close()
+
+			err := snapshot(append(append([]string{"restore"}, flags...), info.ID), &bytes.Buffer{})
+			if !errors.Is(err, inventory.ErrStorageLocked) {
+				t.Fatalf("expected: %+v; got: %+v", inventory.ErrStorageLocked, err)
+			}
+		})
+
+		t.Run("Should return an error for unknown subcommands", func(t *testing.T) {
+			if err := snapshot([]string{"remove"}, &bytes.Buffer{}); !errors.Is(err, ErrUnknownSubcommand) {
+				t.Fatalf("expected: %+v; got: %+v", ErrUnknownSubcommand, err)
+			}
+		})
+	})
+}
+
+// open opens the inventory saved in dir the way the application does. It
+// is kept open until it is closed.
+func open(t *testing.T, dir string) *inventory.Inventory {
+	t.Helper()
+
+	ctx := context.WithValue(context.Background(), constants.CONTEXT_STORAGE_PATH_KEY, filepath.Join(dir, "storage.json"))
+	ctx = context.WithValue(ctx, constants.CONTEXT_WAL_PATH_KEY, filepath.Join(dir, "storage.wal"))
+	ctx = context.WithValue(ctx, constants.CONTEXT_SNAPSHOT_PATH_KEY, filepath.Join(dir, "snapshots"))
+
+	inv := &inventory.Inventory{}
+	if err := inv.Initialize(ctx); err != nil {
+		t.Fatalf("expected: %+v; got: %+v", nil, err)
+	}
+	return inv
+}
@@ -3,7 +3,21 @@ package constants
 type ServiceContextKey string
 
 const (
-	CONTEXT_APPLICATION_VERSION_KEY ServiceContextKey = "CONTEXT_APPLICATION_VERSION_KEY"
-	CONTEXT_SERVICE_VERSION_KEY     ServiceContextKey = "CONTEXT_SERVICE_VERSION_KEY"
-	CONTEXT_SERVICE_PORT_KEY        ServiceContextKey = "CONTEXT_SERVICE_PORT_KEY"
+	CONTEXT_APPLICATION_VERSION_KEY         ServiceContextKey = "CONTEXT_APPLICATION_VERSION_KEY"
+	CONTEXT_SERVICE_VERSION_KEY             ServiceContextKey = "CONTEXT_SERVICE_VERSION_KEY"
+	CONTEXT_SERVICE_PORT_KEY                ServiceContextKey = "CONTEXT_SERVICE_PORT_KEY"
+	CONTEXT_RESERVATION_TTL_KEY             ServiceContextKey = "CONTEXT_RESERVATION_TTL_KEY"
+	CONTEXT_SOLUTION_CACHE_BOUND_KEY        ServiceContextKey = "CONTEXT_SOLUTION_CACHE_BOUND_KEY"
+	CONTEXT_SOLUTION_CACHE_LIMIT_KEY        ServiceContextKey = "CONTEXT_SOLUTION_CACHE_LIMIT_KEY"
+	CONTEXT_ADMIN_TOKEN_KEY                 ServiceContextKey = "CONTEXT_ADMIN_TOKEN_KEY"
+	CONTEXT_STORAGE_BACKUPS_KEY             ServiceContextKey = "CONTEXT_STORAGE_BACKUPS_KEY"
+	CONTEXT_STORAGE_BACKEND_KEY             ServiceContextKey = "CONTEXT_STORAGE_BACKEND_KEY"
+	CONTEXT_SNAPSHOT_INTERVAL_KEY           ServiceContextKey = "CONTEXT_SNAPSHOT_INTERVAL_KEY"
+	CONTEXT_SNAPSHOT_KEEP_KEY               ServiceContextKey = "CONTEXT_SNAPSHOT_KEEP_KEY"
+	CONTEXT_SNAPSHOT_KEEP_BEFORE_CHANGE_KEY ServiceContextKey = "CONTEXT_SNAPSHOT_KEEP_BEFORE_CHANGE_KEY"
+	CONTEXT_SNAPSHOT_MAX_AGE_KEY            ServiceContextKey = "CONTEXT_SNAPSHOT_MAX_AGE_KEY"
+	CONTEXT_STORAGE_PATH_KEY                ServiceContextKey = "CONTEXT_STORAGE_PATH_KEY"
+	CONTEXT_WAL_PATH_KEY                    ServiceContextKey = "CONTEXT_WAL_PATH_KEY"
+	CONTEXT_KV_STORAGE_PATH_KEY             ServiceContextKey = "CONTEXT_KV_STORAGE_PATH_KEY"
+	CONTEXT_SNAPSHOT_PATH_KEY               ServiceContextKey = "CONTEXT_SNAPSHOT_PATH_KEY"
 )
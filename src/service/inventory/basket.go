@@ -0,0 +1,79 @@
+package inventory
+
+import "fmt"
+
+// BasketLine is a request for Count items of the item with ItemID.
+type BasketLine struct {
+	ItemID string `json:"itemId"`
+	Count  int    `json:"count"`
+}
+
+// BasketLineResult holds the packs used to fulfill a BasketLine.
+type BasketLineResult struct {
+	ItemID string `json:"itemId"`
+	Count  int    `json:"count"`
+	// Packs maps each pack size used to fulfill the line to the number
+	// of packs of that size.
+	Packs map[uint]uint `json:"packs"`
+	// Items is the number of items the packs hold.
+	Items uint `json:"items"`
+	// Price is the price of the packs in the price*100 convention.
+	Price uint64 `json:"price"`
+	// Partial indicates that the packs in stock could not cover Count.
+	Partial bool `json:"partial"`
+	// Error explains why the line could not be fulfilled. Lines with an
+	// error are left out of the basket totals.
+	Error *ErrorBody `json:"error,omitempty"`
+}
+
+// BasketResult holds the packs used to fulfill every line in a basket and
+// the totals across the lines that could be fulfilled.
+type BasketResult struct {
+	Lines []BasketLineResult `json:"lines"`
+	Items uint               `json:"items"`
+	Price uint64             `json:"price"`
+}
+
+// ProcessBasket fulfills every line in a basket with ProcessOrder. A line
+// that cannot be fulfilled carries its own error and does not stop the
+// other lines from being processed.
+//
+// Each line is solved against the stock that is available when the basket
+// is processed, so lines for the same item are not aware of each other.
+func (i *Inventory) ProcessBasket(lines []BasketLine, options ...OrderOption) (BasketResult, error) {
+	log.Info("Process basket start", "lines", len(lines))
+
+	if len(lines) > MAX_BASKET_LINES {
+		log.Error("Failed to process basket", "lines", len(lines), "error", ErrInvalidRequest)
+		return BasketResult{}, fmt.Errorf("%w: a basket holds at most %d lines", ErrInvalidRequest, MAX_BASKET_LINES)
+	}
+
+	result := BasketResult{Lines: []BasketLineResult{}}
+	for _, line := range lines {
+		lineResult := BasketLineResult{
+			ItemID: line.ItemID,
+			Count:  line.Count,
+			Packs:  map[uint]uint{},
+		}
+
+		packsOrder, err := i.ProcessOrder(line.ItemID, line.Count, options...)
+		if err != nil {
+			log.Error("Failed to process basket line", "itemID", line.ItemID, "count", line.Count, "error", err)
+			lineResult.Error = newErrorBody(err)
+			result.Lines = append(result.Lines, lineResult)
+			continue
+		}
+
+		lineResult.Packs = packsOrder.bySize()
+		lineResult.Items = packsOrder.Items()
+		lineResult.Price = packsOrder.Price()
+		lineResult.Partial = lineResult.Items < uint(line.Count)
+
+		result.Lines = append(result.Lines, lineResult)
+		result.Items += lineResult.Items
+		result.Price += lineResult.Price
+	}
+
+	log.Info("Process basket success", "items", result.Items, "price", result.Price)
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBasket(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250}
+		pack2 = Pack{Type: item2, Size: 2, TrackStock: true, Stock: 1}
+
+		inv = Inventory{}
+	)
+
+	setup := func() {
+		ps1 := NewPackSet()
+		ps1.Add(pack1)
+		ps2 := NewPackSet()
+		ps2.Add(pack2)
+
+		inv = Inventory{}
+		inv.data = ItemPackMap{}
+		inv.data[item1.Id.String()] = *ps1
+		inv.data[item2.Id.String()] = *ps2
+	}
+
+	t.Run("Inventory.ProcessBasket()", func(t *testing.T) {
+		t.Run("Should fulfill every line and total the basket", func(t *testing.T) {
+			setup()
+
+			result, err := inv.ProcessBasket([]BasketLine{
+				{ItemID: item1.Id.String(), Count: 300},
+				{ItemID: item2.Id.String(), Count: 2},
+			})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if len(result.Lines) != 2 {
+				assertEqual(t, 2, len(result.Lines))
+			}
+			if result.Lines[0].Packs[250] != 2 {
+				assertEqual(t, 2, result.Lines[0].Packs[250])
+			}
+			if result.Items != 502 {
+				assertEqual(t, 502, result.Items)
+			}
+
+			expectedPrice := uint64(500)*uint64(item1.Price) + uint64(2)*uint64(item2.Price)
+			if result.Price != expectedPrice {
+				assertEqual(t, expectedPrice, result.Price)
+			}
+		})
+
+		t.Run("Should report line errors without failing the basket", func(t *testing.T) {
+			setup()
+
+			result, err := inv.ProcessBasket([]BasketLine{
+				{ItemID: "unknown", Count: 10},
+				{ItemID: item1.Id.String(), Count: 0},
+				{ItemID: item1.Id.String(), Count: 10},
+			})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if result.Lines[0].Error == nil || result.Lines[0].Error.Code != "item_not_found" {
+				assertEqual(t, "item_not_found", result.Lines[0].Error)
+			}
+			if result.Lines[1].Error == nil || result.Lines[1].Error.Code != "invalid_count" {
+				assertEqual(t, "invalid_count", result.Lines[1].Error)
+			}
+			if result.Lines[2].Error != nil || result.Items != 250 {
+				assertEqual(t, 250, result.Items)
+			}
+		})
+
+		t.Run("Should flag lines that are partly filled", func(t *testing.T) {
+			setup()
+
+			result, err := inv.ProcessBasket([]BasketLine{
+				{ItemID: item2.Id.String(), Count: 4},
+			})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if !result.Lines[0].Partial {
+				assertEqual(t, true, result.Lines[0].Partial)
+			}
+		})
+
+		t.Run("Should refuse a basket with too many lines", func(t *testing.T) {
+			setup()
+
+			lines := make([]BasketLine, MAX_BASKET_LINES+1)
+			for index := range lines {
+				lines[index] = BasketLine{ItemID: item1.Id.String(), Count: 1}
+			}
+
+			if _, err := inv.ProcessBasket(lines); !errors.Is(err, ErrInvalidRequest) {
+				assertEqual(t, ErrInvalidRequest, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,331 @@
+package inventory
+
+import (
+	"container/list"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats reports how well the solution cache is serving orders.
+type CacheStats struct {
+	// Bound is the largest count that is cached.
+	Bound int `json:"bound"`
+	// Limit is the largest number of orders cached across all items.
+	Limit int `json:"limit"`
+	// Entries is the number of orders cached.
+	Entries int `json:"entries"`
+	// Items is the number of items with cached orders.
+	Items int `json:"items"`
+	// Hits is the number of orders answered from the cache.
+	Hits uint64 `json:"hits"`
+	// Misses is the number of orders that had to be solved, including
+	// those for counts beyond the bound.
+	Misses uint64 `json:"misses"`
+}
+
+// solutionKey identifies an order in the solution cache.
+type solutionKey struct {
+	itemID   string
+	strategy string
+	count    int
+}
+
+// cachedOrder is an order held in the solution cache.
+type cachedOrder struct {
+	key   solutionKey
+	order InventoryOrder
+}
+
+// solutionCache remembers the orders solved for each item so that the same
+// count is not solved again. Only counts up to the bound are kept, and the
+// least recently used orders are dropped once the cache holds more than
+// its limit.
+type solutionCache struct {
+	mutex sync.Mutex
+	bound int
+	limit int
+	items map[string]*itemSolutions
+	// recent lists the cached orders from the most to the least recently
+	// used.
+	recent list.List
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// itemSolutions holds the cached orders of an item.
+type itemSolutions struct {
+	// generation changes every time the cache of the item is invalidated,
+	// so that a rebuild for packs that were replaced can stop.
+	generation uint64
+	// packs are the packs that were available when the orders were
+	// solved. The orders are dropped when the packs or their stock change.
+	packs []Pack
+	// orders maps each cached order of the item to its place in recent.
+	orders map[solutionKey]*list.Element
+}
+
+// getBound returns the largest count that is cached.
+func (c *solutionCache) getBound() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.bound <= 0 {
+		return DEFAULT_SOLUTION_CACHE_BOUND
+	}
+	return c.bound
+}
+
+// setBound changes the largest count that is cached.
+func (c *solutionCache) setBound(bound int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.bound = bound
+}
+
+// getLimit returns the largest number of orders cached. It must be called
+// with the cache lock held.
+func (c *solutionCache) getLimit() int {
+	if c.limit <= 0 {
+		return DEFAULT_SOLUTION_CACHE_LIMIT
+	}
+	return c.limit
+}
+
+// setLimit changes the largest number of orders cached, dropping the least
+// recently used orders beyond it.
+func (c *solutionCache) setLimit(limit int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.limit = limit
+	c.evict()
+}
+
+// get returns the order cached for count when the item was solved with
+// strategy from the same packs.
+func (c *solutionCache) get(itemID string, strategy string, packs []Pack, count int) (InventoryOrder, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.items[itemID]; ok && slices.Equal(entry.packs, packs) {
+		if element, ok := entry.orders[solutionKey{itemID, strategy, count}]; ok {
+			c.recent.MoveToFront(element)
+			c.hits.Add(1)
+			return maps.Clone(element.Value.(*cachedOrder).order), true
+		}
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// put caches the order solved for count with strategy from packs. Orders
+// for counts beyond the bound are not cached.
+func (c *solutionCache) put(itemID string, strategy string, packs []Pack, count int, order InventoryOrder) {
+	if count > c.getBound() {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.putLocked(itemID, strategy, packs, count, order)
+}
+
+// putLocked caches an order. It must be called with the cache lock held.
+func (c *solutionCache) putLocked(itemID string, strategy string, packs []Pack, count int, order InventoryOrder) {
+	if c.items == nil {
+		c.items = map[string]*itemSolutions{}
+	}
+
+	entry, ok := c.items[itemID]
+	if !ok {
+		entry = &itemSolutions{orders: map[solutionKey]*list.Element{}}
+		c.items[itemID] = entry
+	}
+	if !slices.Equal(entry.packs, packs) {
+		// The packs changed since the orders were solved.
+		c.clear(entry)
+		entry.packs = slices.Clone(packs)
+	}
+
+	key := solutionKey{itemID, strategy, count}
+	if element, ok := entry.orders[key]; ok {
+		element.Value.(*cachedOrder).order = maps.Clone(order)
+		c.recent.MoveToFront(element)
+		return
+	}
+	entry.orders[key] = c.recent.PushFront(&cachedOrder{key: key, order: maps.Clone(order)})
+	c.evict()
+}
+
+// evict drops the least recently used orders beyond the limit. It must be
+// called with the cache lock held.
+func (c *solutionCache) evict() {
+	for c.recent.Len() > c.getLimit() {
+		cached := c.recent.Remove(c.recent.Back()).(*cachedOrder)
+		if entry, ok := c.items[cached.key.itemID]; ok {
+			delete(entry.orders, cached.key)
+		}
+	}
+}
+
+// clear drops the orders cached for entry. It must be called with the
+// cache lock held.
+func (c *solutionCache) clear(entry *itemSolutions) {
+	for _, element := range entry.orders {
+		c.recent.Remove(element)
+	}
+	entry.orders = map[solutionKey]*list.Element{}
+}
+
+// invalidate drops the orders cached for the item. It returns the new
+// generation of its cache and the counts that were cached for each
+// strategy, so that they can be solved again.
+func (c *solutionCache) invalidate(itemID string) (uint64, map[string][]int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.items == nil {
+		c.items = map[string]*itemSolutions{}
+	}
+
+	entry, ok := c.items[itemID]
+	if !ok {
+		entry = &itemSolutions{orders: map[solutionKey]*list.Element{}}
+		c.items[itemID] = entry
+	}
+
+	counts := map[string][]int{}
+	for key := range entry.orders {
+		counts[key.strategy] = append(counts[key.strategy], key.count)
+	}
+	c.clear(entry)
+	entry.generation++
+	entry.packs = nil
+
+	return entry.generation, counts
+}
+
+// drop forgets the item, which also stops any rebuild of its cache.
+func (c *solutionCache) drop(itemID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.items[itemID]; ok {
+		c.clear(entry)
+		delete(c.items, itemID)
+	}
+}
+
+// cachedItems returns the IDs of the items with cached orders.
+func (c *solutionCache) cachedItems() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ids := []string{}
+	for id, entry := range c.items {
+		if len(entry.orders) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// putGeneration caches an order solved while rebuilding the cache of the
+// item. It reports false when the cache was invalidated since generation,
+// which means the rebuild should stop.
+func (c *solutionCache) putGeneration(itemID string, generation uint64, strategy string, packs []Pack, count int, order InventoryOrder) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.items[itemID]
+	if !ok || entry.generation != generation {
+		return false
+	}
+
+	c.putLocked(itemID, strategy, packs, count, order)
+	return true
+}
+
+// stats returns the counters of the cache.
+func (c *solutionCache) stats() CacheStats {
+	bound := c.getBound()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	items := 0
+	for _, entry := range c.items {
+		if len(entry.orders) > 0 {
+			items++
+		}
+	}
+
+	return CacheStats{
+		Bound:   bound,
+		Limit:   c.getLimit(),
+		Entries: c.recent.Len(),
+		Items:   items,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
+
+// CacheStats returns the hit and miss counters of the solution cache.
+func (i *Inventory) CacheStats() CacheStats {
+	return i.cache.stats()
+}
+
+// rebuildCache drops the orders cached for the item and solves the counts
+// that were cached for its configured strategy again, so that only counts
+// that were ordered are solved ahead of the next order. It stops early when
+// the item is changed again while it runs.
+func (i *Inventory) rebuildCache(itemID string) {
+	generation, cached := i.cache.invalidate(itemID)
+
+	i.lock()
+	packSet, err := i.getPacksForItemByID(itemID)
+	if err != nil {
+		i.unLock()
+		return
+	}
+	available := i.availablePacks(itemID, packSet.getPacks())
+	i.unLock()
+
+	strategy, err := GetStrategy(packSet.Strategy())
+	if err != nil || len(available) == 0 {
+		return
+	}
+	counts := cached[strategy.Name()]
+	if len(counts) == 0 {
+		return
+	}
+	slices.Sort(counts)
+
+	log.Info("Rebuild solution cache start", "itemID", itemID, "strategy", strategy.Name(), "counts", len(counts))
+	for _, count := range counts {
+		order, err := strategy.Solve(available, count, nil)
+		if err != nil {
+			log.Error("Failed to rebuild solution cache", "itemID", itemID, "count", count, "error", err)
+			return
+		}
+		if !i.cache.putGeneration(itemID, generation, strategy.Name(), available, count, order) {
+			log.Info("Rebuild solution cache stopped for changed item", "itemID", itemID)
+			return
+		}
+	}
+	log.Info("Rebuild solution cache success", "itemID", itemID, "counts", len(counts))
+}
+
+// rebuildCaches rebuilds the solution cache of every item with cached
+// orders.
+func (i *Inventory) rebuildCaches() {
+	for _, id := range i.cache.cachedItems() {
+		i.rebuildCache(id)
+	}
+}
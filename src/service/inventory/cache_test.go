@@ -0,0 +1,142 @@
+package inventory
+
+import (
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250}
+		pack2 = Pack{Type: item1, Size: 500}
+		id    = item1.Id.String()
+
+		inv = Inventory{}
+	)
+
+	setup := func() {
+		ps := NewPackSet()
+		ps.Add(pack1)
+		ps.Add(pack2)
+
+		inv = Inventory{}
+		inv.data = ItemPackMap{}
+		inv.data[id] = *ps
+	}
+
+	t.Run("Inventory.ProcessOrder()", func(t *testing.T) {
+		t.Run("Should answer a repeated order from the cache", func(t *testing.T) {
+			setup()
+
+			first, _ := inv.ProcessOrder(id, 501)
+			second, _ := inv.ProcessOrder(id, 501)
+
+			stats := inv.CacheStats()
+			if stats.Hits != 1 || stats.Misses != 1 {
+				assertEqual(t, "1 hit and 1 miss", stats)
+			}
+			if second[pack2] != first[pack2] || second[pack1] != first[pack1] {
+				assertEqual(t, first, second)
+			}
+		})
+
+		t.Run("Should not use orders solved for other packs", func(t *testing.T) {
+			setup()
+
+			inv.ProcessOrder(id, 500)
+
+			ps := NewPackSet()
+			ps.Add(pack1)
+			inv.data[id] = *ps
+
+			result, _ := inv.ProcessOrder(id, 500)
+			if result[pack1] != 2 {
+				assertEqual(t, 2, result[pack1])
+			}
+			if stats := inv.CacheStats(); stats.Hits != 0 {
+				assertEqual(t, 0, stats.Hits)
+			}
+		})
+
+		t.Run("Should not cache counts beyond the bound", func(t *testing.T) {
+			setup()
+			inv.cache.setBound(100)
+
+			inv.ProcessOrder(id, 501)
+			inv.ProcessOrder(id, 501)
+
+			if stats := inv.CacheStats(); stats.Hits != 0 || stats.Misses != 2 {
+				assertEqual(t, "0 hits and 2 misses", stats)
+			}
+		})
+
+		t.Run("Should solve orders that are explained", func(t *testing.T) {
+			setup()
+
+			inv.ProcessOrder(id, 501)
+			trace := &SolverTrace{}
+			inv.ProcessOrder(id, 501, WithExplain(trace))
+
+			if trace.Chosen.Items != 750 {
+				assertEqual(t, 750, trace.Chosen.Items)
+			}
+		})
+
+		t.Run("Should drop the least recently used orders beyond the limit", func(t *testing.T) {
+			setup()
+			inv.cache.setLimit(2)
+
+			inv.ProcessOrder(id, 1)
+			inv.ProcessOrder(id, 2)
+			inv.ProcessOrder(id, 1)
+			inv.ProcessOrder(id, 3)
+
+			if stats := inv.CacheStats(); stats.Entries != 2 || stats.Limit != 2 {
+				assertEqual(t, "2 of 2 entries", stats)
+			}
+			inv.ProcessOrder(id, 1)
+			inv.ProcessOrder(id, 2)
+			if stats := inv.CacheStats(); stats.Hits != 2 || stats.Misses != 4 {
+				assertEqual(t, "2 hits and 4 misses", stats)
+			}
+		})
+	})
+
+	t.Run("Inventory.rebuildCache()", func(t *testing.T) {
+		t.Run("Should solve the counts that were ordered again", func(t *testing.T) {
+			setup()
+
+			for count := 1; count <= 50; count++ {
+				inv.ProcessOrder(id, count)
+			}
+			inv.rebuildCache(id)
+			for count := 1; count <= 50; count++ {
+				inv.ProcessOrder(id, count)
+			}
+
+			if stats := inv.CacheStats(); stats.Hits != 50 || stats.Misses != 50 || stats.Entries != 50 || stats.Items != 1 {
+				assertEqual(t, "50 hits and 50 misses for 50 entries of 1 item", stats)
+			}
+		})
+
+		t.Run("Should not solve counts that were not ordered", func(t *testing.T) {
+			setup()
+
+			inv.rebuildCache(id)
+
+			if stats := inv.CacheStats(); stats.Entries != 0 || stats.Items != 0 {
+				assertEqual(t, "no entries", stats)
+			}
+		})
+
+		t.Run("Should stop when the item changes", func(t *testing.T) {
+			setup()
+
+			generation, _ := inv.cache.invalidate(id)
+			inv.cache.invalidate(id)
+
+			if inv.cache.putGeneration(id, generation, STRATEGY_MINIMAL_OVERSHOOT, []Pack{pack1}, 1, InventoryOrder{pack1: 1}) {
+				assertEqual(t, false, true)
+			}
+		})
+	})
+}
@@ -0,0 +1,376 @@
+package inventory
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ItemJSONFormat is the representation of an item along with its packs.
+type ItemJSONFormat struct {
+	Item     Item   `json:"item"`
+	Strategy string `json:"strategy"`
+	Packs    []Pack `json:"packs"`
+}
+
+// ItemPatch lists the details of an item to change. Fields that are nil
+// are left as they are.
+type ItemPatch struct {
+	Name     *string `json:"name"`
+	ForSale  *bool   `json:"forSale"`
+	Price    *uint32 `json:"price"`
+	Strategy *string `json:"strategy"`
+}
+
+// ItemFilter selects items by their details. Fields that are nil match
+// every item.
+type ItemFilter struct {
+	ForSale *bool
+}
+
+// matches reports whether item is selected by the filter.
+func (f ItemFilter) matches(item Item) bool {
+	return f.ForSale == nil || item.ForSale == *f.ForSale
+}
+
+// validateItem returns ErrInvalidRequest when item cannot be stored in the
+// catalog.
+func validateItem(item Item) error {
+	if strings.TrimSpace(item.Name) == "" {
+		return fmt.Errorf("%w: item name must not be empty", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// checkPacks returns ErrInvalidRequest when any of packs is empty and
+// ErrItemMismatch when any names an item other than the one with id. Packs
+// may leave their type empty.
+func checkPacks(id uuid.UUID, packs []Pack) error {
+	for _, pack := range packs {
+		if pack.Size == 0 {
+			return fmt.Errorf("%w: pack size must be greater than zero", ErrInvalidRequest)
+		}
+		if pack.Type.Id != uuid.Nil && pack.Type.Id != id {
+			return fmt.Errorf("%w: pack of %d holds item %s", ErrItemMismatch, pack.Size, pack.Type.Id)
+		}
+	}
+	return nil
+}
+
+// catalogItem returns the item with itemID from the catalog for packs that
+// are about to be stored under it. Packs may leave their type empty, but
+// ErrItemMismatch is returned when one names another item. An item that is
+// not in the catalog yet is taken from the first pack that names it, and
+// ErrInvalidRequest is returned when that item has no name or no pack names
+// it, since the item should be created with CreateItem instead. It must be
+// called with the Inventory lock held.
+func (i *Inventory) catalogItem(itemID string, packs []Pack) (Item, error) {
+	id, err := uuid.Parse(itemID)
+	if err != nil {
+		return Item{}, fmt.Errorf("%w: item ID is not a UUID: %v", ErrInvalidRequest, err)
+	}
+	if err := checkPacks(id, packs); err != nil {
+		return Item{}, err
+	}
+
+	if item, ok := i.items[itemID]; ok {
+		return item, nil
+	}
+	for _, pack := range packs {
+		if pack.Type.Id == id {
+			if err := validateItem(pack.Type); err != nil {
+				return Item{}, err
+			}
+			return pack.Type, nil
+		}
+	}
+	return Item{}, fmt.Errorf("%w: item %s is not in the catalog, create it before setting its packs", ErrInvalidRequest, itemID)
+}
+
+// findItem returns the item with itemID from the catalog. It must be
+// called with the Inventory lock held.
+func (i *Inventory) findItem(itemID string) (Item, error) {
+	item, ok := i.items[itemID]
+	if !ok {
+		return Item{}, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// itemOf returns the item with itemID from the catalog, or the item its
+// packs hold when it is not in the catalog. It must be called with the
+// Inventory lock held.
+func (i *Inventory) itemOf(itemID string) Item {
+	if item, ok := i.items[itemID]; ok {
+		return item
+	}
+	if packSet, ok := i.data[itemID]; ok && len(packSet.values) > 0 {
+		return packSet.values[0].Type
+	}
+	return Item{}
+}
+
+// itemJSON returns the item with itemID along with its packs. It must be
+// called with the Inventory lock held.
+func (i *Inventory) itemJSON(itemID string) (ItemJSONFormat, error) {
+	item, err := i.findItem(itemID)
+	if err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	result := ItemJSONFormat{Item: item, Strategy: DEFAULT_STRATEGY, Packs: []Pack{}}
+	if packSet, ok := i.data[itemID]; ok {
+		result.Strategy = packSet.Strategy()
+		result.Packs = slices.Clone(packSet.getPacks())
+	}
+	return result, nil
+}
+
+// setPacks stores item in the catalog and replaces its packs with those in
+// format, which are made to hold item. It must be called with the
+// Inventory lock held.
+func (i *Inventory) setPacks(item Item, format PackSetJSONFormat) error {
+	packs := make([]Pack, 0, len(format.Packs))
+	for _, pack := range format.Packs {
+		pack.Type = item
+		packs = append(packs, pack)
+	}
+	format.Packs = packs
+
+	packSet, err := NewPackSetFromJSON(format)
+	if err != nil {
+		return err
+	}
+
+	if i.items == nil {
+		i.items = map[string]Item{}
+	}
+	if i.data == nil {
+		i.data = ItemPackMap{}
+	}
+	itemID := item.Id.String()
+	i.items[itemID] = item
+	i.data[itemID] = *packSet
+
+	return nil
+}
+
+// SetPacks replaces the packs of the item with itemID. The packs hold the
+// item from the catalog, and an item that is not in the catalog yet is
+// added to it when the packs name it.
+func (i *Inventory) SetPacks(itemID string, format PackSetJSONFormat) error {
+	i.lock()
+	defer i.unLock()
+
+	item, err := i.catalogItem(itemID, format.Packs)
+	if err != nil {
+		return err
+	}
+
+	// A request without a strategy keeps the one the item already has.
+	if format.Strategy == "" {
+		if current, ok := i.data[itemID]; ok {
+			format.Strategy = current.strategy
+		}
+	}
+	// Replacing packs drops the ones the item has, so they are kept in a
+	// snapshot first.
+	if current, ok := i.data[itemID]; ok && len(current.values) > 0 {
+		if err := i.snapshotBefore("before replacing packs of item "+itemID, itemID); err != nil {
+			return err
+		}
+	}
+
+	before := i.itemState(itemID)
+	if err := i.setPacks(item, format); err != nil {
+		return err
+	}
+	return i.logMutation(MUTATION_ITEM_REPLACED, itemID, before)
+}
+
+// GetItem returns the item with itemID along with its packs.
+func (i *Inventory) GetItem(itemID string) (ItemJSONFormat, error) {
+	i.lock()
+	defer i.unLock()
+
+	return i.itemJSON(itemID)
+}
+
+// CreateItem adds item to the catalog with the packs in format. An item
+// without an ID is given a new one. It returns ErrItemAlreadyExists when
+// an item with the same ID is in the inventory.
+func (i *Inventory) CreateItem(item Item, format PackSetJSONFormat) (ItemJSONFormat, error) {
+	if err := validateItem(item); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	if item.Id == uuid.Nil {
+		item.Id = uuid.New()
+	}
+	if err := checkPacks(item.Id, format.Packs); err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	i.lock()
+	defer i.unLock()
+
+	itemID := item.Id.String()
+	_, inCatalog := i.items[itemID]
+	_, hasPacks := i.data[itemID]
+	if inCatalog || hasPacks {
+		return ItemJSONFormat{}, ErrItemAlreadyExists
+	}
+
+	before := i.itemState(itemID)
+	if err := i.setPacks(item, format); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	if err := i.logMutation(MUTATION_ITEM_REPLACED, itemID, before); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	return i.itemJSON(itemID)
+}
+
+// UpdateItem changes the details of the item with itemID that are set in
+// patch. Every pack of the item is updated to hold the changed item.
+func (i *Inventory) UpdateItem(itemID string, patch ItemPatch) (ItemJSONFormat, error) {
+	i.lock()
+	defer i.unLock()
+
+	item, err := i.findItem(itemID)
+	if err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	if patch.Name != nil {
+		item.Name = *patch.Name
+	}
+	if patch.ForSale != nil {
+		item.ForSale = *patch.ForSale
+	}
+	if patch.Price != nil {
+		item.Price = *patch.Price
+	}
+	if err := validateItem(item); err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	format := PackSetJSONFormat{Packs: []Pack{}}
+	if packSet, ok := i.data[itemID]; ok {
+		format.Strategy = packSet.strategy
+		format.Packs = packSet.getPacks()
+	}
+	if patch.Strategy != nil {
+		format.Strategy = *patch.Strategy
+	}
+
+	before := i.itemState(itemID)
+	if err := i.setPacks(item, format); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	if err := i.logMutation(MUTATION_ITEM_REPLACED, itemID, before); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	return i.itemJSON(itemID)
+}
+
+// DeleteItem removes the item with itemID and its packs from the
+// inventory. It returns ErrItemInUse while the item has open orders, since
+// they may still take packs out of stock.
+func (i *Inventory) DeleteItem(itemID string) error {
+	i.lock()
+	defer i.unLock()
+
+	if _, err := i.findItem(itemID); err != nil {
+		return err
+	}
+	for _, order := range i.orders {
+		if order.ItemID == itemID && order.isOpen() {
+			return fmt.Errorf("%w: order %s is %s", ErrItemInUse, order.Id, order.State)
+		}
+	}
+
+	if err := i.snapshotBefore("before deleting item "+itemID, itemID); err != nil {
+		return err
+	}
+
+	before := i.itemState(itemID)
+	delete(i.items, itemID)
+	delete(i.data, itemID)
+	if err := i.logMutation(MUTATION_ITEM_DELETED, itemID, before); err != nil {
+		return err
+	}
+	delete(i.reserved, itemID)
+	i.cache.drop(itemID)
+
+	return nil
+}
+
+// AddPack adds pack to the item with itemID. The pack holds the item from
+// the catalog, and ErrItemMismatch is returned when it names another item.
+func (i *Inventory) AddPack(itemID string, pack Pack) (ItemJSONFormat, error) {
+	i.lock()
+	defer i.unLock()
+
+	item, err := i.findItem(itemID)
+	if err != nil {
+		return ItemJSONFormat{}, err
+	}
+	if err := checkPacks(item.Id, []Pack{pack}); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	pack.Type = item
+
+	before := i.itemState(itemID)
+	packSet := *NewPackSet()
+	if before.hasPacks {
+		packSet = clonePackSet(before.packSet)
+	}
+	if err := packSet.Add(pack); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	packSet.Sort()
+	i.data[itemID] = packSet
+	if err := i.logMutation(MUTATION_PACK_ADDED, itemID, before); err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	return i.itemJSON(itemID)
+}
+
+// RemovePack removes the pack with size from the item with itemID. It
+// returns ErrItemInUse while a reservation holds packs of that size, since
+// committing it would no longer take them out of stock.
+func (i *Inventory) RemovePack(itemID string, size uint) (ItemJSONFormat, error) {
+	i.lock()
+	defer i.unLock()
+
+	item, err := i.findItem(itemID)
+	if err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	before := i.itemState(itemID)
+	if !before.hasPacks {
+		return ItemJSONFormat{}, ErrPackNotFound
+	}
+	packSet := clonePackSet(before.packSet)
+	if err := packSet.Remove(Pack{Type: item, Size: size}); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	for _, order := range i.orders {
+		if order.ItemID == itemID && order.State == ORDER_STATE_RESERVED && order.Packs[size] > 0 {
+			return ItemJSONFormat{}, fmt.Errorf("%w: order %s holds packs of size %d", ErrItemInUse, order.Id, size)
+		}
+	}
+	if err := i.snapshotBefore(fmt.Sprintf("before removing pack %d from item %s", size, itemID), itemID); err != nil {
+		return ItemJSONFormat{}, err
+	}
+	i.data[itemID] = packSet
+	if err := i.logMutation(MUTATION_PACK_REMOVED, itemID, before); err != nil {
+		return ItemJSONFormat{}, err
+	}
+
+	return i.itemJSON(itemID)
+}
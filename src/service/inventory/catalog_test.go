@@ -0,0 +1,288 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCatalog(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250}
+		pack2 = Pack{Type: item1, Size: 500}
+		id    = item1.Id.String()
+
+		inv = Inventory{}
+	)
+
+	setup := func() {
+		inv = Inventory{}
+		if err := inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{pack1, pack2}}); err != nil {
+			assertEqual(t, NO_ERROR, err)
+		}
+	}
+
+	t.Run("Inventory.serialize()", func(t *testing.T) {
+		t.Run("Should only list items that match the filter", func(t *testing.T) {
+			setup()
+			created, _ := inv.CreateItem(Item{Name: "Sample"}, PackSetJSONFormat{})
+
+			forSale, notForSale := true, false
+			listed := *inv.serialize(ItemFilter{ForSale: &forSale})
+			if _, ok := listed[id]; !ok || len(listed) != 1 {
+				assertEqual(t, id, listed)
+			}
+			listed = *inv.serialize(ItemFilter{ForSale: &notForSale})
+			if _, ok := listed[created.Item.Id.String()]; !ok || len(listed) != 1 {
+				assertEqual(t, created.Item.Id.String(), listed)
+			}
+			if listed := *inv.serialize(ItemFilter{}); len(listed) != 2 {
+				assertEqual(t, 2, len(listed))
+			}
+		})
+	})
+
+	t.Run("Inventory.SetPacks()", func(t *testing.T) {
+		t.Run("Should not add items without a name to the catalog", func(t *testing.T) {
+			setup()
+			unknown := uuid.New().String()
+
+			cases := []struct {
+				name  string
+				packs []Pack
+			}{
+				{"packs without a type", []Pack{{Size: 250}}},
+				{"packs holding an item without a name", []Pack{{Type: Item{Id: uuid.MustParse(unknown)}, Size: 250}}},
+			}
+
+			for _, tc := range cases {
+				err := inv.SetPacks(unknown, PackSetJSONFormat{Packs: tc.packs})
+				if !errors.Is(err, ErrInvalidRequest) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, ErrInvalidRequest, err)
+				}
+			}
+			if _, ok := inv.items[unknown]; ok {
+				assertEqual(t, "no item", inv.items[unknown])
+			}
+		})
+
+		t.Run("Should keep the item in the catalog for packs without a type", func(t *testing.T) {
+			setup()
+
+			if err := inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Size: 100}}}); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if inv.data[id].values[0].Type != item1 {
+				assertEqual(t, item1, inv.data[id].values[0].Type)
+			}
+		})
+	})
+
+	t.Run("Inventory.CreateItem()", func(t *testing.T) {
+		t.Run("Should add the item and its packs", func(t *testing.T) {
+			setup()
+
+			created, err := inv.CreateItem(Item{Name: "Scarf"}, PackSetJSONFormat{Packs: []Pack{{Size: 10}}})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if created.Item.Id == uuid.Nil || created.Packs[0].Type != created.Item {
+				assertEqual(t, "new ID held by the pack", created)
+			}
+
+			item, err := inv.GetItem(created.Item.Id.String())
+			if err != nil || item.Item != created.Item || len(item.Packs) != 1 {
+				assertEqual(t, created, item)
+			}
+		})
+
+		t.Run("Should return an error for invalid items", func(t *testing.T) {
+			setup()
+
+			cases := []struct {
+				name  string
+				item  Item
+				packs []Pack
+				err   error
+			}{
+				{"no name", Item{}, nil, ErrInvalidRequest},
+				{"existing item", item1, nil, ErrItemAlreadyExists},
+				{"empty pack", Item{Name: "Scarf"}, []Pack{{}}, ErrInvalidRequest},
+				{"pack of another item", Item{Name: "Scarf"}, []Pack{pack1}, ErrItemMismatch},
+				{"repeated pack", Item{Name: "Scarf"}, []Pack{{Size: 10}, {Size: 10}}, ErrPackAlreadyExists},
+			}
+
+			for _, tc := range cases {
+				_, err := inv.CreateItem(tc.item, PackSetJSONFormat{Packs: tc.packs})
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+		})
+	})
+
+	t.Run("Inventory.UpdateItem()", func(t *testing.T) {
+		t.Run("Should change the item held by every pack", func(t *testing.T) {
+			setup()
+
+			name, strategy := "Ankle Boot", "fewest-packs"
+			updated, err := inv.UpdateItem(id, ItemPatch{Name: &name, Strategy: &strategy})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if updated.Item.Name != name || updated.Item.Price != item1.Price || updated.Strategy != strategy {
+				assertEqual(t, "renamed item with its price", updated)
+			}
+			for _, pack := range inv.data[id].values {
+				if pack.Type != updated.Item {
+					assertEqual(t, updated.Item, pack.Type)
+				}
+			}
+		})
+
+		t.Run("Should keep the stock of the packs", func(t *testing.T) {
+			setup()
+			inv.AddPack(id, Pack{Size: 1000, TrackStock: true, Stock: 4})
+
+			price := uint32(10)
+			updated, _ := inv.UpdateItem(id, ItemPatch{Price: &price})
+			if updated.Packs[2].Stock != 4 {
+				assertEqual(t, 4, updated.Packs[2].Stock)
+			}
+		})
+
+		t.Run("Should return an error for invalid changes", func(t *testing.T) {
+			setup()
+
+			empty, unknown := "", "unknown"
+			cases := []struct {
+				name   string
+				itemID string
+				patch  ItemPatch
+				err    error
+			}{
+				{"unknown item", "unknown", ItemPatch{}, ErrItemNotFound},
+				{"empty name", id, ItemPatch{Name: &empty}, ErrInvalidRequest},
+				{"unknown strategy", id, ItemPatch{Strategy: &unknown}, ErrUnknownStrategy},
+			}
+
+			for _, tc := range cases {
+				_, err := inv.UpdateItem(tc.itemID, tc.patch)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+			if inv.items[id] != item1 {
+				assertEqual(t, item1, inv.items[id])
+			}
+		})
+	})
+
+	t.Run("Inventory.DeleteItem()", func(t *testing.T) {
+		t.Run("Should remove the item and its packs", func(t *testing.T) {
+			setup()
+
+			if err := inv.DeleteItem(id); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if _, err := inv.GetItem(id); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+			if _, err := inv.ProcessOrder(id, 1); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+
+		t.Run("Should return an error while the item has open orders", func(t *testing.T) {
+			setup()
+
+			if _, err := inv.CreateOrder(id, 250, false); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if err := inv.DeleteItem(id); !errors.Is(err, ErrItemInUse) {
+				assertEqual(t, ErrItemInUse, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.AddPack()", func(t *testing.T) {
+		t.Run("Should add a pack holding the item", func(t *testing.T) {
+			setup()
+
+			item, err := inv.AddPack(id, Pack{Size: 100})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if len(item.Packs) != 3 || item.Packs[0].Size != 100 || item.Packs[0].Type != item1 {
+				assertEqual(t, "100, 250 and 500", item.Packs)
+			}
+		})
+
+		t.Run("Should return an error for invalid packs", func(t *testing.T) {
+			setup()
+
+			cases := []struct {
+				name   string
+				itemID string
+				pack   Pack
+				err    error
+			}{
+				{"unknown item", "unknown", Pack{Size: 100}, ErrItemNotFound},
+				{"empty pack", id, Pack{}, ErrInvalidRequest},
+				{"repeated pack", id, Pack{Size: 250}, ErrPackAlreadyExists},
+				{"pack of another item", id, Pack{Type: item2, Size: 100}, ErrItemMismatch},
+				{"invalid rule", id, Pack{Size: 100, MinQuantity: 3, QuantityStep: 2}, ErrInvalidPackRule},
+			}
+
+			for _, tc := range cases {
+				_, err := inv.AddPack(tc.itemID, tc.pack)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+		})
+	})
+
+	t.Run("Inventory.RemovePack()", func(t *testing.T) {
+		t.Run("Should remove the pack with the size", func(t *testing.T) {
+			setup()
+
+			item, err := inv.RemovePack(id, 250)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if len(item.Packs) != 1 || item.Packs[0] != pack2 {
+				assertEqual(t, []Pack{pack2}, item.Packs)
+			}
+		})
+
+		t.Run("Should return an error for unknown packs", func(t *testing.T) {
+			setup()
+
+			if _, err := inv.RemovePack(id, 100); !errors.Is(err, ErrPackNotFound) {
+				assertEqual(t, ErrPackNotFound, err)
+			}
+		})
+
+		t.Run("Should return an error while a reservation holds the pack", func(t *testing.T) {
+			setup()
+
+			order, err := inv.CreateOrder(id, 250, true)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if _, err := inv.RemovePack(id, 250); !errors.Is(err, ErrItemInUse) {
+				assertEqual(t, ErrItemInUse, err)
+			}
+			if _, err := inv.RemovePack(id, 500); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			inv.CancelOrder(id, order.Id)
+			if _, err := inv.RemovePack(id, 250); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+	})
+}
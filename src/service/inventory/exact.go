@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"fmt"
+)
+
+// ExactFitError reports that no combination of packs adds up to Count
+// exactly. It matches ErrNoExactFit with errors.Is.
+type ExactFitError struct {
+	Count int `json:"count"`
+	// Below is the nearest count under Count that can be filled exactly,
+	// or zero when there is none.
+	Below int `json:"below"`
+	// Above is the nearest count over Count that can be filled exactly,
+	// or zero when there is none.
+	Above int `json:"above"`
+}
+
+func (e *ExactFitError) Error() string {
+	return fmt.Sprintf("%v: %d cannot be filled exactly; nearest counts are %d below and %d above", ErrNoExactFit, e.Count, e.Below, e.Above)
+}
+
+func (e *ExactFitError) Is(target error) bool {
+	return target == ErrNoExactFit
+}
+
+// details returns the nearest counts for the ErrorBody.
+func (e *ExactFitError) details() any {
+	return e
+}
+
+// solveExact returns the packs that add up to count exactly and are
+// preferred by goal. When there are none, it returns an *ExactFitError with
+// the nearest counts that can be filled exactly.
+//
+// Large counts are reduced with bulkFill like they are in solve, but one
+// bulk pack is kept in the table so that the nearest count below is always
+// in it as well.
+func solveExact(packs []Pack, count int, goal objective, trace *SolverTrace) (InventoryOrder, error) {
+	if count <= 0 {
+		return InventoryOrder{}, nil
+	}
+
+	bulk, bulkCount := bulkFill(packs, count, goal.weight)
+	bulkCount = max(0, bulkCount-1)
+	offset := bulkCount * int(bulk.Size)
+	remainder := count - offset
+
+	// The table reaches one pack beyond count to find the nearest count
+	// above it.
+	table, err := buildPackTable(packs, remainder+1, goal.weight)
+	if err != nil {
+		return InventoryOrder{}, err
+	}
+	defer table.release()
+
+	if !table.reachable(remainder) {
+		fit := &ExactFitError{Count: count}
+		if below, ok := table.shortfall(remainder); ok {
+			fit.Below = below.total + offset
+		}
+		for total := remainder + 1; total <= table.limit(); total++ {
+			if table.reachable(total) {
+				fit.Above = total + offset
+				break
+			}
+		}
+
+		if trace != nil {
+			trace.Rule = RULE_EXACT_FIT
+			trace.Candidates = []TraceCandidate{}
+		}
+		return InventoryOrder{}, fit
+	}
+
+	result := table.order(remainder)
+	if bulkCount > 0 {
+		result[bulk] += uint(bulkCount)
+	}
+
+	if trace != nil {
+		trace.Rule = RULE_EXACT_FIT
+		if bulkCount > 0 {
+			trace.Bulk = map[uint]uint{bulk.Size: uint(bulkCount)}
+		}
+		trace.Considered = 1
+		trace.Chosen = newTraceCandidate(result, count)
+		trace.Candidates = []TraceCandidate{trace.Chosen}
+	}
+
+	return result, nil
+}
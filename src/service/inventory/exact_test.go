@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExactFit(t *testing.T) {
+	t.Run("solveExact()", func(t *testing.T) {
+		t.Run("Should fill a count exactly", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{23, 31, 53}}.packs()
+
+			order, err := solveExact(packs, 100, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order.Items() != 100 {
+				assertEqual(t, 100, order.Items())
+			}
+		})
+
+		t.Run("Should prefer an exact fit over fewer packs", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{4, 10}}.packs()
+
+			// Fewest packs alone would send 1x10 for 8.
+			order, err := solveExact(packs, 8, fewestPacks, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[0]] != 2 || len(order) != 1 {
+				assertEqual(t, "2x4", order)
+			}
+		})
+
+		t.Run("Should return the nearest counts that fit exactly", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000}}.packs()
+
+			_, err := solveExact(packs, 1001, minimalOvershoot, nil)
+			if !errors.Is(err, ErrNoExactFit) {
+				assertEqual(t, ErrNoExactFit, err)
+			}
+
+			var fit *ExactFitError
+			if !errors.As(err, &fit) || fit.Below != 1000 || fit.Above != 1250 {
+				assertEqual(t, ExactFitError{Count: 1001, Below: 1000, Above: 1250}, fit)
+			}
+		})
+
+		t.Run("Should find the nearest counts for large orders", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000, 2000, 5000}}.packs()
+
+			_, err := solveExact(packs, 1000000001, minimalOvershoot, nil)
+			var fit *ExactFitError
+			if !errors.As(err, &fit) || fit.Below != 1000000000 || fit.Above != 1000000250 {
+				assertEqual(t, ExactFitError{Count: 1000000001, Below: 1000000000, Above: 1000000250}, fit)
+			}
+
+			order, err := solveExact(packs, 1000000250, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order.Items() != 1000000250 {
+				assertEqual(t, 1000000250, order.Items())
+			}
+		})
+
+		t.Run("Should not find counts that the stock cannot fill", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500}, Stock: []int{0, 1}}.packs()
+
+			_, err := solveExact(packs, 250, minimalOvershoot, nil)
+			var fit *ExactFitError
+			if !errors.As(err, &fit) || fit.Below != 0 || fit.Above != 500 {
+				assertEqual(t, ExactFitError{Count: 250, Below: 0, Above: 500}, fit)
+			}
+		})
+	})
+
+	t.Run("Inventory.ProcessOrder()", func(t *testing.T) {
+		t.Run("Should use the exact fit option", func(t *testing.T) {
+			ps := NewPackSet()
+			ps.Add(Pack{Type: item1, Size: 250})
+			ps.Add(Pack{Type: item1, Size: 500})
+			inv := Inventory{data: ItemPackMap{item1.Id.String(): *ps}}
+
+			_, err := inv.ProcessOrder(item1.Id.String(), 251, WithExactFit())
+			if !errors.Is(err, ErrNoExactFit) {
+				assertEqual(t, ErrNoExactFit, err)
+			}
+
+			// The same count is still filled with overshoot without the
+			// option.
+			result, err := inv.ProcessOrder(item1.Id.String(), 251)
+			if err != nil || result.Items() != 500 {
+				assertEqual(t, 500, result.Items())
+			}
+		})
+	})
+
+	t.Run("newErrorBody()", func(t *testing.T) {
+		t.Run("Should include the nearest counts", func(t *testing.T) {
+			body := newErrorBody(&ExactFitError{Count: 251, Below: 250, Above: 500})
+			fit, ok := body.Details.(*ExactFitError)
+			if body.Code != "no_exact_fit" || !ok || fit.Below != 250 || fit.Above != 500 {
+				assertEqual(t, "no_exact_fit with 250 below and 500 above", body)
+			}
+		})
+	})
+}
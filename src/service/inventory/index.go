@@ -10,21 +10,126 @@ package inventory
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"sync"
+	"time"
 
 	"eikcalb.dev/shark/src/constants"
 	"eikcalb.dev/shark/src/store"
+	"github.com/google/uuid"
 )
 
 type InventoryOrder map[Pack]uint
 
-type InventoryJSONFormat map[string][]Pack
+// Items returns the number of items shipped by the order.
+func (o InventoryOrder) Items() uint {
+	var items uint
+	for pack, count := range o {
+		items += pack.Size * count
+	}
+	return items
+}
+
+// Price returns the total price of the packs in the order, in the
+// price*100 convention used by Item.Price.
+func (o InventoryOrder) Price() uint64 {
+	var price uint64
+	for pack, count := range o {
+		price += packPrice(pack) * uint64(count)
+	}
+	return price
+}
+
+// PackCost is the cost of the packs of one size in an order.
+type PackCost struct {
+	// Price is the cost of a single pack.
+	Price uint64 `json:"price"`
+	// Total is the cost of every pack of this size in the order.
+	Total uint64 `json:"total"`
+}
+
+// costs maps each pack size in the order to the cost of those packs.
+func (o InventoryOrder) costs() map[uint]PackCost {
+	result := map[uint]PackCost{}
+	for pack, count := range o {
+		price := packPrice(pack)
+		result[pack.Size] = PackCost{Price: price, Total: price * uint64(count)}
+	}
+	return result
+}
+
+// bySize maps each pack size in the order to the number of packs of that
+// size.
+func (o InventoryOrder) bySize() map[uint]uint {
+	result := map[uint]uint{}
+	for pack, count := range o {
+		result[pack.Size] += count
+	}
+	return result
+}
+
+// InventoryJSONFormat is the representation of the inventory in responses,
+// with every pack holding its item. It is also how the inventory was
+// stored before the catalog existed.
+type InventoryJSONFormat map[string]PackSetJSONFormat
 
 type Inventory struct {
 	data      ItemPackMap
 	syncMutex sync.Mutex
-	storage   *store.JSONFileStore[InventoryJSONFormat]
+	// storage holds the snapshot of the inventory with storageKey.
+	storage    store.Store[string, StorageJSONFormat]
+	storageKey string
+	// itemStore holds each item under its ID when the inventory is stored
+	// with STORAGE_BACKEND_KV. Changes are saved to it instead of wal.
+	itemStore store.Store[string, StoredItem]
+	// wal records every change to the inventory as it is made. storage
+	// only holds a snapshot from the last compaction.
+	wal *store.WriteAheadLog[Mutation]
+	// sequence is the sequence of the last Mutation logged.
+	sequence uint64
+	// releaseStorage releases the lock Initialize takes on the storage.
+	releaseStorage func()
+	// background counts the compactions and snapshot prunes that are
+	// running, which Close waits for before it releases the storage.
+	background sync.WaitGroup
+
+	// storageStamp identifies the version of the storage file that the
+	// inventory last loaded, saved or rejected, so that only changes made
+	// outside the service are reloaded.
+	storageStamp  fileStamp
+	storageStatus StorageStatus
+
+	// snapshots holds the snapshots of the inventory, keyed by their ID.
+	// Snapshots are not taken when it is nil.
+	snapshots store.Store[string, Snapshot]
+	// snapshotInfos reads the same snapshots without the inventory they
+	// hold, so that they can be listed and pruned cheaply.
+	snapshotInfos  store.Store[string, SnapshotInfo]
+	snapshotPolicy SnapshotPolicy
+	// snapshotSequence is the sequence of the inventory when the last
+	// snapshot was taken.
+	snapshotSequence uint64
+
+	// items is the catalog of every item, keyed by Item.Id. The packs in
+	// data hold copies of these items.
+	items map[string]Item
+
+	// orders holds every order created, keyed by its Id.
+	orders map[uuid.UUID]*Order
+	// reserved holds the number of packs of each size that reservations
+	// have taken from the stock of each item.
+	reserved map[string]map[uint]uint
+	// reservationTTL is how long a quote or reservation lasts before it
+	// expires.
+	reservationTTL time.Duration
+	// adminToken is the token that admin requests present. Admin requests
+	// are refused when it is empty.
+	adminToken string
+	// cache holds the orders already solved for each item.
+	cache solutionCache
 }
 
 // getPacksForItemByID retrieves pascks for an Item with the ID
@@ -45,22 +150,9 @@ func (i *Inventory) lock() {
 	i.syncMutex.Lock()
 }
 
-// persist saves the inventory data for later retrieval.
-func (i *Inventory) persist() {
-	serializedData := i.serialize()
-	log.Info("Attempting to save serialized data", "data", serializedData)
-
-	err := i.storage.Save(*serializedData)
-	if err != nil {
-		log.Error("Failed to persist inventory data", "data", serializedData, "error", err)
-	}
-
-	log.Info("Successfully persisted inventory data")
-}
-
 // serialize converts inventory data to JSON format from an ItemPackMap and
-// updates the inventory.
-func (i *Inventory) serialize() *InventoryJSONFormat {
+// updates the inventory. Only the items that match filter are included.
+func (i *Inventory) serialize(filter ItemFilter) *InventoryJSONFormat {
 	log.Info("serialize data to JSON format start")
 
 	i.lock()
@@ -68,8 +160,20 @@ func (i *Inventory) serialize() *InventoryJSONFormat {
 
 	result := InventoryJSONFormat{}
 
+	// Items without packs are listed too.
+	for id, item := range i.items {
+		if filter.matches(item) {
+			result[id] = PackSetJSONFormat{Packs: []Pack{}}
+		}
+	}
 	for id, packSet := range i.data {
-		(result)[id] = packSet.getPacks()
+		if !filter.matches(i.itemOf(id)) {
+			continue
+		}
+		(result)[id] = PackSetJSONFormat{
+			Strategy: packSet.strategy,
+			Packs:    packSet.getPacks(),
+		}
 	}
 
 	log.Info("serialize data to JSON format end")
@@ -82,51 +186,210 @@ func (i *Inventory) unLock() {
 	i.syncMutex.Unlock()
 }
 
-// unserialize converts inventory data from JSON format to an ItemPackMap and
-// updates the inventory.
-func (i *Inventory) unserialize(jsonData *InventoryJSONFormat) {
+// unserialize converts inventory data from its storage format to the
+// catalog and an ItemPackMap and updates the inventory. It must be called
+// with the Inventory lock held.
+func (i *Inventory) unserialize(jsonData *StorageJSONFormat) {
 	log.Info("unserialize data from JSON format start")
 
-	i.lock()
-	defer i.unLock()
+	items, data := jsonData.catalog()
+	i.items = items
+	i.data = data
+	i.sequence = jsonData.Sequence
+
+	log.Info("unserialize data from JSON format end")
+}
 
-	clear(i.data)
-	for id, packs := range *jsonData {
-		packSet := NewPackSet()
-		for _, pack := range packs {
-			log.Info("Add new pack to inventory", "pack", pack)
-			err := packSet.Add(pack)
+// catalog converts the data to the catalog and an ItemPackMap. Entries
+// that cannot be loaded are logged and left out.
+func (f *StorageJSONFormat) catalog() (map[string]Item, ItemPackMap) {
+	items := map[string]Item{}
+	data := ItemPackMap{}
+	for id, item := range f.Items {
+		// The key is what orders and requests use to find the item.
+		if item.Id.String() != id {
+			log.Error("Item ID does not match its key, will use key", "itemID", id, "item", item)
+			itemID, err := uuid.Parse(id)
 			if err != nil {
-				log.Error("Failed to add new pack to inventory", "pack", pack, "error", err)
+				log.Error("Failed to load item with an ID that is not a UUID, will skip", "itemID", id, "error", err)
+				continue
 			}
+			item.Id = itemID
+			f.Items[id] = item
+		}
+		items[id] = item
+
+		packSet, err := f.PackSet(id)
+		if err != nil {
+			log.Error("Failed to load packs of item", "itemID", id, "error", err)
+			continue
+		}
+		data[id] = *packSet
+	}
+	for id := range f.Packs {
+		if _, ok := f.Items[id]; !ok {
+			log.Error("Packs refer to an item that is not in the catalog, will skip", "itemID", id)
 		}
-		packSet.Sort()
-		i.data[id] = *packSet
 	}
 
-	log.Info("unserialize data from JSON format end")
+	return items, data
 }
 
-func (i *Inventory) Initialize(ctx context.Context) error {
+// Initialize opens the inventory storage. The storage is locked until ctx
+// is done or the inventory is closed, so that no other process changes it
+// at the same time, and ErrStorageLocked is returned when another process
+// has it open.
+func (i *Inventory) Initialize(ctx context.Context) (err error) {
 	// Logs should be scoped to make debugging easier.
 	log = slog.Default().WithGroup("Inventory")
 
 	log.Info("Initializing service")
 
-	// The inventory data should be loaded into memory.
-	jfs := store.JSONFileStore[InventoryJSONFormat]{Path: "storage.json"}
-	jsonData, err := jfs.Load()
+	// The files are in the working directory unless other paths are given,
+	// as they are by the snapshot command.
+	storagePath := contextPath(ctx, constants.CONTEXT_STORAGE_PATH_KEY, STORAGE_PATH)
+	walPath := contextPath(ctx, constants.CONTEXT_WAL_PATH_KEY, WAL_PATH)
+	kvPath := contextPath(ctx, constants.CONTEXT_KV_STORAGE_PATH_KEY, KV_STORAGE_PATH)
+
+	backend, _ := ctx.Value(constants.CONTEXT_STORAGE_BACKEND_KEY).(string)
+	lockPath := storagePath
+	if backend == STORAGE_BACKEND_KV {
+		lockPath = kvPath
+	}
+	release, err := lockFile(lockPath + STORAGE_LOCK_SUFFIX)
+	if err != nil {
+		log.Error("Failed to lock inventory storage", "path", lockPath, "error", err)
+		return err
+	}
+	i.releaseStorage = sync.OnceFunc(release)
+	defer func() {
+		if err != nil {
+			i.releaseStorage()
+			return
+		}
+		go func() {
+			<-ctx.Done()
+			i.releaseStorage()
+		}()
+	}()
+
+	switch backend {
+	case "", STORAGE_BACKEND_JSON:
+		storage, key := StorageFile(storagePath)
+		storage.Backups = DEFAULT_STORAGE_BACKUPS
+		if backups, ok := ctx.Value(constants.CONTEXT_STORAGE_BACKUPS_KEY).(int); ok {
+			storage.Backups = backups
+		}
+
+		err = i.open(ctx, storage, key, walPath)
+	case STORAGE_BACKEND_KV:
+		err = i.openKV(ctx, kvPath, storagePath, walPath)
+	default:
+		log.Error("Failed to initialize service with unknown storage backend", "backend", backend)
+		return fmt.Errorf("%w: %q", ErrUnknownBackend, backend)
+	}
+	if err != nil {
+		return err
+	}
+
+	i.snapshotPolicy = SnapshotPolicy{
+		Interval:         DEFAULT_SNAPSHOT_INTERVAL,
+		Keep:             DEFAULT_SNAPSHOT_KEEP,
+		KeepBeforeChange: DEFAULT_SNAPSHOT_KEEP_BEFORE_CHANGE,
+		MaxAge:           DEFAULT_SNAPSHOT_MAX_AGE,
+	}
+	if interval, ok := ctx.Value(constants.CONTEXT_SNAPSHOT_INTERVAL_KEY).(time.Duration); ok {
+		i.snapshotPolicy.Interval = interval
+	}
+	if keep, ok := ctx.Value(constants.CONTEXT_SNAPSHOT_KEEP_KEY).(int); ok {
+		i.snapshotPolicy.Keep = keep
+	}
+	if keep, ok := ctx.Value(constants.CONTEXT_SNAPSHOT_KEEP_BEFORE_CHANGE_KEY).(int); ok {
+		i.snapshotPolicy.KeepBeforeChange = keep
+	}
+	if maxAge, ok := ctx.Value(constants.CONTEXT_SNAPSHOT_MAX_AGE_KEY).(time.Duration); ok {
+		i.snapshotPolicy.MaxAge = maxAge
+	}
+	return i.openSnapshots(contextPath(ctx, constants.CONTEXT_SNAPSHOT_PATH_KEY, SNAPSHOT_PATH))
+}
+
+// Close closes the inventory log or item store and releases the lock on
+// the storage taken by Initialize. The inventory must not be used after.
+func (i *Inventory) Close() error {
+	i.background.Wait()
+
+	var err error
+	if i.wal != nil {
+		err = i.wal.Close()
+	}
+	if closer, ok := i.itemStore.(io.Closer); ok {
+		err = errors.Join(err, closer.Close())
+	}
+	if i.releaseStorage != nil {
+		i.releaseStorage()
+	}
+	return err
+}
+
+// inBackground runs f in a goroutine that Close waits for.
+func (i *Inventory) inBackground(f func()) {
+	i.background.Add(1)
+	go func() {
+		defer i.background.Done()
+		f()
+	}()
+}
+
+// contextPath returns the path held in ctx under key, or fallback when
+// there is none.
+func contextPath(ctx context.Context, key constants.ServiceContextKey, fallback string) string {
+	if path, ok := ctx.Value(key).(string); ok && path != "" {
+		return path
+	}
+	return fallback
+}
+
+// open loads the inventory from the snapshot stored with key in storage
+// and the log of changes at walPath.
+func (i *Inventory) open(ctx context.Context, storage store.Store[string, StorageJSONFormat], key string, walPath string) error {
+	// The inventory data should be loaded into memory. Data stored before
+	// the catalog existed is converted as it is read.
+	jsonData, err := storage.Get(ctx, key)
 	if err != nil {
 		// Failed to load config
 		return err
 	}
 
-	i.storage = &jfs
+	i.storage = storage
+	i.storageKey = key
 	i.data = ItemPackMap{}
 	// We have the JSON data, now we populate our application data.
-	i.unserialize(jsonData)
+	i.lock()
+	i.unserialize(&jsonData)
+	// The storage file is watched for changes made from now on.
+	i.markStorage()
+	i.unLock()
 	log.Info("serialized data from JSON", "data", i.data)
 
+	// Changes made since the snapshot was saved are in the log.
+	wal, err := store.OpenWriteAheadLog[Mutation](walPath)
+	if err != nil {
+		return err
+	}
+	i.wal = wal
+	applied, err := i.replay()
+	if err != nil {
+		return err
+	}
+	log.Info("Replayed inventory log", "changes", applied, "sequence", i.sequence)
+
+	// Save the converted data so that it is only converted once, and fold
+	// the replayed changes into the snapshot.
+	if jsonData.migrated || applied > 0 {
+		log.Info("Saving inventory snapshot")
+		i.compact()
+	}
+
 	return nil
 }
 
@@ -140,117 +403,181 @@ func (i *Inventory) Run(ctx context.Context) error {
 		log.Info("Failed to retrieve port from context, will use default")
 	}
 
+	if ttl, ok := ctx.Value(constants.CONTEXT_RESERVATION_TTL_KEY).(time.Duration); ok {
+		i.reservationTTL = ttl
+	}
+	go i.runOrderExpiry(ctx)
+	go i.runCompaction(ctx, WAL_COMPACTION_INTERVAL)
+	go i.runSnapshots(ctx, i.snapshotPolicy.Interval)
+	go i.runStorageWatch(ctx, STORAGE_WATCH_INTERVAL)
+
+	if bound, ok := ctx.Value(constants.CONTEXT_SOLUTION_CACHE_BOUND_KEY).(int); ok {
+		i.cache.setBound(bound)
+	}
+	if limit, ok := ctx.Value(constants.CONTEXT_SOLUTION_CACHE_LIMIT_KEY).(int); ok {
+		i.cache.setLimit(limit)
+	}
+
+	if token, ok := ctx.Value(constants.CONTEXT_ADMIN_TOKEN_KEY).(string); ok {
+		i.adminToken = token
+	}
+
 	i.startServer(ctx, port)
 
 	return nil
 }
 
+// OrderOption changes how ProcessOrder fulfills an order.
+type OrderOption func(*orderOptions)
+
+type orderOptions struct {
+	strategy string
+	trace    *SolverTrace
+	exact    bool
+	override bool
+}
+
+// WithStrategy fulfills the order with the PackingStrategy registered with
+// name instead of the one configured for the item.
+func WithStrategy(name string) OrderOption {
+	return func(o *orderOptions) {
+		o.strategy = name
+	}
+}
+
+// WithAdminOverride fulfills the order even when the item is not for sale.
+// It is meant for internal orders, so callers must make sure the request
+// comes from an admin.
+func WithAdminOverride() OrderOption {
+	return func(o *orderOptions) {
+		o.override = true
+	}
+}
+
+// WithExactFit only fulfills the order with packs that add up to the count
+// exactly. When there are none, ProcessOrder returns an *ExactFitError.
+func WithExactFit() OrderOption {
+	return func(o *orderOptions) {
+		o.exact = true
+	}
+}
+
+// WithExplain records in trace how the packs for the order were chosen.
+func WithExplain(trace *SolverTrace) OrderOption {
+	return func(o *orderOptions) {
+		o.trace = trace
+	}
+}
+
 // ProcessOrder accepts itemID as an identifier for an item in an order
 // and count as the number of expected items in the order request. This
 // method returns a map representing the packs that can be used in
 // fulfilling the order with the Pack as its key and the frequency of each
 // Pack as its value.
 //
-// We want to return the least number of packs o fulfill the order.
-// Given the pack sizes, we will need to calculate how many packs will
-// be required to fulfill count.
+// Only whole packs can be sent, so the order may need more items than
+// requested. We want to send as few extra items as possible and, of the
+// combinations that do that, the one with the least number of packs.
+//
+// This is done by the minimal overshoot PackingStrategy, which is used by
+// default. Each item can choose another strategy, and options can
+// override it for a single order.
+//
+// Orders that cannot be processed return ErrInvalidCount for a count that
+// is not positive, ErrItemNotFound for an unknown item, ErrNoPacks for an
+// item without packs, ErrItemNotForSale for an item that is not for sale
+// unless WithAdminOverride is passed, and ErrOrderTooLarge when the count is beyond what
+// the strategy can solve. With WithExactFit, counts that no combination of
+// packs adds up to return an *ExactFitError.
 //
 // Algorithm:
-// In order to achieve this, we will iterate through the registered packs
-// in ascending order. For example:
-//   - If the order count for an item is 380.
-//   - Assuming we have packs of 100, 200, 300 and 50.
-//   - In order to efficiently handle the order, we would need to send
-//     300 and 100.
-//   - The best mental model to help understand is to imagine a truck that
-//     helps deliver goods. When the item count is specified and no single
-//     pack can represent the entire items, we use the nearest largest pack
-//     to get most of the items and then get smaller packs so the truck is
-//     not overloaded.
-//   - We will find the smallest pack that is greater than or equal to the count.
-//   - If the pack found is less than the required count, we will repeat this
-//     logic and find the next pack greater than or equal to what is left.
-//   - If there is no pack matching the criteria, then we will use the largest.
-func (i *Inventory) ProcessOrder(itemID string, count int) InventoryOrder {
-	var result = InventoryOrder{}
+// Walking the packs from the largest down gives wrong answers for sizes
+// such as 23, 31 and 53, so we solve the order exactly instead:
+//   - We build a table of every total that can be made up from the packs,
+//     from 0 up to count plus the largest pack size.
+//   - For each total, we keep the fewest packs that add up to it and the
+//     last pack added, so the combination can be rebuilt afterwards.
+//   - The first total at or above count that can be made up is the one with
+//     the least overshoot, and the table already holds its fewest packs.
+//   - If the order count is 380 and we have packs of 50, 100, 200 and 300,
+//     the first total we can make is 400 and we will send 300 and 100.
+func (i *Inventory) ProcessOrder(itemID string, count int, options ...OrderOption) (InventoryOrder, error) {
 	log.Info("Process order start", "itemID", itemID, "count", count)
 
-	// Get the PackSet referred to by itemID to fulfill the order.
+	selected := orderOptions{}
+	for _, option := range options {
+		option(&selected)
+	}
+
+	if count <= 0 {
+		log.Error("Failed to process order with invalid count", "itemID", itemID, "count", count)
+		return InventoryOrder{}, ErrInvalidCount
+	}
+
+	// Get the PackSet referred to by itemID to fulfill the order. Stock
+	// held by reservations cannot be used.
+	i.lock()
 	packs, err := i.getPacksForItemByID(itemID)
 	if err != nil {
+		i.unLock()
 		log.Error("Failed to get item pack set", "itemID", itemID, "err", err)
-		return result
-	}
-
-	// Now we will iterate the packs available and find the maximum pack to fulfill
-	// this order. When found, we will store it's index and check for smaller packs
-	// when count is less than the current pack.
-	var currentPack *Pack
-	currentIndex := 0
-	currentCount := count
-
-	packsSlice := packs.getPacks()
-	length := len(packsSlice)
-	for index, pack := range packsSlice {
-		if int(pack.Size) >= currentCount {
-			// Find first pack that is greater or equal to the current order count.
-			currentPack = &pack
-			currentIndex = index
-			log.Info("Found matching pack", "itemID", itemID, "count", currentCount, "pack", pack)
-			break
-		}
+		return InventoryOrder{}, err
+	}
+	available := i.availablePacks(itemID, packs.getPacks())
+	item := i.itemOf(itemID)
+	i.unLock()
 
-		// If we are at the end of the loop, we use the largest pack.
-		if index == length-1 {
-			currentPack = &pack
-			currentIndex = index
-			log.Info("Using largest pack", "itemID", itemID, "count", currentCount, "pack", pack)
-		}
+	if len(available) == 0 {
+		log.Error("Failed to process order for item without packs", "itemID", itemID)
+		return InventoryOrder{}, ErrNoPacks
 	}
 
-	// Prevents endless loops.
-	iterCount := 0
-	// We will continue decrementing the order count until it is less than or equal to 0.
-	for currentCount > 0 && iterCount <= MAX_UNBOUNDED_ITERATION_COUNT {
-		iterCount++
-		log.Info("Updating order remaining count", "itemID", itemID, "count", currentCount, "size", currentPack.Size)
-
-		// We need to check if the remaining orders fit into this pack or we need a
-		// smaller pack. If the current count is less than this pack and we need to find a
-		// smaller pack.
-		currentPackSize := int(currentPack.Size)
-		if currentCount >= currentPackSize {
-			// This pack can contain the items, so we subtract the current count.
-			// Deduct the current pack size from the current count.
-			currentCount -= currentPackSize
-			result[*currentPack]++
-			log.Info("Updated order remaining count", "itemID", itemID, "count", currentCount, "size", currentPackSize)
+	if !item.ForSale && !selected.override {
+		log.Error("Failed to process order for item that is not for sale", "itemID", itemID)
+		return InventoryOrder{}, ErrItemNotForSale
+	}
 
-			continue
-		}
+	if selected.strategy == "" {
+		selected.strategy = packs.Strategy()
+	}
+	strategy, err := GetStrategy(selected.strategy)
+	if err != nil {
+		log.Error("Failed to get packing strategy", "itemID", itemID, "strategy", selected.strategy, "err", err)
+		return InventoryOrder{}, err
+	}
 
-		// If the current count is less than the current pack siz then we need to check
-		// for a smaller pack or we continue using the last pack available. The PackSet
-		// returned we have is a copy of the actual PackSet making it
-		// safe to trust that the index of packs will not change for out variable.
-		//
-		// We will also check that the lowest pack has enough used only when there is no
-		// bigger pack.
-		if currentIndex > 0 && (currentIndex > 1 || int(packsSlice[0].Size) >= currentCount) {
-			// If this is not the last pack, try using the next lower pack.
-			currentIndex--
-			currentPack = &packsSlice[currentIndex]
-			log.Info("Changed pack", "itemID", itemID, "count", currentCount, "size", currentPackSize)
+	if selected.trace != nil {
+		selected.trace.Strategy = strategy.Name()
+		selected.trace.Count = count
+	}
 
-			continue
+	// Exact fits are cached apart from the orders of the strategy.
+	cacheKey := strategy.Name()
+	solver := strategy.Solve
+	if selected.exact {
+		cacheKey += "/exact"
+		goal := exactObjective(strategy)
+		solver = func(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error) {
+			return solveExact(packs, count, goal, trace)
 		}
-		// At this point, we are already at the smallest possible pack and we still have
-		// orders to fulfill, so we use what we have.
-		currentCount -= currentPackSize
-		result[*currentPack]++
 	}
 
-	// Check that the item exists.
-	log.Info("Process order success", "itemID", itemID, "count", currentCount, "result", result)
-	return result
+	// Orders that are explained are always solved so that the trace can be
+	// recorded.
+	if selected.trace == nil {
+		if result, ok := i.cache.get(itemID, cacheKey, available, count); ok {
+			log.Info("Process order success from cache", "itemID", itemID, "count", count, "strategy", strategy.Name(), "result", result)
+			return result, nil
+		}
+	}
+
+	result, err := solver(available, count, selected.trace)
+	if err != nil {
+		log.Error("Failed to solve order", "itemID", itemID, "count", count, "err", err)
+		return InventoryOrder{}, err
+	}
+	i.cache.put(itemID, cacheKey, available, count, result)
+
+	log.Info("Process order success", "itemID", itemID, "count", count, "strategy", strategy.Name(), "result", result)
+	return result, nil
 }
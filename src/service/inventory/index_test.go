@@ -1,6 +1,9 @@
 package inventory
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/google/uuid"
@@ -40,7 +43,7 @@ func TestInventory(t *testing.T) {
 		t.Run("Should return packs to fullfil an order of 251", func(t *testing.T) {
 			setup()
 
-			result := inv.ProcessOrder(item1.Id.String(), 1)
+			result, _ := inv.ProcessOrder(item1.Id.String(), 1)
 
 			if len(result) != 1 {
 				assertEqual(t, 1, len(result))
@@ -49,7 +52,7 @@ func TestInventory(t *testing.T) {
 				assertEqual(t, 1, result[pack1])
 			}
 
-			result = inv.ProcessOrder(item1.Id.String(), 251)
+			result, _ = inv.ProcessOrder(item1.Id.String(), 251)
 
 			if len(result) != 1 {
 				assertEqual(t, 1, len(result))
@@ -62,7 +65,7 @@ func TestInventory(t *testing.T) {
 		t.Run("Should return packs to fullfil an order 12001", func(t *testing.T) {
 			setup()
 
-			result := inv.ProcessOrder(item1.Id.String(), 1)
+			result, _ := inv.ProcessOrder(item1.Id.String(), 1)
 
 			if len(result) != 1 {
 				assertEqual(t, 1, len(result))
@@ -71,7 +74,7 @@ func TestInventory(t *testing.T) {
 				assertEqual(t, 1, result[pack1])
 			}
 
-			result = inv.ProcessOrder(item1.Id.String(), 12001)
+			result, _ = inv.ProcessOrder(item1.Id.String(), 12001)
 
 			if len(result) != 3 {
 				assertEqual(t, 3, len(result))
@@ -89,5 +92,101 @@ func TestInventory(t *testing.T) {
 				assertEqual(t, 1, result[pack1])
 			}
 		})
+
+		t.Run("Should use the strategy passed in the options", func(t *testing.T) {
+			setup()
+
+			// The item would be sent 1x5000 for 4999, but greedy steps
+			// down from the 5000 pack and sends 2x2000 and 2x500.
+			result, _ := inv.ProcessOrder(item1.Id.String(), 4999, WithStrategy(STRATEGY_GREEDY))
+
+			if len(result) != 2 {
+				assertEqual(t, 2, len(result))
+			}
+			if result[pack4] != 2 {
+				assertEqual(t, 2, result[pack4])
+			}
+			if result[pack2] != 2 {
+				assertEqual(t, 2, result[pack2])
+			}
+		})
+
+		t.Run("Should return an error for orders that cannot be processed", func(t *testing.T) {
+			setup()
+			inv.data[item2.Id.String()] = *NewPackSet()
+
+			// Pack sizes that share no factors leave too much to solve
+			// exactly once the largest packs are set aside.
+			coprime := NewPackSet()
+			coprime.Add(Pack{Type: item2, Size: 999983})
+			coprime.Add(Pack{Type: item2, Size: 1000003})
+			inv.data["coprime"] = *coprime
+
+			cases := []struct {
+				name    string
+				itemID  string
+				count   int
+				options []OrderOption
+				err     error
+			}{
+				{"unknown item", "unknown", 10, nil, ErrItemNotFound},
+				{"zero count", item1.Id.String(), 0, nil, ErrInvalidCount},
+				{"negative count", item1.Id.String(), -5, nil, ErrInvalidCount},
+				{"empty pack set", item2.Id.String(), 10, nil, ErrNoPacks},
+				{"count over the solver budget", "coprime", 1000000000, nil, ErrOrderTooLarge},
+			}
+
+			for _, tc := range cases {
+				result, err := inv.ProcessOrder(tc.itemID, tc.count, tc.options...)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+				if len(result) != 0 {
+					t.Fatalf("%s: expected an empty order; got: %+v", tc.name, result)
+				}
+			}
+		})
+	})
+
+	t.Run("Inventory.ProcessOrder() for items not for sale", func(t *testing.T) {
+		t.Run("Should refuse orders unless an admin overrides it", func(t *testing.T) {
+			setup()
+			hidden := item1
+			hidden.ForSale = false
+			inv.items = map[string]Item{item1.Id.String(): hidden}
+			defer func() { inv.items = nil }()
+
+			_, err := inv.ProcessOrder(item1.Id.String(), 250)
+			if !errors.Is(err, ErrItemNotForSale) {
+				assertEqual(t, ErrItemNotForSale, err)
+			}
+
+			result, err := inv.ProcessOrder(item1.Id.String(), 250, WithAdminOverride())
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if result[pack1] != 1 {
+				assertEqual(t, 1, result[pack1])
+			}
+		})
+	})
+
+	t.Run("newErrorBody()", func(t *testing.T) {
+		t.Run("Should map errors to a status and code", func(t *testing.T) {
+			body := newErrorBody(ErrItemNotFound)
+			if body.status != http.StatusNotFound || body.Code != "item_not_found" {
+				assertEqual(t, "404 item_not_found", body)
+			}
+
+			body = newErrorBody(fmt.Errorf("wrapped: %w", ErrInvalidCount))
+			if body.status != http.StatusUnprocessableEntity || body.Code != "invalid_count" {
+				assertEqual(t, "422 invalid_count", body)
+			}
+
+			body = newErrorBody(errors.New("unexpected"))
+			if body.status != http.StatusInternalServerError {
+				assertEqual(t, http.StatusInternalServerError, body.status)
+			}
+		})
 	})
 }
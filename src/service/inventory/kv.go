@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+// StoredItem is the representation of an item and its packs in a store
+// that holds each item under its ID.
+type StoredItem struct {
+	Item Item `json:"item"`
+	// Packs is nil when the item has no pack set.
+	Packs *StoredPackSet `json:"packs,omitempty"`
+}
+
+// openKV loads the inventory from the key-value store in dir. When the
+// store does not exist yet, it is filled from the snapshot at storagePath
+// and the log at walPath of the JSON backend when they exist, so switching
+// backends keeps the catalog.
+func (i *Inventory) openKV(ctx context.Context, dir string, storagePath string, walPath string) error {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(storagePath); err == nil {
+			if err := importKV(ctx, dir, storagePath, walPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	items, err := store.OpenKVStore[string, StoredItem](dir, store.KVOptions{})
+	if err != nil {
+		log.Error("Failed to open inventory store", "dir", dir, "error", err)
+		return err
+	}
+
+	return i.openItems(ctx, items)
+}
+
+// importKV creates the key-value store in dir from the snapshot at
+// storagePath and the log at walPath. The store is filled in a directory
+// named with KV_IMPORT_SUFFIX and only renamed to dir once every item is
+// saved, so an import cut short by a crash is started over instead of
+// leaving a partial catalog.
+func importKV(ctx context.Context, dir string, storagePath string, walPath string) error {
+	storage, key := StorageFile(storagePath)
+	stored, err := ReadStorage(ctx, storage, key, walPath)
+	if err != nil {
+		return err
+	}
+
+	importDir := dir + KV_IMPORT_SUFFIX
+	if err := os.RemoveAll(importDir); err != nil {
+		return err
+	}
+	items, err := store.OpenKVStore[string, StoredItem](importDir, store.KVOptions{})
+	if err != nil {
+		log.Error("Failed to open inventory store", "dir", importDir, "error", err)
+		return err
+	}
+	if err := importStorage(ctx, items, stored); err != nil {
+		items.Close()
+		return err
+	}
+	if err := items.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(importDir, dir)
+}
+
+// openItems loads the inventory from items, which holds each item under
+// its ID. Every change is saved to items from then on.
+func (i *Inventory) openItems(ctx context.Context, items store.Store[string, StoredItem]) error {
+	stored, err := ReadItems(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	i.itemStore = items
+	i.data = ItemPackMap{}
+	i.lock()
+	i.unserialize(stored)
+	i.unLock()
+	log.Info("Loaded inventory from item store", "items", len(stored.Items))
+
+	return nil
+}
+
+// importStorage saves every item in stored to items.
+func importStorage(ctx context.Context, items store.Store[string, StoredItem], stored *StorageJSONFormat) error {
+	log.Info("Import inventory storage start", "items", len(stored.Items))
+
+	for id, item := range stored.Items {
+		record := StoredItem{Item: item}
+		if packSet, ok := stored.Packs[id]; ok {
+			record.Packs = &packSet
+		}
+		if err := items.Set(ctx, id, record); err != nil {
+			log.Error("Failed to import inventory storage", "itemID", id, "error", err)
+			return err
+		}
+	}
+
+	log.Info("Import inventory storage success", "items", len(stored.Items))
+	return nil
+}
+
+// storeMutation saves the item as recorded in mutation to the item store.
+func (i *Inventory) storeMutation(mutation Mutation) error {
+	ctx := context.Background()
+	if mutation.Item == nil {
+		err := i.itemStore.Delete(ctx, mutation.ItemID)
+		if errors.Is(err, store.ErrNotFound) {
+			// The item was never saved, so there is nothing to remove.
+			return nil
+		}
+		return err
+	}
+
+	return i.itemStore.Set(ctx, mutation.ItemID, StoredItem{Item: *mutation.Item, Packs: mutation.Packs})
+}
+
+// storeStorage saves every item in stored to the item store and removes
+// the items in previous that stored does not hold.
+func (i *Inventory) storeStorage(stored *StorageJSONFormat, previous *StorageJSONFormat) error {
+	ctx := context.Background()
+	for id := range previous.Items {
+		if _, ok := stored.Items[id]; ok {
+			continue
+		}
+		if err := i.itemStore.Delete(ctx, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+
+	return importStorage(ctx, i.itemStore, stored)
+}
+
+// ReadItems reads the inventory from items, which holds each item under
+// its ID, into its storage format. Nothing is changed.
+func ReadItems(ctx context.Context, items store.Store[string, StoredItem]) (*StorageJSONFormat, error) {
+	values, err := items.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StorageJSONFormat{
+		Items: map[string]Item{},
+		Packs: map[string]StoredPackSet{},
+	}
+	for id, value := range values {
+		stored.Items[id] = value.Item
+		if value.Packs != nil {
+			stored.Packs[id] = *value.Packs
+		}
+	}
+	return stored, nil
+}
@@ -0,0 +1,138 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+func TestItemStore(t *testing.T) {
+	var (
+		id  = item1.Id.String()
+		id2 = item2.Id.String()
+	)
+
+	// setup opens an inventory in a new key-value store.
+	setup := func(t *testing.T, dir string) (*Inventory, *store.KVStore[string, StoredItem]) {
+		items, err := store.OpenKVStore[string, StoredItem](dir, store.KVOptions{})
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+		}
+		t.Cleanup(func() { items.Close() })
+
+		inv := &Inventory{}
+		if err := inv.openItems(context.Background(), items); err != nil {
+			t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+		}
+		return inv, items
+	}
+
+	t.Run("Inventory.openItems()", func(t *testing.T) {
+		t.Run("Should load every change saved before", func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "storage.db")
+			inv, items := setup(t, dir)
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.AddPack(id, Pack{Size: 500, TrackStock: true, Stock: 3})
+			inv.SetPacks(id2, PackSetJSONFormat{Packs: []Pack{{Type: item2, Size: 10}}})
+			inv.DeleteItem(id2)
+			order, _ := inv.CreateOrder(id, 500, true)
+			if _, err := inv.CommitOrder(id, order.Id); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			expected, _ := inv.GetItem(id)
+			items.Close()
+
+			reopened, _ := setup(t, dir)
+			item, err := reopened.GetItem(id)
+			if err != nil || item.Item != expected.Item || len(item.Packs) != 2 || item.Packs[1].Stock != 2 {
+				assertEqual(t, expected, item)
+			}
+			if _, err := reopened.GetItem(id2); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+
+		t.Run("Should save each item under its ID", func(t *testing.T) {
+			items := store.NewMemoryStore[string, StoredItem](nil)
+			inv := &Inventory{}
+			inv.openItems(context.Background(), items)
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.CreateItem(item2, PackSetJSONFormat{})
+
+			stored, _ := items.List(context.Background())
+			if len(stored) != 2 || stored[id].Item != item1 || len(stored[id].Packs.Packs) != 1 || stored[id2].Item != item2 {
+				assertEqual(t, "item1 and item2", stored)
+			}
+		})
+	})
+
+	t.Run("importStorage()", func(t *testing.T) {
+		t.Run("Should copy every item and its packs", func(t *testing.T) {
+			packSet, _ := NewPackSetFromJSON(PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			stored := newStorageJSONFormat(map[string]Item{id: item1, id2: item2}, ItemPackMap{id: *packSet})
+			items := store.NewMemoryStore[string, StoredItem](nil)
+			if err := importStorage(context.Background(), items, &stored); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			read, _ := ReadItems(context.Background(), items)
+			if len(read.Items) != 2 || len(read.Packs) != 1 || read.Packs[id].Packs[0].Size != 250 {
+				assertEqual(t, stored, read)
+			}
+		})
+	})
+
+	t.Run("importKV()", func(t *testing.T) {
+		t.Run("Should start over an import that did not finish", func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			storagePath := filepath.Join(dir, "storage.json")
+			packSet, _ := NewPackSetFromJSON(PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			storage, key := StorageFile(storagePath)
+			storage.Set(ctx, key, newStorageJSONFormat(map[string]Item{id: item1, id2: item2}, ItemPackMap{id: *packSet}))
+
+			// An import that stopped after the first item.
+			kvPath := filepath.Join(dir, "storage.db")
+			partial, _ := store.OpenKVStore[string, StoredItem](kvPath+KV_IMPORT_SUFFIX, store.KVOptions{})
+			partial.Set(ctx, id2, StoredItem{Item: item2, Packs: &StoredPackSet{Packs: []StoredPack{{Size: 10}}}})
+			partial.Close()
+
+			if err := importKV(ctx, kvPath, storagePath, filepath.Join(dir, "storage.wal")); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			items, err := store.OpenKVStore[string, StoredItem](kvPath, store.KVOptions{ReadOnly: true})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			defer items.Close()
+			read, _ := ReadItems(ctx, items)
+			if len(read.Items) != 2 || len(read.Packs) != 1 || read.Packs[id].Packs[0].Size != 250 {
+				assertEqual(t, "item1 with 1 pack and item2", read)
+			}
+			if _, err := os.Stat(kvPath + KV_IMPORT_SUFFIX); !errors.Is(err, os.ErrNotExist) {
+				assertEqual(t, os.ErrNotExist, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.storeMutation()", func(t *testing.T) {
+		t.Run("Should undo changes that cannot be saved", func(t *testing.T) {
+			inv, items := setup(t, t.TempDir())
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			items.Close()
+
+			if _, err := inv.AddPack(id, Pack{Size: 500}); !errors.Is(err, ErrPersistFailed) {
+				assertEqual(t, ErrPersistFailed, err)
+			}
+			if item, _ := inv.GetItem(id); len(item.Packs) != 1 {
+				assertEqual(t, 1, len(item.Packs))
+			}
+		})
+	})
+}
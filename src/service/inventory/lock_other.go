@@ -0,0 +1,28 @@
+//go:build !unix
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// lockFile creates the file at path to lock it and returns the function
+// that releases it by removing the file. It returns ErrStorageLocked when
+// the file exists. A file left by a process that did not exit cleanly has
+// to be removed by hand.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, STORAGE_LOCK_MODE)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", ErrStorageLocked, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		file.Close()
+		os.Remove(path)
+	}, nil
+}
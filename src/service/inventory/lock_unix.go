@@ -0,0 +1,31 @@
+//go:build unix
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file at path, creating it when it
+// does not exist, and returns the function that releases it. It returns
+// ErrStorageLocked when another process holds the lock. The lock is also
+// released when the process exits.
+func lockFile(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, STORAGE_LOCK_MODE)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: %s", ErrStorageLocked, path)
+		}
+		return nil, err
+	}
+
+	return func() { file.Close() }, nil
+}
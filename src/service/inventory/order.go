@@ -0,0 +1,325 @@
+package inventory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrderState is a stage in the lifecycle of an Order.
+//
+// An order starts as a quote. Reserving a quote holds its packs so that
+// no other order can take them, and committing a reservation takes the
+// packs out of stock. A quote or reservation can be cancelled, and one
+// that is left alone for longer than the reservation TTL expires.
+type OrderState string
+
+const (
+	ORDER_STATE_QUOTE     OrderState = "quote"
+	ORDER_STATE_RESERVED  OrderState = "reserved"
+	ORDER_STATE_COMMITTED OrderState = "committed"
+	ORDER_STATE_CANCELLED OrderState = "cancelled"
+	ORDER_STATE_EXPIRED   OrderState = "expired"
+)
+
+// Order is a request for a number of items that moves through the states
+// described by OrderState.
+type Order struct {
+	// Id is a unique representation of this order.
+	Id uuid.UUID `json:"id"`
+	// ItemID identifies the item that is ordered.
+	ItemID string `json:"itemId"`
+	// Count is the number of items requested.
+	Count int `json:"count"`
+	// Packs maps each pack size used to fulfill the order to the number
+	// of packs of that size.
+	Packs map[uint]uint `json:"packs"`
+	// Items is the number of items the packs hold.
+	Items uint `json:"items"`
+	// Price is the cost of the packs in the price*100 convention.
+	Price uint64 `json:"price"`
+	// Partial indicates that the packs in stock could not cover Count, so
+	// the order only holds the items in stock.
+	Partial bool `json:"partial"`
+	// State is the current stage of the order.
+	State OrderState `json:"state"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// ExpiresAt is when an order that is not committed or cancelled
+	// will expire.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// isOpen reports whether the order can still move to another state.
+func (o *Order) isOpen() bool {
+	return o.State == ORDER_STATE_QUOTE || o.State == ORDER_STATE_RESERVED
+}
+
+// transition moves the order to state.
+func (o *Order) transition(state OrderState, now time.Time) {
+	log.Info("Order state changed", "orderID", o.Id, "from", o.State, "to", state)
+
+	o.State = state
+	o.UpdatedAt = now
+}
+
+// holdStock reserves the packs of order for the item, or returns
+// ErrInsufficientStock when any pack does not have enough available stock.
+// It must be called with the Inventory lock held.
+func (i *Inventory) holdStock(order *Order) error {
+	packSet, ok := i.data[order.ItemID]
+	if !ok {
+		return ErrItemNotFound
+	}
+
+	held := i.reserved[order.ItemID]
+	for _, pack := range packSet.getPacks() {
+		if pack.TrackStock && held[pack.Size]+order.Packs[pack.Size] > pack.Stock {
+			return ErrInsufficientStock
+		}
+	}
+
+	if i.reserved == nil {
+		i.reserved = map[string]map[uint]uint{}
+	}
+	if held == nil {
+		held = map[uint]uint{}
+		i.reserved[order.ItemID] = held
+	}
+	for size, count := range order.Packs {
+		held[size] += count
+	}
+
+	return nil
+}
+
+// releaseStock returns the packs held for order. It must be called with
+// the Inventory lock held.
+func (i *Inventory) releaseStock(order *Order) {
+	held := i.reserved[order.ItemID]
+	for size, count := range order.Packs {
+		held[size] -= min(held[size], count)
+		if held[size] == 0 {
+			delete(held, size)
+		}
+	}
+}
+
+// availablePacks returns a copy of packs with the stock held by
+// reservations taken away. It must be called with the Inventory lock held.
+func (i *Inventory) availablePacks(itemID string, packs []Pack) []Pack {
+	held := i.reserved[itemID]
+
+	available := make([]Pack, 0, len(packs))
+	for _, pack := range packs {
+		if pack.TrackStock {
+			pack.Stock -= min(pack.Stock, held[pack.Size])
+		}
+		available = append(available, pack)
+	}
+
+	return available
+}
+
+// findOrder returns the order with orderID for the item with itemID. It
+// must be called with the Inventory lock held.
+func (i *Inventory) findOrder(itemID string, orderID uuid.UUID) (*Order, error) {
+	order, ok := i.orders[orderID]
+	if !ok || order.ItemID != itemID {
+		return nil, ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// CreateOrder quotes an order of count items for the item with itemID.
+// When reserve is set, the packs of the quote are also reserved.
+func (i *Inventory) CreateOrder(itemID string, count int, reserve bool, options ...OrderOption) (Order, error) {
+	log.Info("Create order start", "itemID", itemID, "count", count, "reserve", reserve)
+
+	packsOrder, err := i.ProcessOrder(itemID, count, options...)
+	if err != nil {
+		return Order{}, err
+	}
+
+	now := time.Now()
+	order := &Order{
+		Id:        uuid.New(),
+		ItemID:    itemID,
+		Count:     count,
+		Packs:     packsOrder.bySize(),
+		Items:     packsOrder.Items(),
+		Price:     packsOrder.Price(),
+		Partial:   packsOrder.Items() < uint(count),
+		State:     ORDER_STATE_QUOTE,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(i.orderTTL()),
+	}
+
+	i.lock()
+	defer i.unLock()
+
+	if reserve {
+		if err := i.holdStock(order); err != nil {
+			log.Error("Failed to reserve order", "orderID", order.Id, "error", err)
+			return Order{}, err
+		}
+		order.transition(ORDER_STATE_RESERVED, now)
+	}
+
+	if i.orders == nil {
+		i.orders = map[uuid.UUID]*Order{}
+	}
+	i.orders[order.Id] = order
+
+	log.Info("Create order success", "order", order)
+	return *order, nil
+}
+
+// GetOrder returns the order with orderID for the item with itemID.
+func (i *Inventory) GetOrder(itemID string, orderID uuid.UUID) (Order, error) {
+	i.lock()
+	defer i.unLock()
+
+	order, err := i.findOrder(itemID, orderID)
+	if err != nil {
+		return Order{}, err
+	}
+
+	return *order, nil
+}
+
+// ReserveOrder holds the packs of a quote so that no other order can take
+// them. If the stock available has changed since the quote was made and
+// can no longer cover it, ErrInsufficientStock is returned.
+func (i *Inventory) ReserveOrder(itemID string, orderID uuid.UUID) (Order, error) {
+	i.lock()
+	defer i.unLock()
+
+	order, err := i.findOrder(itemID, orderID)
+	if err != nil {
+		return Order{}, err
+	}
+	if order.State != ORDER_STATE_QUOTE {
+		return *order, ErrInvalidOrderTransition
+	}
+
+	if err := i.holdStock(order); err != nil {
+		return *order, err
+	}
+
+	now := time.Now()
+	order.ExpiresAt = now.Add(i.orderTTL())
+	order.transition(ORDER_STATE_RESERVED, now)
+
+	return *order, nil
+}
+
+// CommitOrder takes the packs of a reservation out of stock. The new stock
+// levels are logged before it returns.
+func (i *Inventory) CommitOrder(itemID string, orderID uuid.UUID) (Order, error) {
+	i.lock()
+	defer i.unLock()
+
+	order, err := i.findOrder(itemID, orderID)
+	if err != nil {
+		return Order{}, err
+	}
+	if order.State != ORDER_STATE_RESERVED {
+		return *order, ErrInvalidOrderTransition
+	}
+
+	before := i.itemState(itemID)
+	if before.hasPacks {
+		packSet := clonePackSet(before.packSet)
+		for size, count := range order.Packs {
+			if err := packSet.takeStock(size, count); err != nil {
+				// The pack was replaced after the order was reserved, so
+				// there is no stock left to take.
+				log.Error("Failed to take pack out of stock", "orderID", order.Id, "size", size, "error", err)
+			}
+		}
+		i.data[itemID] = packSet
+		if err := i.logMutation(MUTATION_STOCK_CHANGED, itemID, before); err != nil {
+			// The order stays reserved so that it can be committed again.
+			return *order, err
+		}
+	}
+	i.releaseStock(order)
+	order.transition(ORDER_STATE_COMMITTED, time.Now())
+
+	return *order, nil
+}
+
+// CancelOrder cancels a quote or reservation and returns any packs it held.
+func (i *Inventory) CancelOrder(itemID string, orderID uuid.UUID) (Order, error) {
+	i.lock()
+	defer i.unLock()
+
+	order, err := i.findOrder(itemID, orderID)
+	if err != nil {
+		return Order{}, err
+	}
+	if !order.isOpen() {
+		return *order, ErrInvalidOrderTransition
+	}
+
+	if order.State == ORDER_STATE_RESERVED {
+		i.releaseStock(order)
+	}
+	order.transition(ORDER_STATE_CANCELLED, time.Now())
+
+	return *order, nil
+}
+
+// expireOrders expires every quote and reservation that has outlived its
+// TTL at now and returns any packs they held. Orders that were committed,
+// cancelled or expired for longer than ORDER_RETENTION are dropped, so
+// they are no longer found.
+func (i *Inventory) expireOrders(now time.Time) {
+	i.lock()
+	defer i.unLock()
+
+	for id, order := range i.orders {
+		if !order.isOpen() {
+			if now.Sub(order.UpdatedAt) >= ORDER_RETENTION {
+				delete(i.orders, id)
+			}
+			continue
+		}
+		if now.Before(order.ExpiresAt) {
+			continue
+		}
+
+		if order.State == ORDER_STATE_RESERVED {
+			i.releaseStock(order)
+		}
+		order.transition(ORDER_STATE_EXPIRED, now)
+	}
+}
+
+// runOrderExpiry expires orders in the background until ctx is done.
+func (i *Inventory) runOrderExpiry(ctx context.Context) {
+	ticker := time.NewTicker(ORDER_EXPIRY_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			i.expireOrders(now)
+		}
+	}
+}
+
+// orderTTL returns how long a quote or reservation lasts before it expires.
+func (i *Inventory) orderTTL() time.Duration {
+	if i.reservationTTL <= 0 {
+		return DEFAULT_RESERVATION_TTL
+	}
+	return i.reservationTTL
+}
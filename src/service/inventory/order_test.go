@@ -0,0 +1,200 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOrder(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250, TrackStock: true, Stock: 2}
+		pack2 = Pack{Type: item1, Size: 500}
+		id    = item1.Id.String()
+
+		inv = Inventory{}
+	)
+
+	setup := func() {
+		ps := NewPackSet()
+		ps.Add(pack1)
+		ps.Add(pack2)
+
+		inv = Inventory{}
+		inv.data = ItemPackMap{}
+		inv.data[id] = *ps
+	}
+
+	stockOf := func(size uint) uint {
+		for _, pack := range inv.availablePacks(id, inv.data[id].values) {
+			if pack.Size == size {
+				return pack.Stock
+			}
+		}
+		return 0
+	}
+
+	t.Run("Inventory.CreateOrder()", func(t *testing.T) {
+		t.Run("Should create a quote without holding stock", func(t *testing.T) {
+			setup()
+
+			order, err := inv.CreateOrder(id, 250, false)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order.State != ORDER_STATE_QUOTE {
+				assertEqual(t, ORDER_STATE_QUOTE, order.State)
+			}
+			if stockOf(250) != 2 {
+				assertEqual(t, 2, stockOf(250))
+			}
+		})
+
+		t.Run("Should hold stock when reserving", func(t *testing.T) {
+			setup()
+
+			order, err := inv.CreateOrder(id, 250, true)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order.State != ORDER_STATE_RESERVED {
+				assertEqual(t, ORDER_STATE_RESERVED, order.State)
+			}
+			if stockOf(250) != 1 {
+				assertEqual(t, 1, stockOf(250))
+			}
+		})
+
+		t.Run("Should flag an order the stock cannot cover", func(t *testing.T) {
+			setup()
+			ps := NewPackSet()
+			ps.Add(pack1)
+			inv.data[id] = *ps
+
+			if full, _ := inv.CreateOrder(id, 100, false); full.Partial {
+				assertEqual(t, false, full.Partial)
+			}
+			order, err := inv.CreateOrder(id, 1000, true)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if !order.Partial || order.Items != 500 {
+				assertEqual(t, "partial order of 500 items", order)
+			}
+		})
+
+		t.Run("Should not create an order for an unknown item", func(t *testing.T) {
+			setup()
+
+			_, err := inv.CreateOrder(item2.Id.String(), 250, false)
+			if !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.ReserveOrder()", func(t *testing.T) {
+		t.Run("Should not reserve more stock than is available", func(t *testing.T) {
+			setup()
+
+			quote, _ := inv.CreateOrder(id, 250, false)
+			inv.CreateOrder(id, 250, true)
+			inv.CreateOrder(id, 250, true)
+
+			_, err := inv.ReserveOrder(id, quote.Id)
+			if !errors.Is(err, ErrInsufficientStock) {
+				assertEqual(t, ErrInsufficientStock, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.CommitOrder()", func(t *testing.T) {
+		t.Run("Should take reserved packs out of stock", func(t *testing.T) {
+			setup()
+
+			order, _ := inv.CreateOrder(id, 250, true)
+			committed, err := inv.CommitOrder(id, order.Id)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if committed.State != ORDER_STATE_COMMITTED {
+				assertEqual(t, ORDER_STATE_COMMITTED, committed.State)
+			}
+			if inv.data[id].values[0].Stock != 1 {
+				assertEqual(t, 1, inv.data[id].values[0].Stock)
+			}
+			if stockOf(250) != 1 {
+				assertEqual(t, 1, stockOf(250))
+			}
+		})
+
+		t.Run("Should not commit a quote", func(t *testing.T) {
+			setup()
+
+			order, _ := inv.CreateOrder(id, 250, false)
+			_, err := inv.CommitOrder(id, order.Id)
+			if !errors.Is(err, ErrInvalidOrderTransition) {
+				assertEqual(t, ErrInvalidOrderTransition, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.CancelOrder()", func(t *testing.T) {
+		t.Run("Should return held stock", func(t *testing.T) {
+			setup()
+
+			order, _ := inv.CreateOrder(id, 250, true)
+			_, err := inv.CancelOrder(id, order.Id)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if stockOf(250) != 2 {
+				assertEqual(t, 2, stockOf(250))
+			}
+		})
+	})
+
+	t.Run("Inventory.expireOrders()", func(t *testing.T) {
+		t.Run("Should expire reservations after the TTL", func(t *testing.T) {
+			setup()
+			inv.reservationTTL = time.Minute
+
+			order, _ := inv.CreateOrder(id, 250, true)
+
+			inv.expireOrders(time.Now())
+			if current, _ := inv.GetOrder(id, order.Id); current.State != ORDER_STATE_RESERVED {
+				assertEqual(t, ORDER_STATE_RESERVED, current.State)
+			}
+
+			inv.expireOrders(time.Now().Add(2 * time.Minute))
+			if current, _ := inv.GetOrder(id, order.Id); current.State != ORDER_STATE_EXPIRED {
+				assertEqual(t, ORDER_STATE_EXPIRED, current.State)
+			}
+			if stockOf(250) != 2 {
+				assertEqual(t, 2, stockOf(250))
+			}
+		})
+
+		t.Run("Should drop finished orders after the retention period", func(t *testing.T) {
+			setup()
+			committed, _ := inv.CreateOrder(id, 250, true)
+			inv.CommitOrder(id, committed.Id)
+			open, _ := inv.CreateOrder(id, 500, false)
+
+			inv.expireOrders(time.Now().Add(ORDER_RETENTION / 2))
+			if _, err := inv.GetOrder(id, committed.Id); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			inv.expireOrders(time.Now().Add(ORDER_RETENTION))
+			if _, err := inv.GetOrder(id, committed.Id); !errors.Is(err, ErrOrderNotFound) {
+				assertEqual(t, ErrOrderNotFound, err)
+			}
+			// The quote expired during the first pass and is kept until
+			// its own retention period ends.
+			if current, err := inv.GetOrder(id, open.Id); err != nil || current.State != ORDER_STATE_EXPIRED {
+				assertEqual(t, ORDER_STATE_EXPIRED, current.State)
+			}
+		})
+	})
+}
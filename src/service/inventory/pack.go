@@ -1,6 +1,10 @@
 package inventory
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
 	"slices"
 
 	"github.com/google/uuid"
@@ -28,6 +32,101 @@ type Pack struct {
 	// Size represents the number of items identified by Type
 	// that are present in the pack.
 	Size uint `json:"size"`
+	// Price is the cost of the whole pack in the price*100 convention
+	// used by Item.Price. It allows packs to be discounted for bulk. When
+	// it is zero, the pack costs Size times the price of its Item.
+	Price uint64 `json:"price,omitempty"`
+
+	// Weight is the weight of the whole pack in grams. Zero means the
+	// weight is not known and is not counted towards shipping limits.
+	Weight uint `json:"weight,omitempty"`
+	// Volume is the volume of the whole pack in cubic centimetres. Zero
+	// means the volume is not known and is not counted towards shipping
+	// limits.
+	Volume uint `json:"volume,omitempty"`
+
+	// TrackStock indicates whether Stock limits the number of these
+	// packs that can be sent. Packs that do not track stock have an
+	// unlimited supply.
+	TrackStock bool `json:"trackStock,omitempty"`
+	// Stock is the number of these packs on hand.
+	Stock uint `json:"stock,omitempty"`
+
+	// MinQuantity is the fewest of these packs an order can hold when it
+	// holds any. Zero means there is no minimum.
+	MinQuantity uint `json:"minQuantity,omitempty"`
+	// MaxQuantity is the most of these packs an order can hold. Zero means
+	// there is no maximum.
+	MaxQuantity uint `json:"maxQuantity,omitempty"`
+	// QuantityStep makes orders hold these packs in multiples of it. Zero
+	// means any number of packs can be ordered.
+	QuantityStep uint `json:"quantityStep,omitempty"`
+}
+
+// packKey identifies a Pack within a PackSet regardless of its stock.
+type packKey struct {
+	Type Item
+	Size uint
+}
+
+// key returns the identity of the pack.
+func (p Pack) key() packKey {
+	return packKey{Type: p.Type, Size: p.Size}
+}
+
+// InStock reports whether at least one of these packs can be sent.
+func (p Pack) InStock() bool {
+	return !p.TrackStock || p.Stock > 0
+}
+
+// step returns the number of packs that an order must hold a multiple of.
+func (p Pack) step() uint {
+	return max(p.QuantityStep, 1)
+}
+
+// quantityRange returns the fewest and the most of these packs an order can
+// hold when it holds any, following the quantity rules and the stock of the
+// pack. Both are multiples of the step, and ok is false when no quantity is
+// allowed.
+func (p Pack) quantityRange() (least uint, most uint, ok bool) {
+	step := p.step()
+	least = (max(p.MinQuantity, 1) + step - 1) / step * step
+
+	most = math.MaxUint
+	if p.MaxQuantity > 0 {
+		most = p.MaxQuantity
+	}
+	if p.TrackStock {
+		most = min(most, p.Stock)
+	}
+	most = most / step * step
+
+	return least, most, p.Size > 0 && least <= most
+}
+
+// hasRules reports whether the pack limits the quantity an order can hold
+// by more than its stock.
+func (p Pack) hasRules() bool {
+	return p.MinQuantity > 1 || p.MaxQuantity > 0 || p.QuantityStep > 1
+}
+
+// validateRules returns ErrInvalidPackRule when the quantity rules of the
+// pack contradict each other.
+func (p Pack) validateRules() error {
+	step := p.step()
+	if p.MinQuantity%step != 0 {
+		return fmt.Errorf("%w: minQuantity %d of the %d pack is not a multiple of quantityStep %d", ErrInvalidPackRule, p.MinQuantity, p.Size, step)
+	}
+	if p.MaxQuantity > 0 {
+		if p.MaxQuantity%step != 0 {
+			return fmt.Errorf("%w: maxQuantity %d of the %d pack is not a multiple of quantityStep %d", ErrInvalidPackRule, p.MaxQuantity, p.Size, step)
+		}
+		if p.MaxQuantity < p.MinQuantity {
+			return fmt.Errorf("%w: maxQuantity %d of the %d pack is less than minQuantity %d", ErrInvalidPackRule, p.MaxQuantity, p.Size, p.MinQuantity)
+		}
+	}
+
+	return nil
 }
 
 // PackSet is a collection of Pack structs that ensures its content
@@ -35,12 +134,15 @@ type Pack struct {
 // and Size.
 type PackSet struct {
 	// keys represents the keys
-	keys map[Pack]bool
+	keys map[packKey]bool
 	// values is the underlying data structure to store Pack instances.
 	// The traditional map[Pack]bool interface, common in golang,
 	// cannot be used because it introduces extra complexity in
 	// sorting the Pack instances.
 	values []Pack
+	// strategy is the name of the PackingStrategy used to fulfill
+	// orders from this set. An empty name uses the default strategy.
+	strategy string
 }
 
 // getPacks returns a copy of the values in this set. This is a slice of
@@ -49,10 +151,14 @@ func (ps *PackSet) getPacks() []Pack {
 	return ps.values
 }
 
-// Add accepts a Pack and throws an error if the pack already exists.
-// Otherwise it inserts pack to the PackSet collection.
+// Add accepts a Pack and throws an error if the pack already exists or its
+// quantity rules are not valid. Otherwise it inserts pack to the PackSet
+// collection.
 func (ps *PackSet) Add(pack Pack) error {
-	if exists := ps.keys[pack]; exists {
+	if err := pack.validateRules(); err != nil {
+		return err
+	}
+	if exists := ps.keys[pack.key()]; exists {
 		// The pack already exists. We will not keep quiet about this.
 		// All values in a set should be unique.
 		return ErrPackAlreadyExists
@@ -60,7 +166,7 @@ func (ps *PackSet) Add(pack Pack) error {
 
 	// We want to keep track of the keys to enforce uniqueness and also
 	// track the slice containing packs.
-	ps.keys[pack] = true
+	ps.keys[pack.key()] = true
 	ps.values = append(ps.values, pack)
 
 	log.Info("Added new pack to set", "newEntry", pack, "set", ps.values)
@@ -73,8 +179,11 @@ func (ps *PackSet) Remove(pack Pack) error {
 	// the index of each pack. Otherwise we would be able to just store
 	// the pack index as the value of Keys map. For now, we have to find
 	// the pack's index and delete it.
-	if packIndex := slices.Index(ps.values, pack); packIndex != -1 {
-		delete(ps.keys, pack)
+	packIndex := slices.IndexFunc(ps.values, func(value Pack) bool {
+		return value.key() == pack.key()
+	})
+	if packIndex != -1 {
+		delete(ps.keys, pack.key())
 		ps.values = slices.Delete(ps.values, packIndex, packIndex+1)
 		return nil
 	} else {
@@ -82,6 +191,51 @@ func (ps *PackSet) Remove(pack Pack) error {
 	}
 }
 
+// takeStock removes count packs with size from stock. Packs that do not
+// track their stock are left alone.
+func (ps *PackSet) takeStock(size uint, count uint) error {
+	packIndex := slices.IndexFunc(ps.values, func(value Pack) bool {
+		return value.Size == size
+	})
+	if packIndex == -1 {
+		return ErrPackNotFound
+	}
+
+	pack := &ps.values[packIndex]
+	if !pack.TrackStock {
+		return nil
+	}
+	if pack.Stock < count {
+		return ErrInsufficientStock
+	}
+	pack.Stock -= count
+
+	return nil
+}
+
+// Strategy returns the name of the PackingStrategy used for this set.
+func (ps *PackSet) Strategy() string {
+	if ps.strategy == "" {
+		return DEFAULT_STRATEGY
+	}
+	return ps.strategy
+}
+
+// SetStrategy selects the PackingStrategy used for this set by name. An
+// alias is stored as the name the strategy has now.
+func (ps *PackSet) SetStrategy(name string) error {
+	strategy, err := GetStrategy(name)
+	if err != nil {
+		return err
+	}
+
+	if name != "" {
+		name = strategy.Name()
+	}
+	ps.strategy = name
+	return nil
+}
+
 // Sort is used to sort pack by their Pack size.
 func (ps *PackSet) Sort() {
 	slices.SortStableFunc(ps.values, func(a, b Pack) int {
@@ -91,11 +245,28 @@ func (ps *PackSet) Sort() {
 
 func NewPackSet() *PackSet {
 	ps := &PackSet{}
-	ps.keys = map[Pack]bool{}
+	ps.keys = map[packKey]bool{}
 	ps.values = []Pack{}
 	return ps
 }
 
+// NewPackSetFromJSON builds a sorted PackSet from its JSON format. It
+// returns an error when the strategy is unknown or a pack is repeated.
+func NewPackSetFromJSON(format PackSetJSONFormat) (*PackSet, error) {
+	packSet := NewPackSet()
+	if err := packSet.SetStrategy(format.Strategy); err != nil {
+		return nil, err
+	}
+	for _, pack := range format.Packs {
+		if err := packSet.Add(pack); err != nil {
+			return nil, err
+		}
+	}
+	packSet.Sort()
+
+	return packSet, nil
+}
+
 // ItemPackMap is a container for associating each inventory Item
 // with its packs.
 type ItemPackMap map[string]PackSet
@@ -111,3 +282,26 @@ func (im ItemPackMap) Sort(itemID string) error {
 
 	return nil
 }
+
+// PackSetJSONFormat is the representation of a PackSet in storage and
+// in requests.
+type PackSetJSONFormat struct {
+	// Strategy is the name of the PackingStrategy used for the item.
+	Strategy string `json:"strategy,omitempty"`
+	// Packs holds every pack in the set.
+	Packs []Pack `json:"packs"`
+}
+
+// UnmarshalJSON accepts a PackSetJSONFormat object or a plain array of
+// packs, which is how pack sets were stored before strategies existed.
+func (f *PackSetJSONFormat) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		f.Strategy = ""
+		return json.Unmarshal(data, &f.Packs)
+	}
+
+	// The alias drops this method so that the object is decoded with the
+	// default rules.
+	type packSetJSONFormat PackSetJSONFormat
+	return json.Unmarshal(data, (*packSetJSONFormat)(f))
+}
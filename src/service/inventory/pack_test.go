@@ -58,6 +58,29 @@ func TestPackSet(t *testing.T) {
 				assertEqual(t, ErrPackAlreadyExists, NO_ERROR)
 			}
 		})
+
+		t.Run("Should not add packs with contradicting quantity rules", func(t *testing.T) {
+			cases := []struct {
+				name string
+				pack Pack
+			}{
+				{"minimum off the step", Pack{Type: item1, Size: 250, MinQuantity: 3, QuantityStep: 2}},
+				{"maximum off the step", Pack{Type: item1, Size: 250, MaxQuantity: 5, QuantityStep: 2}},
+				{"maximum under the minimum", Pack{Type: item1, Size: 250, MinQuantity: 4, MaxQuantity: 2}},
+			}
+
+			for _, tc := range cases {
+				err := NewPackSet().Add(tc.pack)
+				if !errors.Is(err, ErrInvalidPackRule) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, ErrInvalidPackRule, err)
+				}
+			}
+
+			err := NewPackSet().Add(Pack{Type: item1, Size: 250, MinQuantity: 2, MaxQuantity: 6, QuantityStep: 2})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
 	})
 
 	t.Run("PackSet.Remove()", func(t *testing.T) {
@@ -0,0 +1,267 @@
+package inventory
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Demand maps each order count to the number of times it was requested.
+type Demand map[int]uint
+
+// add records frequency more requests for count.
+func (d Demand) add(count int, frequency uint) {
+	d[count] += frequency
+}
+
+// orderLogPattern finds the count in a request log line for an order.
+var orderLogPattern = regexp.MustCompile(`/order/(\d+)`)
+
+// ReadDemand reads a Demand from r. Each line is either a request log line
+// for an order, such as `GET "/v0.1.0/inventory/:id/order/500"`, or a CSV
+// row with a count and an optional frequency. A header row is skipped.
+func ReadDemand(r io.Reader) (Demand, error) {
+	demand := Demand{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		if match := orderLogPattern.FindStringSubmatch(text); match != nil {
+			count, err := strconv.Atoi(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDemand, line, err)
+			}
+			demand.add(count, 1)
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		count, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			if line == 1 {
+				// The first row names the columns.
+				continue
+			}
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDemand, line, err)
+		}
+
+		var frequency uint64 = 1
+		if len(fields) > 1 {
+			frequency, err = strconv.ParseUint(strings.TrimSpace(fields[1]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidDemand, line, err)
+			}
+		}
+		demand.add(count, uint(frequency))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return demand, nil
+}
+
+// RecommendationScore measures how well a set of pack sizes serves a
+// Demand. Lower is better.
+type RecommendationScore struct {
+	// Overshoot is the number of items sent beyond the count across every
+	// order.
+	Overshoot uint64 `json:"overshoot"`
+	// Packs is the number of packs sent across every order.
+	Packs uint64 `json:"packs"`
+	// Orders is the number of orders scored.
+	Orders uint64 `json:"orders"`
+}
+
+func (a RecommendationScore) compare(b RecommendationScore) int {
+	if c := cmp.Compare(a.Overshoot, b.Overshoot); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Packs, b.Packs)
+}
+
+// Recommendation is a set of pack sizes along with its score.
+type Recommendation struct {
+	// Sizes lists the pack sizes, smallest first.
+	Sizes []uint              `json:"sizes"`
+	Score RecommendationScore `json:"score"`
+}
+
+// Recommend searches for the sets of k pack sizes that send the fewest
+// items beyond the count, and then the fewest packs, across demand. Orders
+// are solved the same way ProcessOrder solves them by default. The best
+// MAX_RECOMMENDATIONS sets are returned, best first.
+//
+// Pack sizes are picked from sizes. When sizes is empty, the
+// MAX_RECOMMENDATION_SIZES counts requested most often are used, since a
+// pack that fits a popular count exactly sends nothing extra for it.
+//
+// Trying every set of k sizes does not scale, so the search is a beam
+// search. Sets are grown one size at a time and only the best
+// RECOMMENDATION_BEAM_WIDTH sets of each size are grown further. This finds
+// the best set for most demand, but it is not guaranteed to. Sets whose
+// orders are too large to solve are left out.
+func Recommend(demand Demand, k int, sizes []uint) ([]Recommendation, error) {
+	if k <= 0 {
+		return nil, ErrInvalidPackCount
+	}
+	if k > MAX_RECOMMENDATION_PACKS {
+		return nil, fmt.Errorf("%w: a pack set holds at most %d sizes", ErrInvalidRequest, MAX_RECOMMENDATION_PACKS)
+	}
+	if len(sizes) > MAX_RECOMMENDATION_CANDIDATES {
+		return nil, fmt.Errorf("%w: at most %d pack sizes can be picked from", ErrInvalidRequest, MAX_RECOMMENDATION_CANDIDATES)
+	}
+
+	var orders uint
+	for count, frequency := range demand {
+		if count <= 0 {
+			return nil, fmt.Errorf("%w: count %d must be greater than zero", ErrInvalidDemand, count)
+		}
+		orders += frequency
+	}
+	if orders == 0 {
+		return nil, fmt.Errorf("%w: no orders were requested", ErrInvalidDemand)
+	}
+
+	if len(sizes) == 0 {
+		sizes = popularCounts(demand, MAX_RECOMMENDATION_SIZES)
+	}
+	sizes = slices.Clone(sizes)
+	slices.Sort(sizes)
+	sizes = slices.Compact(sizes)
+	if len(sizes) > 0 && sizes[0] == 0 {
+		sizes = sizes[1:]
+	}
+	if len(sizes) == 0 {
+		return nil, ErrNoPacks
+	}
+	k = min(k, len(sizes))
+
+	beam := []Recommendation{{Sizes: []uint{}}}
+	for step := 0; step < k; step++ {
+		seen := map[string]bool{}
+		next := []Recommendation{}
+		for _, current := range beam {
+			for _, size := range sizes {
+				if slices.Contains(current.Sizes, size) {
+					continue
+				}
+
+				grown := append(slices.Clone(current.Sizes), size)
+				slices.Sort(grown)
+				key := fmt.Sprint(grown)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				score, err := scoreSizes(grown, demand)
+				if errors.Is(err, ErrOrderTooLarge) {
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, Recommendation{Sizes: grown, Score: score})
+			}
+		}
+		if len(next) == 0 {
+			return nil, ErrOrderTooLarge
+		}
+
+		slices.SortStableFunc(next, func(a, b Recommendation) int {
+			if c := a.Score.compare(b.Score); c != 0 {
+				return c
+			}
+			return slices.Compare(a.Sizes, b.Sizes)
+		})
+		beam = next[:min(len(next), RECOMMENDATION_BEAM_WIDTH)]
+	}
+
+	return beam[:min(len(beam), MAX_RECOMMENDATIONS)], nil
+}
+
+// popularCounts returns up to limit counts of demand, most requested first.
+func popularCounts(demand Demand, limit int) []uint {
+	counts := []int{}
+	for count, frequency := range demand {
+		if frequency > 0 {
+			counts = append(counts, count)
+		}
+	}
+	slices.SortFunc(counts, func(a, b int) int {
+		if c := cmp.Compare(demand[b], demand[a]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	sizes := []uint{}
+	for _, count := range counts[:min(len(counts), limit)] {
+		sizes = append(sizes, uint(count))
+	}
+	return sizes
+}
+
+// scoreSizes solves every count in demand with packs of sizes and totals
+// the overshoot and packs. Counts are split the way solve splits them, so
+// the bulk of a large count is set aside in bulk packs. A single table up
+// to the largest remainder then serves every order, and the first total it
+// can make up at or above a remainder is the one the minimal overshoot
+// strategy would send for it.
+func scoreSizes(sizes []uint, demand Demand) (RecommendationScore, error) {
+	packs := make([]Pack, 0, len(sizes))
+	for _, size := range sizes {
+		packs = append(packs, Pack{Size: size})
+	}
+
+	// remainder returns the bulk packs set aside for count and the count
+	// that is left to solve exactly.
+	remainder := func(count int) (int, int) {
+		bulk, bulkCount := bulkFill(packs, count, minimalOvershoot.weight)
+		return bulkCount, count - bulkCount*int(bulk.Size)
+	}
+
+	largest := 0
+	for count, frequency := range demand {
+		if frequency > 0 {
+			_, rest := remainder(count)
+			largest = max(largest, rest)
+		}
+	}
+
+	table, err := buildPackTable(packs, largest, minimalOvershoot.weight)
+	if err != nil {
+		return RecommendationScore{}, err
+	}
+	defer table.release()
+
+	score := RecommendationScore{}
+	for count, frequency := range demand {
+		if frequency == 0 {
+			continue
+		}
+
+		bulkCount, rest := remainder(count)
+		total := rest
+		for !table.reachable(total) {
+			total++
+		}
+
+		score.Overshoot += uint64(total-rest) * uint64(frequency)
+		score.Packs += uint64(table.minPacks[total]+int64(bulkCount)) * uint64(frequency)
+		score.Orders += uint64(frequency)
+	}
+
+	return score, nil
+}
@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRecommend(t *testing.T) {
+	t.Run("ReadDemand()", func(t *testing.T) {
+		t.Run("Should read CSV rows and request log lines", func(t *testing.T) {
+			input := strings.Join([]string{
+				"count,frequency",
+				"250,3",
+				"500",
+				`[GIN] 2026/10/16 - 10:00:00 | 200 | 1ms | ::1 | GET "/v0.1.0/inventory/abc/order/250"`,
+			}, "\n")
+
+			demand, err := ReadDemand(strings.NewReader(input))
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if demand[250] != 4 || demand[500] != 1 || len(demand) != 2 {
+				assertEqual(t, Demand{250: 4, 500: 1}, demand)
+			}
+		})
+
+		t.Run("Should return an error for rows that are not counts", func(t *testing.T) {
+			_, err := ReadDemand(strings.NewReader("250\nlots\n"))
+			if !errors.Is(err, ErrInvalidDemand) {
+				assertEqual(t, ErrInvalidDemand, err)
+			}
+		})
+	})
+
+	t.Run("Recommend()", func(t *testing.T) {
+		t.Run("Should rank pack sets that fit the demand first", func(t *testing.T) {
+			demand := Demand{250: 10, 500: 5, 750: 3, 1001: 1}
+
+			recommendations, err := Recommend(demand, 2, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			best := recommendations[0]
+			if !slices.Equal(best.Sizes, []uint{250, 1001}) || best.Score.Overshoot != 0 || best.Score.Orders != 19 {
+				assertEqual(t, "250 and 1001 with no overshoot", best)
+			}
+			for index := 1; index < len(recommendations); index++ {
+				if recommendations[index].Score.compare(recommendations[index-1].Score) < 0 {
+					t.Fatalf("expected recommendations to be ranked; got: %+v", recommendations)
+				}
+			}
+		})
+
+		t.Run("Should score orders the way ProcessOrder solves them", func(t *testing.T) {
+			demand := Demand{12001: 2, 501: 1, 10_000_001: 1}
+			sizes := []uint{250, 500, 1000, 2000, 5000}
+
+			recommendations, err := Recommend(demand, len(sizes), sizes)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			packs := packCase{Sizes: sizes}.packs()
+			expected := RecommendationScore{}
+			for count, frequency := range demand {
+				order, _ := solve(packs, count, minimalOvershoot, nil)
+				overshoot, packCount := summarize(order, count)
+				expected.Overshoot += uint64(overshoot) * uint64(frequency)
+				expected.Packs += uint64(packCount) * uint64(frequency)
+				expected.Orders += uint64(frequency)
+			}
+			if recommendations[0].Score != expected {
+				assertEqual(t, expected, recommendations[0].Score)
+			}
+		})
+
+		t.Run("Should leave out pack sets that are too large to solve", func(t *testing.T) {
+			recommendations, err := Recommend(Demand{1: 1, 250: 1}, 1, []uint{250, MAX_SOLVER_TABLE_SIZE + 1})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if len(recommendations) != 1 || !slices.Equal(recommendations[0].Sizes, []uint{250}) {
+				assertEqual(t, "only the set of 250", recommendations)
+			}
+		})
+
+		t.Run("Should return an error for invalid requests", func(t *testing.T) {
+			cases := []struct {
+				name   string
+				demand Demand
+				k      int
+				sizes  []uint
+				err    error
+			}{
+				{"no demand", Demand{}, 2, nil, ErrInvalidDemand},
+				{"negative count", Demand{-5: 1}, 2, nil, ErrInvalidDemand},
+				{"no pack sizes", Demand{250: 1}, 0, nil, ErrInvalidPackCount},
+				{"too many pack sizes", Demand{250: 1}, MAX_RECOMMENDATION_PACKS + 1, nil, ErrInvalidRequest},
+				{"too many sizes to pick from", Demand{250: 1}, 2, make([]uint, MAX_RECOMMENDATION_CANDIDATES+1), ErrInvalidRequest},
+				{"every set too large to solve", Demand{1: 1}, 1, []uint{MAX_SOLVER_TABLE_SIZE + 1}, ErrOrderTooLarge},
+			}
+
+			for _, tc := range cases {
+				_, err := Recommend(tc.demand, tc.k, tc.sizes)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+		})
+	})
+}
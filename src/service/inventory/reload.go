@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+// fileStamp identifies a version of a file by when it was modified and its
+// size. The zero fileStamp is a file that does not exist.
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+// statFile returns the fileStamp of the file at path.
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileStamp{}, nil
+	}
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime().UnixNano(), size: info.Size()}, nil
+}
+
+// StorageStatus reports on the changes made to the storage file outside
+// the service.
+type StorageStatus struct {
+	// Path is the storage file. It is empty when the inventory is not
+	// stored in one, such as with STORAGE_BACKEND_KV.
+	Path string `json:"path"`
+	// Reloads is the number of times changes to the file were loaded.
+	Reloads    int        `json:"reloads"`
+	ReloadedAt *time.Time `json:"reloadedAt,omitempty"`
+	// Error says why the file as it is now was not loaded. The inventory
+	// keeps what it held before until the file is fixed, or until the
+	// service saves the file again, which keeps the rejected one as a
+	// backup when backups are kept. It is empty while the file is loaded.
+	Error      string     `json:"error,omitempty"`
+	RejectedAt *time.Time `json:"rejectedAt,omitempty"`
+}
+
+// StorageStatus returns the StorageStatus of the inventory.
+func (i *Inventory) StorageStatus() StorageStatus {
+	i.lock()
+	defer i.unLock()
+
+	return i.storageStatus
+}
+
+// storageFile returns the path of the file that holds the snapshot of the
+// inventory, or an empty string when it is not held in a file.
+func (i *Inventory) storageFile() string {
+	files, ok := i.storage.(*store.FileStore[string, StorageJSONFormat])
+	if !ok {
+		return ""
+	}
+	path, err := files.Path(i.storageKey)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// markStorage records the storage file as it is now as loaded, so that the
+// saves made by the service are not reloaded as changes. It must be called
+// with the Inventory lock held.
+func (i *Inventory) markStorage() {
+	path := i.storageFile()
+	if path == "" {
+		return
+	}
+
+	stamp, err := statFile(path)
+	if err != nil {
+		log.Error("Failed to read storage file details", "path", path, "error", err)
+		return
+	}
+	i.storageStamp = stamp
+	i.storageStatus.Path = path
+	// A file that was rejected has been replaced.
+	i.storageStatus.Error = ""
+	i.storageStatus.RejectedAt = nil
+}
+
+// readStorage reads the storage file along with the changes logged since
+// it was saved, as the service does when it starts. It returns
+// ErrInvalidStorage when the file cannot be loaded as it is, or when it
+// drops an item that has open orders. It must be called with the Inventory
+// lock held.
+func (i *Inventory) readStorage(ctx context.Context) (*StorageJSONFormat, error) {
+	stored, err := i.storage.Get(ctx, i.storageKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: file was removed", ErrInvalidStorage)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStorage, err)
+	}
+	if err := stored.validate(); err != nil {
+		return nil, err
+	}
+
+	if i.wal != nil {
+		err := i.wal.Replay(func(mutation Mutation) error {
+			if mutation.Sequence > stored.Sequence {
+				stored.apply(mutation)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, order := range i.orders {
+		if _, ok := stored.Items[order.ItemID]; !ok && order.isOpen() {
+			return nil, fmt.Errorf("%w: item %s has open order %s", ErrInvalidStorage, order.ItemID, order.Id)
+		}
+	}
+	return &stored, nil
+}
+
+// reloadStorage loads the storage file again when it was changed outside
+// the service since it was last loaded, saved or rejected. A file that
+// cannot be loaded leaves the inventory as it is, and the error is kept in
+// the StorageStatus.
+func (i *Inventory) reloadStorage(ctx context.Context) error {
+	path := i.storageFile()
+	if path == "" {
+		return nil
+	}
+
+	i.lock()
+	defer i.unLock()
+
+	stamp, err := statFile(path)
+	if err != nil {
+		log.Error("Failed to read storage file details", "path", path, "error", err)
+		return err
+	}
+	if stamp == i.storageStamp {
+		return nil
+	}
+	// The same version is not checked twice, whether it loads or not.
+	i.storageStamp = stamp
+
+	log.Info("Reload inventory storage start", "path", path)
+	stored, err := i.readStorage(ctx)
+	now := time.Now()
+	if err != nil {
+		log.Error("Failed to reload inventory storage, will keep the inventory as it is", "path", path, "error", err)
+		i.storageStatus.Error = err.Error()
+		i.storageStatus.RejectedAt = &now
+		return err
+	}
+
+	previousData := i.data
+	i.unserialize(stored)
+	for itemID := range previousData {
+		if _, ok := i.data[itemID]; !ok {
+			i.cache.drop(itemID)
+		}
+	}
+	i.storageStatus.Reloads++
+	i.storageStatus.ReloadedAt = &now
+	i.storageStatus.Error = ""
+	i.storageStatus.RejectedAt = nil
+
+	// Orders cached for the packs before the change no longer apply.
+	go i.rebuildCaches()
+	// Data saved before the latest schema is saved again, as it is when
+	// the service starts.
+	if stored.migrated {
+		i.inBackground(i.compact)
+	}
+
+	log.Info("Reload inventory storage success", "path", path, "items", len(i.items), "sequence", i.sequence)
+	return nil
+}
+
+// runStorageWatch reloads the storage file every interval when it was
+// changed outside the service, until ctx is done.
+func (i *Inventory) runStorageWatch(ctx context.Context, interval time.Duration) {
+	if i.storageFile() == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.reloadStorage(ctx)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReload(t *testing.T) {
+	var (
+		id  = item1.Id.String()
+		id2 = item2.Id.String()
+		ctx = context.Background()
+	)
+
+	// setup opens an inventory with item1 in a new directory.
+	setup := func(t *testing.T) (*Inventory, string) {
+		inv, storagePath, _ := openNewStorage(t)
+		inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+		inv.compact()
+		return inv, storagePath
+	}
+
+	// edit saves the inventory with item2 added as if it was edited by hand.
+	edit := func(t *testing.T, storagePath string) {
+		stored := StorageJSONFormat{
+			Items: map[string]Item{id: item1, id2: item2},
+			Packs: map[string]StoredPackSet{
+				id:  {Packs: []StoredPack{{Size: 250}}},
+				id2: {Packs: []StoredPack{{Size: 10}, {Size: 20}}},
+			},
+		}
+		storage, key := StorageFile(storagePath)
+		if err := storage.Set(ctx, key, stored); err != nil {
+			t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+		}
+	}
+
+	t.Run("Inventory.reloadStorage()", func(t *testing.T) {
+		t.Run("Should load changes made outside the service", func(t *testing.T) {
+			inv, storagePath := setup(t)
+			edit(t, storagePath)
+
+			if err := inv.reloadStorage(ctx); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item, err := inv.GetItem(id2); err != nil || len(item.Packs) != 2 || item.Packs[0].Type != item2 {
+				assertEqual(t, "item2 with 2 packs", item)
+			}
+			if status := inv.StorageStatus(); status.Reloads != 1 || status.Error != "" || status.Path != storagePath {
+				assertEqual(t, "1 reload", status)
+			}
+		})
+
+		t.Run("Should apply the changes logged since the file was saved", func(t *testing.T) {
+			inv, storagePath := setup(t)
+			inv.AddPack(id, Pack{Size: 500})
+			edit(t, storagePath)
+
+			inv.reloadStorage(ctx)
+			if item, _ := inv.GetItem(id); len(item.Packs) != 2 {
+				assertEqual(t, 2, len(item.Packs))
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+
+		t.Run("Should ignore the saves of the service", func(t *testing.T) {
+			inv, _ := setup(t)
+			inv.AddPack(id, Pack{Size: 500})
+			inv.compact()
+
+			if err := inv.reloadStorage(ctx); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if status := inv.StorageStatus(); status.Reloads != 0 {
+				assertEqual(t, 0, status.Reloads)
+			}
+		})
+
+		t.Run("Should keep the inventory when the file is not valid", func(t *testing.T) {
+			inv, storagePath := setup(t)
+			os.WriteFile(storagePath, []byte(`{"items":`), 0o644)
+
+			if err := inv.reloadStorage(ctx); !errors.Is(err, ErrInvalidStorage) {
+				assertEqual(t, ErrInvalidStorage, err)
+			}
+			if item, err := inv.GetItem(id); err != nil || len(item.Packs) != 1 {
+				assertEqual(t, "item1 with 1 pack", item)
+			}
+			status := inv.StorageStatus()
+			if status.Error == "" || status.RejectedAt == nil {
+				assertEqual(t, "rejected file", status)
+			}
+
+			// The rejected file is not checked again until it changes.
+			if err := inv.reloadStorage(ctx); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			edit(t, storagePath)
+			inv.reloadStorage(ctx)
+			if status := inv.StorageStatus(); status.Error != "" || status.Reloads != 1 {
+				assertEqual(t, "1 reload", status)
+			}
+		})
+
+		t.Run("Should load changes to a file the service saved with items without a name", func(t *testing.T) {
+			dir := t.TempDir()
+			storagePath := filepath.Join(dir, "storage.json")
+			legacy, _ := json.Marshal(InventoryJSONFormat{
+				id: {Packs: []Pack{{Type: Item{Id: item1.Id}, Size: 250}}},
+			})
+			os.WriteFile(storagePath, legacy, 0o644)
+			// The service saves the migrated file when it opens it.
+			inv := openStorage(t, storagePath, filepath.Join(dir, "storage.wal"))
+
+			storage, key := StorageFile(storagePath)
+			stored, err := storage.Get(ctx, key)
+			if err != nil || stored.migrated || stored.Items[id].Name != "" {
+				assertEqual(t, "migrated item without a name", stored)
+			}
+			stored.Items[id2] = item2
+			stored.Packs[id2] = StoredPackSet{Packs: []StoredPack{{Size: 10}}}
+			if err := storage.Set(ctx, key, stored); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+			}
+
+			if err := inv.reloadStorage(ctx); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item, err := inv.GetItem(id); err != nil || len(item.Packs) != 1 {
+				assertEqual(t, "item1 with 1 pack", item)
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+
+		t.Run("Should not drop an item with open orders", func(t *testing.T) {
+			inv, storagePath := setup(t)
+			if _, err := inv.CreateOrder(id, 250, true); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			os.WriteFile(storagePath, []byte(`{"items":{},"packs":{}}`), 0o644)
+
+			if err := inv.reloadStorage(ctx); !errors.Is(err, ErrInvalidStorage) {
+				assertEqual(t, ErrInvalidStorage, err)
+			}
+			if _, err := inv.GetItem(id); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+	})
+
+	t.Run("StorageJSONFormat.validate()", func(t *testing.T) {
+		t.Run("Should list every entry that cannot be loaded", func(t *testing.T) {
+			cases := []struct {
+				stored   string
+				expected string
+			}{
+				{fmt.Sprintf(`{"items":{%q:{"id":%q,"name":"a"}},"packs":{%q:{"packs":[{"size":1}]}}}`, id, id, id), ""},
+				{`{"items":{"x":{"name":"a"}}}`, "item x: key is not a UUID"},
+				{fmt.Sprintf(`{"items":{%q:{"id":%q}}}`, id, id), ""},
+				{fmt.Sprintf(`{"items":{%q:{"id":%q,"name":"a"}}}`, id, id2), "does not match its key"},
+				{fmt.Sprintf(`{"items":{},"packs":{%q:{"packs":[]}}}`, id), "item is not in the catalog"},
+				{fmt.Sprintf(`{"items":{%q:{"id":%q,"name":"a"}},"packs":{%q:{"strategy":"x","packs":[]}}}`, id, id, id), ErrUnknownStrategy.Error()},
+				{fmt.Sprintf(`{"items":{%q:{"id":%q,"name":"a"}},"packs":{%q:{"packs":[{"size":1},{"size":1}]}}}`, id, id, id), ErrPackAlreadyExists.Error()},
+				{fmt.Sprintf(`{"items":{%q:{"id":%q,"name":"a"}},"packs":{%q:{"packs":[{"size":0}]}}}`, id, id, id), "size must be greater than zero"},
+			}
+
+			for _, tc := range cases {
+				path := filepath.Join(t.TempDir(), "storage.json")
+				os.WriteFile(path, []byte(tc.stored), 0o644)
+				storage, key := StorageFile(path)
+				stored, _ := storage.Get(ctx, key)
+
+				err := stored.validate()
+				if tc.expected == "" && err != nil {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.stored, NO_ERROR, err)
+				}
+				if tc.expected != "" && (!errors.Is(err, ErrInvalidStorage) || !strings.Contains(err.Error(), tc.expected)) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.stored, tc.expected, err)
+				}
+			}
+		})
+	})
+}
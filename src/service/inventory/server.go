@@ -2,12 +2,16 @@ package inventory
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
 	"eikcalb.dev/shark/src/constants"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // startServer starts a server for the service.
@@ -24,8 +28,8 @@ func (i *Inventory) startServer(ctx context.Context, port uint16) {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Admin-Token")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -44,44 +48,231 @@ func (i *Inventory) startServer(ctx context.Context, port uint16) {
 	}
 
 	// Fetch all inventory items.
+	// Items can be filtered by whether they are for sale.
 	rg.GET("/", func(c *gin.Context) {
-		data := i.serialize()
+		filter := ItemFilter{}
+		if rawForSale, ok := c.GetQuery("forSale"); ok {
+			forSale, err := strconv.ParseBool(rawForSale)
+			if err != nil {
+				log.Error("Failed to parse for sale filter", "error", err)
+				respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+				return
+			}
+			filter.ForSale = &forSale
+		}
+
+		data := i.serialize(filter)
 		c.JSON(http.StatusOK, gin.H{"response": data})
 	})
 
+	// Report how well the solution cache is serving orders.
+	rg.GET("/cache", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"response": i.CacheStats()})
+	})
+
+	// Report whether changes made to the storage file outside the service
+	// were loaded.
+	rg.GET("/storage", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"response": i.StorageStatus()})
+	})
+
+	// List the snapshots of the inventory, newest first.
+	rg.GET("/snapshots", func(c *gin.Context) {
+		snapshots, err := i.ListSnapshots(c.Request.Context())
+		if err != nil {
+			log.Error("Failed to list inventory snapshots", "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": snapshots})
+	})
+
+	// Take a snapshot of the inventory as it is now.
+	rg.POST("/snapshots", func(c *gin.Context) {
+		if err := i.authorizeAdmin(c); err != nil {
+			respondError(c, err)
+			return
+		}
+		var json struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil && !errors.Is(err, io.EOF) {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+		if json.Reason == "" {
+			json.Reason = "requested"
+		}
+
+		snapshot, err := i.TakeSnapshot(c.Request.Context(), json.Reason)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"response": snapshot})
+	})
+
+	// Compare a snapshot with the inventory as it is now, or with the
+	// snapshot named by the against query parameter.
+	rg.GET("/snapshots/:snapshotID/diff", func(c *gin.Context) {
+		diff, err := i.DiffSnapshot(c.Request.Context(), c.Param("snapshotID"), c.Query("against"))
+		if err != nil {
+			log.Error("Failed to compare inventory snapshot", "snapshotID", c.Param("snapshotID"), "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": diff})
+	})
+
+	// Restore the inventory to a snapshot. The response holds the snapshot
+	// taken before, which undoes the restore.
+	rg.POST("/snapshots/:snapshotID/restore", func(c *gin.Context) {
+		if err := i.authorizeAdmin(c); err != nil {
+			respondError(c, err)
+			return
+		}
+
+		backup, err := i.RestoreSnapshot(c.Request.Context(), c.Param("snapshotID"))
+		if err != nil {
+			log.Error("Failed to restore inventory snapshot", "snapshotID", c.Param("snapshotID"), "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": gin.H{"restored": c.Param("snapshotID"), "backup": backup}})
+	})
+
 	rg.PUT("/:id", func(c *gin.Context) {
 		// When an update is received for an item, parse the request body.
 		id := c.Param("id")
-		var json []Pack
-		if err := c.BindJSON(&json); err != nil {
+		var json PackSetJSONFormat
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
 			return
 		}
 
 		// We have received an id and a pack array, so we will need to update
 		// the item.
-		// New item, so we just save.
-		newPackSet := NewPackSet()
-		for _, pack := range json {
-			log.Info("Add new pack to inventory", "pack", pack)
-			err := newPackSet.Add(pack)
-			if err != nil {
-				log.Error("Failed to add new pack to inventory", "pack", pack, "error", err)
-				c.JSON(http.StatusBadRequest, gin.H{"error": err})
-				return
-			}
+		if err := i.SetPacks(id, json); err != nil {
+			log.Error("Failed to set packs of item", "itemID", id, "packSet", json, "error", err)
+			respondError(c, err)
+			return
 		}
-		newPackSet.Sort()
-		i.data[id] = *newPackSet
 
-		// Save the update to disk without blocking this request.
-		go func() {
-			i.persist()
-		}()
+		i.itemChanged(id)
 
-		data := i.serialize()
+		data := i.serialize(ItemFilter{})
 		c.JSON(http.StatusOK, gin.H{"response": data})
 	})
 
+	// Add an item to the catalog, optionally along with its packs.
+	rg.POST("/", func(c *gin.Context) {
+		var json struct {
+			Item
+			// ForSale hides the field of Item so that new items are for
+			// sale unless the request says otherwise.
+			ForSale  *bool  `json:"forSale"`
+			Strategy string `json:"strategy"`
+			Packs    []Pack `json:"packs"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+		json.Item.ForSale = json.ForSale == nil || *json.ForSale
+
+		item, err := i.CreateItem(json.Item, PackSetJSONFormat{Strategy: json.Strategy, Packs: json.Packs})
+		if err != nil {
+			log.Error("Failed to create item", "item", json.Item, "error", err)
+			respondError(c, err)
+			return
+		}
+		i.itemChanged(item.Item.Id.String())
+
+		c.JSON(http.StatusCreated, gin.H{"response": item})
+	})
+
+	rg.GET("/:id", func(c *gin.Context) {
+		item, err := i.GetItem(c.Param("id"))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": item})
+	})
+
+	rg.PATCH("/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		var json ItemPatch
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		item, err := i.UpdateItem(id, json)
+		if err != nil {
+			log.Error("Failed to update item", "itemID", id, "error", err)
+			respondError(c, err)
+			return
+		}
+		i.itemChanged(id)
+
+		c.JSON(http.StatusOK, gin.H{"response": item})
+	})
+
+	rg.DELETE("/:id", func(c *gin.Context) {
+		id := c.Param("id")
+		if err := i.DeleteItem(id); err != nil {
+			log.Error("Failed to delete item", "itemID", id, "error", err)
+			respondError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rg.POST("/:id/packs", func(c *gin.Context) {
+		id := c.Param("id")
+		var json Pack
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		item, err := i.AddPack(id, json)
+		if err != nil {
+			log.Error("Failed to add pack to item", "itemID", id, "pack", json, "error", err)
+			respondError(c, err)
+			return
+		}
+		i.itemChanged(id)
+
+		c.JSON(http.StatusCreated, gin.H{"response": item})
+	})
+
+	rg.DELETE("/:id/packs/:size", func(c *gin.Context) {
+		id := c.Param("id")
+		size, err := strconv.ParseUint(c.Param("size"), 10, 0)
+		if err != nil {
+			log.Error("Failed to parse pack size", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		item, err := i.RemovePack(id, uint(size))
+		if err != nil {
+			log.Error("Failed to remove pack from item", "itemID", id, "size", size, "error", err)
+			respondError(c, err)
+			return
+		}
+		i.itemChanged(id)
+
+		c.JSON(http.StatusOK, gin.H{"response": item})
+	})
+
 	rg.GET("/:id/order/:count", func(c *gin.Context) {
 		// When an update is received for an item, parse the request body.
 		id := c.Param("id")
@@ -89,17 +280,302 @@ func (i *Inventory) startServer(ctx context.Context, port uint16) {
 		count, err := strconv.Atoi(rawCount)
 		if err != nil {
 			log.Error("Failed to parse order count", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": err})
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		// The strategy configured for the item can be overridden for a
+		// single order.
+		options := []OrderOption{}
+		if strategy := c.Query("strategy"); strategy != "" {
+			options = append(options, WithStrategy(strategy))
+		}
+
+		// Orders can be split into consignments that each respect a
+		// shipping limit.
+		constraint, err := parseShipmentConstraint(c)
+		if err != nil {
+			log.Error("Failed to parse shipment constraint", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		// Customers that refuse overshoot only accept an exact fit.
+		if exact, _ := strconv.ParseBool(c.Query("exact")); exact {
+			options = append(options, WithExactFit())
+		}
+
+		// Admins can order items that are not for sale.
+		if override, _ := strconv.ParseBool(c.Query("override")); override {
+			if err := i.authorizeAdmin(c); err != nil {
+				respondError(c, err)
+				return
+			}
+			options = append(options, WithAdminOverride())
+		}
+
+		// The trace explains how the packs were chosen.
+		var trace *SolverTrace
+		if explain, _ := strconv.ParseBool(c.Query("explain")); explain {
+			trace = &SolverTrace{}
+			options = append(options, WithExplain(trace))
+		}
+
+		packsOrder, err := i.ProcessOrder(id, count, options...)
+		if err != nil {
+			respondError(c, err)
 			return
 		}
 
 		var data gin.H = gin.H{}
-		packsOrder := i.ProcessOrder(id, count)
 		for pack, count := range packsOrder {
 			data[strconv.Itoa(int(pack.Size))] = count
 		}
-		c.JSON(http.StatusOK, gin.H{"response": data})
+
+		// When the packs in stock cannot cover the order, it is only
+		// partly filled.
+		items := packsOrder.Items()
+		response := gin.H{
+			"response": data,
+			"items":    items,
+			"partial":  items < uint(count),
+			"cost": gin.H{
+				"packs": packsOrder.costs(),
+				"total": packsOrder.Price(),
+			},
+		}
+
+		if constraint != nil {
+			consignments, err := Consign(packsOrder, *constraint)
+			if err != nil {
+				log.Error("Failed to split order into consignments", "itemID", id, "error", err)
+				respondError(c, err)
+				return
+			}
+			response["consignments"] = consignments
+		}
+		if trace != nil {
+			response["trace"] = trace
+		}
+
+		c.JSON(http.StatusOK, response)
+	})
+
+	rg.POST("/basket", func(c *gin.Context) {
+		var json struct {
+			Lines    []BasketLine `json:"lines"`
+			Strategy string       `json:"strategy"`
+			Override bool         `json:"override"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		// The strategy configured for each item can be overridden for the
+		// whole basket.
+		// An unknown strategy is rejected up front rather than failing every
+		// line.
+		options := []OrderOption{}
+		if json.Strategy != "" {
+			if _, err := GetStrategy(json.Strategy); err != nil {
+				log.Error("Failed to get packing strategy", "strategy", json.Strategy, "error", err)
+				respondError(c, err)
+				return
+			}
+			options = append(options, WithStrategy(json.Strategy))
+		}
+		if json.Override {
+			if err := i.authorizeAdmin(c); err != nil {
+				respondError(c, err)
+				return
+			}
+			options = append(options, WithAdminOverride())
+		}
+
+		result, err := i.ProcessBasket(json.Lines, options...)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"response": result})
+	})
+
+	rg.POST("/recommendations", func(c *gin.Context) {
+		var json struct {
+			// Demand maps each order count to how often it was requested.
+			Demand Demand `json:"demand"`
+			// Counts lists requested order counts, one entry per request.
+			Counts []int  `json:"counts"`
+			Packs  int    `json:"packs"`
+			Sizes  []uint `json:"sizes"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		demand := Demand{}
+		for count, frequency := range json.Demand {
+			demand.add(count, frequency)
+		}
+		for _, count := range json.Counts {
+			demand.add(count, 1)
+		}
+
+		recommendations, err := Recommend(demand, json.Packs, json.Sizes)
+		if err != nil {
+			log.Error("Failed to recommend pack sizes", "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": recommendations})
 	})
 
+	// Compare a proposed pack set with the current one without changing
+	// the item.
+	rg.POST("/:id/simulate", func(c *gin.Context) {
+		id := c.Param("id")
+		var json struct {
+			Strategy string `json:"strategy"`
+			Packs    []Pack `json:"packs"`
+			Counts   []int  `json:"counts"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		proposed := PackSetJSONFormat{Strategy: json.Strategy, Packs: json.Packs}
+		simulation, err := i.Simulate(id, proposed, json.Counts)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": simulation})
+	})
+
+	rg.POST("/:id/orders", func(c *gin.Context) {
+		id := c.Param("id")
+		var json struct {
+			Count    int    `json:"count"`
+			Strategy string `json:"strategy"`
+			Reserve  bool   `json:"reserve"`
+			Exact    bool   `json:"exact"`
+			Override bool   `json:"override"`
+		}
+		if err := c.ShouldBindJSON(&json); err != nil {
+			log.Error("Failed to parse request body", "error", err)
+			respondError(c, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+
+		options := []OrderOption{}
+		if json.Strategy != "" {
+			options = append(options, WithStrategy(json.Strategy))
+		}
+		if json.Exact {
+			options = append(options, WithExactFit())
+		}
+		if json.Override {
+			if err := i.authorizeAdmin(c); err != nil {
+				respondError(c, err)
+				return
+			}
+			options = append(options, WithAdminOverride())
+		}
+
+		order, err := i.CreateOrder(id, json.Count, json.Reserve, options...)
+		if err != nil {
+			log.Error("Failed to create order", "itemID", id, "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"response": order})
+	})
+
+	rg.GET("/:id/orders/:orderID", orderHandler(i.GetOrder))
+	rg.POST("/:id/orders/:orderID/reserve", orderHandler(i.ReserveOrder))
+	rg.POST("/:id/orders/:orderID/commit", orderHandler(i.CommitOrder))
+	rg.POST("/:id/orders/:orderID/cancel", orderHandler(i.CancelOrder))
+
 	r.Run(fmt.Sprintf(":%d", port))
 }
+
+// authorizeAdmin returns ErrAdminRequired unless the request presents the
+// admin token in the X-Admin-Token header.
+func (i *Inventory) authorizeAdmin(c *gin.Context) error {
+	token := c.GetHeader("X-Admin-Token")
+	if i.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(i.adminToken)) != 1 {
+		log.Error("Failed to authorize admin request", "path", c.FullPath())
+		return ErrAdminRequired
+	}
+	return nil
+}
+
+// itemChanged rebuilds the orders cached for the item without blocking the
+// request that changed it. The change itself is logged by the time the
+// request is answered.
+func (i *Inventory) itemChanged(itemID string) {
+	go i.rebuildCache(itemID)
+}
+
+// parseShipmentConstraint reads the maxWeight and maxVolume query
+// parameters. It returns nil when neither is set.
+func parseShipmentConstraint(c *gin.Context) (*ShipmentConstraint, error) {
+	rawWeight, hasWeight := c.GetQuery("maxWeight")
+	rawVolume, hasVolume := c.GetQuery("maxVolume")
+	if !hasWeight && !hasVolume {
+		return nil, nil
+	}
+
+	constraint := &ShipmentConstraint{}
+	if hasWeight {
+		weight, err := strconv.ParseUint(rawWeight, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		constraint.MaxWeight = weight
+	}
+	if hasVolume {
+		volume, err := strconv.ParseUint(rawVolume, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		constraint.MaxVolume = volume
+	}
+
+	return constraint, nil
+}
+
+// orderHandler returns a handler that applies action to the order named in
+// the request path and responds with the order.
+func orderHandler(action func(itemID string, orderID uuid.UUID) (Order, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		orderID, err := uuid.Parse(c.Param("orderID"))
+		if err != nil {
+			log.Error("Failed to parse order ID", "error", err)
+			respondError(c, ErrOrderNotFound)
+			return
+		}
+
+		order, err := action(id, orderID)
+		if err != nil {
+			log.Error("Failed to update order", "itemID", id, "orderID", orderID, "error", err)
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"response": order})
+	}
+}
+
+// respondError responds with the status and ErrorBody for err.
+func respondError(c *gin.Context, err error) {
+	body := newErrorBody(err)
+	c.JSON(body.status, gin.H{"error": body})
+}
@@ -3,11 +3,116 @@ package inventory
 import (
 	"errors"
 	"log/slog"
+	"net/http"
 	"testing"
+	"time"
 )
 
 const (
+	// STORAGE_PATH is the file that holds the inventory snapshot.
+	STORAGE_PATH = "storage.json"
+	// WAL_PATH is the file that logs every change to the inventory made
+	// since the snapshot.
+	WAL_PATH = "storage.wal"
+	// KV_STORAGE_PATH is the directory of the key-value store that holds
+	// the inventory when it is stored with STORAGE_BACKEND_KV.
+	KV_STORAGE_PATH = "storage.db"
+	// KV_IMPORT_SUFFIX is added to the directory of a key-value store that
+	// is being filled from the JSON backend until it is complete.
+	KV_IMPORT_SUFFIX = ".import"
+	// SNAPSHOT_PATH is the directory that holds the snapshots of the
+	// inventory, one file each.
+	SNAPSHOT_PATH = "snapshots"
+	// STORAGE_LOCK_SUFFIX is added to the storage file, or the directory of
+	// the key-value store, to name the file that is locked while a process
+	// has the inventory open.
+	STORAGE_LOCK_SUFFIX = ".lock"
+	// STORAGE_LOCK_MODE is the permission of the lock file.
+	STORAGE_LOCK_MODE = 0o644
+
+	// STORAGE_BACKEND_JSON stores the inventory as a snapshot in
+	// STORAGE_PATH with a log of the changes since in WAL_PATH. It is used
+	// when no backend is configured.
+	STORAGE_BACKEND_JSON = "json"
+	// STORAGE_BACKEND_KV stores each item on its own in a key-value store
+	// at KV_STORAGE_PATH, so changes do not depend on the catalog size.
+	STORAGE_BACKEND_KV = "kv"
+
+	// MAX_UNBOUNDED_ITERATION_COUNT is the most steps the greedy strategy
+	// takes to fulfill an order.
 	MAX_UNBOUNDED_ITERATION_COUNT = 800
+	// MAX_SOLVER_TABLE_SIZE is the largest total the order solver will
+	// build a table for. A table takes about 32 bytes for each total plus 4
+	// for each pack, so this keeps one near 32MB plus 4MB per pack, since
+	// orders can be solved by requests that are not signed in.
+	MAX_SOLVER_TABLE_SIZE = 1 << 20
+	// MAX_CONCURRENT_SOLVER_TABLES is the number of solver tables that are
+	// built at once. Requests that need another wait for one to finish.
+	MAX_CONCURRENT_SOLVER_TABLES = 4
+	// DEFAULT_SOLUTION_CACHE_BOUND is the largest count cached for each
+	// item when no bound is configured.
+	DEFAULT_SOLUTION_CACHE_BOUND = 1000
+	// DEFAULT_SOLUTION_CACHE_LIMIT is the largest number of orders cached
+	// across all items when no limit is configured.
+	DEFAULT_SOLUTION_CACHE_LIMIT = 100000
+	// DEFAULT_STORAGE_BACKUPS is the number of copies of the storage file
+	// kept from before each save when no number is configured.
+	DEFAULT_STORAGE_BACKUPS = 1
+	// WAL_COMPACTION_THRESHOLD is the number of records in the inventory
+	// log that triggers a compaction into a snapshot.
+	WAL_COMPACTION_THRESHOLD = 1000
+	// WAL_COMPACTION_INTERVAL is how often the inventory log is compacted
+	// when it has records.
+	WAL_COMPACTION_INTERVAL = 5 * time.Minute
+	// DEFAULT_SNAPSHOT_INTERVAL is how often a snapshot of the inventory is
+	// taken while it changes when no interval is configured.
+	DEFAULT_SNAPSHOT_INTERVAL = time.Hour
+	// DEFAULT_SNAPSHOT_KEEP is the number of the newest snapshots kept when
+	// no number is configured, not counting those taken before a change.
+	DEFAULT_SNAPSHOT_KEEP = 48
+	// DEFAULT_SNAPSHOT_KEEP_BEFORE_CHANGE is the number of the newest
+	// snapshots taken before a change that are kept when no number is
+	// configured.
+	DEFAULT_SNAPSHOT_KEEP_BEFORE_CHANGE = 200
+	// DEFAULT_SNAPSHOT_MAX_AGE is how long snapshots are kept when no age
+	// is configured.
+	DEFAULT_SNAPSHOT_MAX_AGE = 7 * 24 * time.Hour
+	// STORAGE_WATCH_INTERVAL is how often the storage file is checked for
+	// changes made outside the service.
+	STORAGE_WATCH_INTERVAL = 2 * time.Second
+	// MAX_TRACE_CANDIDATES is the number of candidates listed in a
+	// SolverTrace.
+	MAX_TRACE_CANDIDATES = 20
+
+	// MAX_RECOMMENDATIONS is the number of pack sets Recommend returns.
+	MAX_RECOMMENDATIONS = 10
+	// MAX_RECOMMENDATION_SIZES is the number of popular order counts that
+	// Recommend picks pack sizes from when none are given.
+	MAX_RECOMMENDATION_SIZES = 24
+	// MAX_RECOMMENDATION_PACKS is the largest number of pack sizes a
+	// recommended set can hold.
+	MAX_RECOMMENDATION_PACKS = 8
+	// MAX_RECOMMENDATION_CANDIDATES is the largest number of pack sizes
+	// Recommend can be asked to pick from.
+	MAX_RECOMMENDATION_CANDIDATES = 64
+	// RECOMMENDATION_BEAM_WIDTH is the number of pack sets Recommend grows
+	// at each step of its search.
+	RECOMMENDATION_BEAM_WIDTH = 32
+
+	// DEFAULT_RESERVATION_TTL is how long quotes and reservations last
+	// when no TTL is configured.
+	DEFAULT_RESERVATION_TTL = 15 * time.Minute
+	// ORDER_EXPIRY_INTERVAL is how often orders are checked for expiry.
+	ORDER_EXPIRY_INTERVAL = time.Second
+	// ORDER_RETENTION is how long committed, cancelled and expired orders
+	// are kept before they are dropped.
+	ORDER_RETENTION = 24 * time.Hour
+
+	// MAX_BASKET_LINES is the largest number of lines a basket can hold.
+	MAX_BASKET_LINES = 100
+	// MAX_CONSIGNMENTS is the largest number of consignments an order can
+	// be split into.
+	MAX_CONSIGNMENTS = 10000
 
 	NO_ERROR string = "(noerror)"
 )
@@ -16,11 +121,112 @@ var (
 	log *slog.Logger = slog.Default()
 
 	ErrItemNotFound        = errors.New("item was not found")
+	ErrItemAlreadyExists   = errors.New("item already exists")
+	ErrItemInUse           = errors.New("item has open orders")
+	ErrItemNotForSale      = errors.New("item is not for sale")
+	ErrPersistFailed       = errors.New("change could not be saved")
+	ErrAdminRequired       = errors.New("only admins can override this check")
 	ErrIndexedItemNotFound = errors.New("indexed item was not found")
 	ErrPackAlreadyExists   = errors.New("pack already exists in this set")
 	ErrPackNotFound        = errors.New("pack was not found in this set")
+	ErrInvalidPackRule     = errors.New("pack quantity rules are not valid")
+	ErrItemMismatch        = errors.New("pack belongs to another item")
+	ErrNoPacks             = errors.New("item has no packs to fulfill an order")
+	ErrOrderTooLarge       = errors.New("order count is too large to solve")
+	ErrUnknownStrategy     = errors.New("packing strategy is not known")
+	ErrInvalidCount        = errors.New("order count must be greater than zero")
+	ErrInvalidRequest      = errors.New("request is not valid")
+	ErrUnknownBackend      = errors.New("storage backend is not known")
+	ErrSnapshotNotFound    = errors.New("snapshot was not found")
+	ErrSnapshotsDisabled   = errors.New("snapshots are not kept")
+	ErrInvalidStorage      = errors.New("storage is not valid")
+	ErrStorageLocked       = errors.New("storage is in use by another process")
+
+	ErrOrderNotFound          = errors.New("order was not found")
+	ErrInvalidOrderTransition = errors.New("order cannot move to the requested state")
+	ErrInsufficientStock      = errors.New("not enough packs are in stock")
+
+	ErrPackExceedsShipment = errors.New("pack is larger than a consignment allows")
+	ErrTooManyConsignments = errors.New("order needs too many consignments")
+
+	ErrNoExactFit = errors.New("no combination of packs fills the count exactly")
+
+	ErrInvalidDemand    = errors.New("order demand is not valid")
+	ErrInvalidPackCount = errors.New("number of pack sizes must be greater than zero")
 )
 
+// apiError describes how an error is reported to clients.
+type apiError struct {
+	err    error
+	code   string
+	status int
+}
+
+// apiErrors lists the errors that clients can act on. Any other error is
+// reported as an internal error.
+var apiErrors = []apiError{
+	{ErrItemNotFound, "item_not_found", http.StatusNotFound},
+	{ErrOrderNotFound, "order_not_found", http.StatusNotFound},
+	{ErrPackNotFound, "pack_not_found", http.StatusNotFound},
+	{ErrSnapshotNotFound, "snapshot_not_found", http.StatusNotFound},
+	{ErrInvalidRequest, "invalid_request", http.StatusBadRequest},
+	{ErrUnknownStrategy, "unknown_strategy", http.StatusBadRequest},
+	{ErrInvalidPackRule, "invalid_pack_rule", http.StatusUnprocessableEntity},
+	{ErrItemMismatch, "item_mismatch", http.StatusUnprocessableEntity},
+	{ErrAdminRequired, "admin_required", http.StatusForbidden},
+	{ErrInvalidCount, "invalid_count", http.StatusUnprocessableEntity},
+	{ErrItemNotForSale, "item_not_for_sale", http.StatusUnprocessableEntity},
+	{ErrNoPacks, "no_packs", http.StatusUnprocessableEntity},
+	{ErrOrderTooLarge, "count_too_large", http.StatusUnprocessableEntity},
+	{ErrNoExactFit, "no_exact_fit", http.StatusUnprocessableEntity},
+	{ErrPackExceedsShipment, "pack_exceeds_shipment", http.StatusUnprocessableEntity},
+	{ErrTooManyConsignments, "too_many_consignments", http.StatusUnprocessableEntity},
+	{ErrInvalidDemand, "invalid_demand", http.StatusUnprocessableEntity},
+	{ErrInvalidPackCount, "invalid_pack_count", http.StatusUnprocessableEntity},
+	{ErrItemAlreadyExists, "item_already_exists", http.StatusConflict},
+	{ErrItemInUse, "item_in_use", http.StatusConflict},
+	{ErrPackAlreadyExists, "pack_already_exists", http.StatusConflict},
+	{ErrPersistFailed, "persist_failed", http.StatusServiceUnavailable},
+	{ErrInvalidOrderTransition, "invalid_order_transition", http.StatusConflict},
+	{ErrInsufficientStock, "insufficient_stock", http.StatusConflict},
+}
+
+// ErrorBody is how every error is represented in responses.
+type ErrorBody struct {
+	// Code identifies the kind of error and does not change.
+	Code string `json:"code"`
+	// Message describes the error for people.
+	Message string `json:"message"`
+	// Details holds what clients need to act on some errors, such as the
+	// nearest counts for ErrNoExactFit.
+	Details any `json:"details,omitempty"`
+
+	status int
+}
+
+// detailedError is implemented by errors that carry details for clients.
+type detailedError interface {
+	error
+	details() any
+}
+
+// newErrorBody returns the ErrorBody for err.
+func newErrorBody(err error) *ErrorBody {
+	for _, known := range apiErrors {
+		if errors.Is(err, known.err) {
+			body := &ErrorBody{Code: known.code, Message: err.Error(), status: known.status}
+
+			var detailed detailedError
+			if errors.As(err, &detailed) {
+				body.Details = detailed.details()
+			}
+			return body
+		}
+	}
+
+	return &ErrorBody{Code: "internal", Message: err.Error(), status: http.StatusInternalServerError}
+}
+
 func assertEqual[E interface{}, A interface{}](t *testing.T, expected E, actual A) {
 	t.Fatalf("expected: %+v; got: %+v", expected, actual)
 }
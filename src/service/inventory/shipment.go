@@ -0,0 +1,99 @@
+package inventory
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// ShipmentConstraint limits what a single consignment can carry. A limit of
+// zero means there is no limit.
+type ShipmentConstraint struct {
+	// MaxWeight is the most a consignment can weigh in grams.
+	MaxWeight uint64 `json:"maxWeight"`
+	// MaxVolume is the most a consignment can hold in cubic centimetres.
+	MaxVolume uint64 `json:"maxVolume"`
+}
+
+// Consignment is a group of packs that is shipped together.
+type Consignment struct {
+	// Packs maps each pack size in the consignment to the number of packs
+	// of that size.
+	Packs map[uint]uint `json:"packs"`
+	// Items is the number of items the packs hold.
+	Items uint `json:"items"`
+	// Weight is the weight of the packs in grams.
+	Weight uint64 `json:"weight"`
+	// Volume is the volume of the packs in cubic centimetres.
+	Volume uint64 `json:"volume"`
+}
+
+// add puts count packs into the consignment.
+func (c *Consignment) add(pack Pack, count uint) {
+	c.Packs[pack.Size] += count
+	c.Items += pack.Size * count
+	c.Weight += uint64(pack.Weight) * uint64(count)
+	c.Volume += uint64(pack.Volume) * uint64(count)
+}
+
+// room returns how many more of pack fit into consignment.
+func (sc ShipmentConstraint) room(pack Pack, consignment *Consignment) uint64 {
+	room := uint64(math.MaxUint64)
+	if sc.MaxWeight > 0 && pack.Weight > 0 {
+		room = min(room, (sc.MaxWeight-min(sc.MaxWeight, consignment.Weight))/uint64(pack.Weight))
+	}
+	if sc.MaxVolume > 0 && pack.Volume > 0 {
+		room = min(room, (sc.MaxVolume-min(sc.MaxVolume, consignment.Volume))/uint64(pack.Volume))
+	}
+	return room
+}
+
+// Consign splits the packs of order into consignments that each respect
+// constraint.
+//
+// Finding the fewest consignments is a bin packing problem, so the packs
+// are placed first fit, heaviest and bulkiest first. This uses at most
+// about twice the consignments that are strictly needed. Packs of the same
+// size are placed together, which keeps the work proportional to the
+// number of pack sizes and consignments rather than the number of packs.
+func Consign(order InventoryOrder, constraint ShipmentConstraint) ([]Consignment, error) {
+	packs := make([]Pack, 0, len(order))
+	for pack := range order {
+		packs = append(packs, pack)
+	}
+	slices.SortFunc(packs, func(a, b Pack) int {
+		if a.Weight != b.Weight {
+			return cmp.Compare(b.Weight, a.Weight)
+		}
+		if a.Volume != b.Volume {
+			return cmp.Compare(b.Volume, a.Volume)
+		}
+		return cmp.Compare(b.Size, a.Size)
+	})
+
+	consignments := []Consignment{}
+	for _, pack := range packs {
+		empty := Consignment{Packs: map[uint]uint{}}
+		if constraint.room(pack, &empty) == 0 {
+			return nil, ErrPackExceedsShipment
+		}
+
+		remaining := uint64(order[pack])
+		for index := 0; remaining > 0; index++ {
+			if index == len(consignments) {
+				if len(consignments) == MAX_CONSIGNMENTS {
+					return nil, ErrTooManyConsignments
+				}
+				consignments = append(consignments, Consignment{Packs: map[uint]uint{}})
+			}
+
+			count := min(remaining, constraint.room(pack, &consignments[index]))
+			if count > 0 {
+				consignments[index].add(pack, uint(count))
+				remaining -= count
+			}
+		}
+	}
+
+	return consignments, nil
+}
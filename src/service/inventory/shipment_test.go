@@ -0,0 +1,51 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConsign(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250, Weight: 300}
+		pack2 = Pack{Type: item1, Size: 1000, Weight: 1000, Volume: 40}
+		pack3 = Pack{Type: item1, Size: 10}
+	)
+
+	t.Run("Consign()", func(t *testing.T) {
+		t.Run("Should keep every consignment within the limits", func(t *testing.T) {
+			order := InventoryOrder{pack1: 3, pack2: 3, pack3: 2}
+			constraint := ShipmentConstraint{MaxWeight: 2000, MaxVolume: 100}
+
+			consignments, err := Consign(order, constraint)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			var items uint
+			for _, consignment := range consignments {
+				if consignment.Weight > constraint.MaxWeight || consignment.Volume > constraint.MaxVolume {
+					assertEqual(t, constraint, consignment)
+				}
+				items += consignment.Items
+			}
+			if items != order.Items() {
+				assertEqual(t, order.Items(), items)
+			}
+			// 2x1000 weighs 2000, the third 1000 pack fills another
+			// consignment with 3x250, and the 10 packs weigh nothing.
+			if len(consignments) != 2 {
+				assertEqual(t, 2, len(consignments))
+			}
+		})
+
+		t.Run("Should not ship a pack that is over the limit", func(t *testing.T) {
+			order := InventoryOrder{pack2: 1}
+
+			_, err := Consign(order, ShipmentConstraint{MaxWeight: 500})
+			if !errors.Is(err, ErrPackExceedsShipment) {
+				assertEqual(t, ErrPackExceedsShipment, err)
+			}
+		})
+	})
+}
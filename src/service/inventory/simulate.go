@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// SimulatedOrder is how one pack set fulfills a count in a Simulation.
+type SimulatedOrder struct {
+	// Packs maps each pack size used to the number of packs of that size.
+	Packs map[uint]uint `json:"packs"`
+	// Items is the number of items the packs hold.
+	Items uint `json:"items"`
+	// Overshoot is the number of items beyond the count. It is negative
+	// when the packs do not cover the count.
+	Overshoot int `json:"overshoot"`
+	// PackCount is the number of packs.
+	PackCount uint `json:"packCount"`
+	// Error explains why the count could not be fulfilled.
+	Error *ErrorBody `json:"error,omitempty"`
+}
+
+// SimulationLine compares how the current and proposed pack sets fulfill
+// a count.
+type SimulationLine struct {
+	Count    int            `json:"count"`
+	Current  SimulatedOrder `json:"current"`
+	Proposed SimulatedOrder `json:"proposed"`
+}
+
+// SimulationTotals adds up the orders of a pack set in a Simulation.
+type SimulationTotals struct {
+	// Overshoot is the number of items sent beyond the count across the
+	// orders the packs cover.
+	Overshoot int `json:"overshoot"`
+	Packs     int `json:"packs"`
+	// Shortfall is the number of items missing across the orders the
+	// packs only partly fill.
+	Shortfall int `json:"shortfall"`
+}
+
+// add adds order to the totals.
+func (t *SimulationTotals) add(order SimulatedOrder) {
+	if order.Overshoot < 0 {
+		t.Shortfall -= order.Overshoot
+	} else {
+		t.Overshoot += order.Overshoot
+	}
+	t.Packs += int(order.PackCount)
+}
+
+// Simulation compares how the current and proposed pack sets of an item
+// fulfill a sample of counts.
+type Simulation struct {
+	Lines []SimulationLine `json:"lines"`
+	// Compared is the number of counts that both pack sets fulfilled.
+	// Only those counts are added to the totals.
+	Compared int              `json:"compared"`
+	Current  SimulationTotals `json:"current"`
+	Proposed SimulationTotals `json:"proposed"`
+	// Delta is the proposed totals minus the current totals, so negative
+	// numbers are improvements.
+	Delta SimulationTotals `json:"delta"`
+}
+
+// Simulate fulfills each of counts with the current pack set and with
+// proposed, using the strategy of each set. A proposal without a strategy
+// uses the strategy of the current set, and proposed packs without a type
+// hold the item of the current packs. Both sets are solved as if every
+// pack were in stock, so that only the pack sizes and their rules are
+// compared. Nothing is changed or persisted.
+func Simulate(current *PackSet, proposed PackSetJSONFormat, counts []int) (Simulation, error) {
+	if len(counts) == 0 {
+		return Simulation{}, fmt.Errorf("%w: no counts to simulate", ErrInvalidCount)
+	}
+	for _, count := range counts {
+		if count <= 0 {
+			return Simulation{}, ErrInvalidCount
+		}
+	}
+
+	if proposed.Strategy == "" {
+		proposed.Strategy = current.strategy
+	}
+	if len(current.values) > 0 {
+		packs := make([]Pack, 0, len(proposed.Packs))
+		for _, pack := range proposed.Packs {
+			if pack.Type.Id == uuid.Nil {
+				pack.Type = current.values[0].Type
+			}
+			packs = append(packs, pack)
+		}
+		proposed.Packs = packs
+	}
+	proposedSet, err := NewPackSetFromJSON(proposed)
+	if err != nil {
+		return Simulation{}, err
+	}
+
+	currentStrategy, err := GetStrategy(current.Strategy())
+	if err != nil {
+		return Simulation{}, err
+	}
+	proposedStrategy, err := GetStrategy(proposedSet.Strategy())
+	if err != nil {
+		return Simulation{}, err
+	}
+
+	simulation := Simulation{Lines: []SimulationLine{}}
+	for _, count := range counts {
+		line := SimulationLine{
+			Count:    count,
+			Current:  simulateOrder(currentStrategy, current.getPacks(), count),
+			Proposed: simulateOrder(proposedStrategy, proposedSet.getPacks(), count),
+		}
+		simulation.Lines = append(simulation.Lines, line)
+
+		if line.Current.Error != nil || line.Proposed.Error != nil {
+			continue
+		}
+		simulation.Compared++
+		simulation.Current.add(line.Current)
+		simulation.Proposed.add(line.Proposed)
+	}
+
+	simulation.Delta = SimulationTotals{
+		Overshoot: simulation.Proposed.Overshoot - simulation.Current.Overshoot,
+		Packs:     simulation.Proposed.Packs - simulation.Current.Packs,
+		Shortfall: simulation.Proposed.Shortfall - simulation.Current.Shortfall,
+	}
+
+	return simulation, nil
+}
+
+// simulateOrder fulfills count from packs with strategy, as if every pack
+// were in stock.
+func simulateOrder(strategy PackingStrategy, packs []Pack, count int) SimulatedOrder {
+	if len(packs) == 0 {
+		return SimulatedOrder{Packs: map[uint]uint{}, Error: newErrorBody(ErrNoPacks)}
+	}
+
+	inStock := make([]Pack, 0, len(packs))
+	for _, pack := range packs {
+		pack.TrackStock = false
+		inStock = append(inStock, pack)
+	}
+
+	order, err := strategy.Solve(inStock, count, nil)
+	if err != nil {
+		return SimulatedOrder{Packs: map[uint]uint{}, Error: newErrorBody(err)}
+	}
+
+	result := SimulatedOrder{Packs: order.bySize(), Items: order.Items()}
+	result.Overshoot = int(result.Items) - count
+	for _, packCount := range result.Packs {
+		result.PackCount += packCount
+	}
+	return result
+}
+
+// Simulate compares the packs of the item with itemID against proposed for
+// each of counts as described by the package level Simulate.
+func (i *Inventory) Simulate(itemID string, proposed PackSetJSONFormat, counts []int) (Simulation, error) {
+	log.Info("Simulate pack set start", "itemID", itemID, "counts", len(counts))
+
+	i.lock()
+	packSet, err := i.getPacksForItemByID(itemID)
+	if err != nil {
+		i.unLock()
+		return Simulation{}, err
+	}
+	current := NewPackSet()
+	current.strategy = packSet.strategy
+	for _, pack := range packSet.getPacks() {
+		current.Add(pack)
+	}
+	i.unLock()
+
+	simulation, err := Simulate(current, proposed, counts)
+	if err != nil {
+		log.Error("Failed to simulate pack set", "itemID", itemID, "error", err)
+		return Simulation{}, err
+	}
+
+	log.Info("Simulate pack set success", "itemID", itemID, "delta", simulation.Delta)
+	return simulation, nil
+}
@@ -0,0 +1,123 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250}
+		pack2 = Pack{Type: item1, Size: 500}
+		id    = item1.Id.String()
+
+		inv = Inventory{}
+	)
+
+	setup := func() {
+		ps := NewPackSet()
+		ps.Add(pack1)
+		ps.Add(pack2)
+
+		inv = Inventory{}
+		inv.data = ItemPackMap{}
+		inv.data[id] = *ps
+	}
+
+	t.Run("Inventory.Simulate()", func(t *testing.T) {
+		t.Run("Should compare the current and proposed packs", func(t *testing.T) {
+			setup()
+
+			proposed := PackSetJSONFormat{Packs: []Pack{{Size: 300}}}
+			simulation, err := inv.Simulate(id, proposed, []int{250, 600})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			// 250 is 1x250 now and 1x300 with the proposal; 600 is 1x500
+			// and 1x250 now and 2x300 with the proposal.
+			line := simulation.Lines[0]
+			if line.Current.Packs[250] != 1 || line.Proposed.Packs[300] != 1 {
+				assertEqual(t, "1x250 against 1x300", line)
+			}
+			if simulation.Current != (SimulationTotals{Overshoot: 150, Packs: 3}) {
+				assertEqual(t, SimulationTotals{Overshoot: 150, Packs: 3}, simulation.Current)
+			}
+			if simulation.Delta != (SimulationTotals{Overshoot: -100, Packs: 0}) {
+				assertEqual(t, SimulationTotals{Overshoot: -100, Packs: 0}, simulation.Delta)
+			}
+		})
+
+		t.Run("Should total partly filled counts apart from the overshoot", func(t *testing.T) {
+			setup()
+			ps := NewPackSet()
+			ps.Add(Pack{Type: item1, Size: 250, TrackStock: true, Stock: 1})
+			inv.data[id] = *ps
+
+			// Stock is left out, so 600 is 3x250 now; the proposal can
+			// only send one pack of 300.
+			proposed := PackSetJSONFormat{Packs: []Pack{{Size: 300, MaxQuantity: 1}}}
+			simulation, err := inv.Simulate(id, proposed, []int{600})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if simulation.Current != (SimulationTotals{Overshoot: 150, Packs: 3}) {
+				assertEqual(t, SimulationTotals{Overshoot: 150, Packs: 3}, simulation.Current)
+			}
+			if simulation.Proposed != (SimulationTotals{Packs: 1, Shortfall: 300}) {
+				assertEqual(t, SimulationTotals{Packs: 1, Shortfall: 300}, simulation.Proposed)
+			}
+			if simulation.Delta != (SimulationTotals{Overshoot: -150, Packs: -2, Shortfall: 300}) {
+				assertEqual(t, SimulationTotals{Overshoot: -150, Packs: -2, Shortfall: 300}, simulation.Delta)
+			}
+		})
+
+		t.Run("Should not change the item", func(t *testing.T) {
+			setup()
+
+			inv.Simulate(id, PackSetJSONFormat{Packs: []Pack{{Size: 300}}}, []int{250})
+
+			packs := inv.data[id].values
+			if len(packs) != 2 || packs[0] != pack1 || packs[1] != pack2 {
+				assertEqual(t, []Pack{pack1, pack2}, packs)
+			}
+		})
+
+		t.Run("Should report counts the proposal cannot fulfill", func(t *testing.T) {
+			setup()
+
+			simulation, err := inv.Simulate(id, PackSetJSONFormat{Packs: []Pack{}}, []int{250})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if simulation.Lines[0].Proposed.Error == nil || simulation.Compared != 0 {
+				assertEqual(t, "no_packs", simulation.Lines[0].Proposed.Error)
+			}
+		})
+
+		t.Run("Should return an error for invalid requests", func(t *testing.T) {
+			setup()
+
+			cases := []struct {
+				name     string
+				itemID   string
+				proposed PackSetJSONFormat
+				counts   []int
+				err      error
+			}{
+				{"unknown item", "unknown", PackSetJSONFormat{}, []int{1}, ErrItemNotFound},
+				{"no counts", id, PackSetJSONFormat{}, []int{}, ErrInvalidCount},
+				{"negative count", id, PackSetJSONFormat{}, []int{-1}, ErrInvalidCount},
+				{"unknown strategy", id, PackSetJSONFormat{Strategy: "unknown"}, []int{1}, ErrUnknownStrategy},
+				{"repeated pack", id, PackSetJSONFormat{Packs: []Pack{{Size: 300}, {Size: 300}}}, []int{1}, ErrPackAlreadyExists},
+			}
+
+			for _, tc := range cases {
+				_, err := inv.Simulate(tc.itemID, tc.proposed, tc.counts)
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+		})
+	})
+}
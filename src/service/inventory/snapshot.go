@@ -0,0 +1,535 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+const (
+	// SNAPSHOT_ID_FORMAT names snapshots after the time they were taken, so
+	// that their IDs sort in the order they were taken.
+	SNAPSHOT_ID_FORMAT = "20060102T150405.000000000Z"
+	// SNAPSHOT_DIR_MODE is the permission of the snapshot directory.
+	SNAPSHOT_DIR_MODE os.FileMode = 0o755
+)
+
+// SnapshotInfo describes a snapshot without its data.
+type SnapshotInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Reason says why the snapshot was taken, such as before an item was
+	// deleted.
+	Reason string `json:"reason"`
+	// Items is the number of items in the catalog of the snapshot.
+	Items int `json:"items"`
+	// ItemID is set on snapshots that hold only that item, such as those
+	// taken before it was changed. Restoring one changes only that item.
+	ItemID string `json:"itemId,omitempty"`
+	// Sequence is the sequence of the last Mutation the snapshot holds.
+	Sequence uint64 `json:"sequence"`
+	// BeforeChange is set on snapshots taken before a change that drops
+	// data, or before a restore. They are counted apart from the others,
+	// as described by SnapshotPolicy.
+	BeforeChange bool `json:"beforeChange,omitempty"`
+}
+
+// Snapshot is a copy of the whole inventory at a point in time, which the
+// inventory can be restored to.
+type Snapshot struct {
+	SnapshotInfo
+	Storage StorageJSONFormat `json:"storage"`
+}
+
+// SnapshotSchema is the schema of the snapshot files. The inventory in a
+// snapshot is in the latest version of StorageSchema, so a migration of
+// StorageSchema needs one here as well.
+var SnapshotSchema = store.Schema{Name: "snapshot"}
+
+// SnapshotFiles returns the store of the snapshot files in dir.
+func SnapshotFiles(dir string) *store.FileStore[string, Snapshot] {
+	snapshots := store.NewFileStore[string, Snapshot](dir)
+	snapshots.Schema = SnapshotSchema
+	return snapshots
+}
+
+// SnapshotInfoFiles returns the store of the snapshot files in dir read as
+// their SnapshotInfo, so that they can be listed without decoding the
+// inventory each one holds. It must only be read.
+func SnapshotInfoFiles(dir string) *store.FileStore[string, SnapshotInfo] {
+	infos := store.NewFileStore[string, SnapshotInfo](dir)
+	infos.Schema = SnapshotSchema
+	return infos
+}
+
+// Scope returns the part of storage that the snapshot holds: the item with
+// ItemID when it is set, or all of storage otherwise.
+func (info SnapshotInfo) Scope(storage *StorageJSONFormat) *StorageJSONFormat {
+	if info.ItemID == "" {
+		return storage
+	}
+
+	scoped := &StorageJSONFormat{Items: map[string]Item{}, Packs: map[string]StoredPackSet{}, Sequence: storage.Sequence}
+	if item, ok := storage.Items[info.ItemID]; ok {
+		scoped.Items[info.ItemID] = item
+	}
+	if packs, ok := storage.Packs[info.ItemID]; ok {
+		scoped.Packs[info.ItemID] = packs
+	}
+	return scoped
+}
+
+// SnapshotPolicy decides how often snapshots are taken and which of them
+// are kept.
+type SnapshotPolicy struct {
+	// Interval is how often a snapshot is taken while the inventory
+	// changes. Zero takes none on a schedule.
+	Interval time.Duration
+	// Keep is the number of the newest snapshots kept. Zero keeps every
+	// snapshot that is not older than MaxAge. Snapshots taken before a
+	// change are not counted, so that routine changes do not push out
+	// older restore points.
+	Keep int
+	// KeepBeforeChange is the number of the newest snapshots taken before
+	// a change that are kept. Zero keeps every one that is not older than
+	// MaxAge.
+	KeepBeforeChange int
+	// MaxAge is how long a snapshot is kept. Zero keeps snapshots whatever
+	// their age.
+	MaxAge time.Duration
+}
+
+// expired returns the snapshots in infos, newest first, that the policy
+// does not keep at now. The newest snapshot is always kept.
+func (p SnapshotPolicy) expired(infos []SnapshotInfo, now time.Time) []SnapshotInfo {
+	result := []SnapshotInfo{}
+	counted, countedBeforeChange := 0, 0
+	for index, info := range infos {
+		keep, position := p.Keep, &counted
+		if info.BeforeChange {
+			keep, position = p.KeepBeforeChange, &countedBeforeChange
+		}
+		*position++
+		if index == 0 {
+			continue
+		}
+		if (keep > 0 && *position > keep) || (p.MaxAge > 0 && now.Sub(info.CreatedAt) > p.MaxAge) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+// ListSnapshots returns the snapshots described in snapshotInfos, newest
+// first.
+func ListSnapshots(ctx context.Context, snapshotInfos store.Store[string, SnapshotInfo]) ([]SnapshotInfo, error) {
+	values, err := snapshotInfos.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []SnapshotInfo{}
+	for _, info := range values {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(a, b int) bool {
+		return infos[a].ID > infos[b].ID
+	})
+	return infos, nil
+}
+
+// GetSnapshot returns the snapshot with id from snapshots. It returns
+// ErrSnapshotNotFound when there is none.
+func GetSnapshot(ctx context.Context, snapshots store.Store[string, Snapshot], id string) (Snapshot, error) {
+	snapshot, err := snapshots.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInvalidKey) {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return snapshot, err
+}
+
+// openSnapshots keeps the snapshots of the inventory in dir.
+func (i *Inventory) openSnapshots(dir string) error {
+	if err := os.MkdirAll(dir, SNAPSHOT_DIR_MODE); err != nil {
+		log.Error("Failed to create snapshot directory", "dir", dir, "error", err)
+		return err
+	}
+
+	i.snapshots = SnapshotFiles(dir)
+	i.snapshotInfos = SnapshotInfoFiles(dir)
+	return nil
+}
+
+// saveSnapshot saves a snapshot of the inventory as it is now, or of only
+// the item with itemID when it is not empty, marked with beforeChange as
+// described by SnapshotInfo. It must be called with the Inventory lock
+// held.
+func (i *Inventory) saveSnapshot(ctx context.Context, reason string, beforeChange bool, itemID string) (Snapshot, error) {
+	if i.snapshots == nil {
+		return Snapshot{}, ErrSnapshotsDisabled
+	}
+
+	log.Info("Take inventory snapshot start", "reason", reason, "itemID", itemID, "sequence", i.sequence)
+	items, data := i.items, i.data
+	if itemID != "" {
+		items, data = map[string]Item{}, ItemPackMap{}
+		if item, ok := i.items[itemID]; ok {
+			items[itemID] = item
+		}
+		if packSet, ok := i.data[itemID]; ok {
+			data[itemID] = packSet
+		}
+	}
+
+	now := time.Now().UTC()
+	snapshot := Snapshot{
+		SnapshotInfo: SnapshotInfo{
+			ID:           now.Format(SNAPSHOT_ID_FORMAT),
+			CreatedAt:    now,
+			Reason:       reason,
+			Items:        len(items),
+			ItemID:       itemID,
+			Sequence:     i.sequence,
+			BeforeChange: beforeChange,
+		},
+		Storage: newStorageJSONFormat(items, data),
+	}
+	snapshot.Storage.Sequence = i.sequence
+
+	if err := i.snapshots.Set(ctx, snapshot.ID, snapshot); err != nil {
+		log.Error("Failed to save inventory snapshot", "reason", reason, "error", err)
+		return Snapshot{}, err
+	}
+	// Only a snapshot of the whole inventory holds every change so far.
+	if itemID == "" {
+		i.snapshotSequence = i.sequence
+	}
+
+	log.Info("Take inventory snapshot success", "snapshotID", snapshot.ID, "items", snapshot.Items)
+	return snapshot, nil
+}
+
+// snapshotBefore saves a snapshot of the item with itemID before a change
+// that drops data from it, so that the change can be undone. Nothing is
+// saved when snapshots are not kept. It must be called with the Inventory
+// lock held.
+func (i *Inventory) snapshotBefore(reason string, itemID string) error {
+	if i.snapshots == nil {
+		return nil
+	}
+
+	if _, err := i.saveSnapshot(context.Background(), reason, true, itemID); err != nil {
+		return fmt.Errorf("%w: %v", ErrPersistFailed, err)
+	}
+	i.inBackground(func() { i.pruneSnapshots(context.Background()) })
+	return nil
+}
+
+// TakeSnapshot saves a snapshot of the inventory as it is now, and removes
+// the snapshots that the retention policy does not keep.
+func (i *Inventory) TakeSnapshot(ctx context.Context, reason string) (SnapshotInfo, error) {
+	i.lock()
+	snapshot, err := i.saveSnapshot(ctx, reason, false, "")
+	i.unLock()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	i.pruneSnapshots(ctx)
+	return snapshot.SnapshotInfo, nil
+}
+
+// ListSnapshots returns the snapshots of the inventory, newest first.
+func (i *Inventory) ListSnapshots(ctx context.Context) ([]SnapshotInfo, error) {
+	if i.snapshots == nil {
+		return []SnapshotInfo{}, nil
+	}
+	return ListSnapshots(ctx, i.snapshotInfos)
+}
+
+// DiffSnapshot compares the snapshot with id to the snapshot with against,
+// or to the inventory as it is now when against is empty. The result
+// lists what changed since the snapshot was taken.
+func (i *Inventory) DiffSnapshot(ctx context.Context, id string, against string) (StorageDiff, error) {
+	if i.snapshots == nil {
+		return StorageDiff{}, ErrSnapshotsDisabled
+	}
+
+	from, err := GetSnapshot(ctx, i.snapshots, id)
+	if err != nil {
+		return StorageDiff{}, err
+	}
+	if against != "" {
+		to, err := GetSnapshot(ctx, i.snapshots, against)
+		if err != nil {
+			return StorageDiff{}, err
+		}
+		return DiffSnapshots(from, to), nil
+	}
+
+	i.lock()
+	current := Snapshot{Storage: newStorageJSONFormat(i.items, i.data)}
+	i.unLock()
+	return DiffSnapshots(from, current), nil
+}
+
+// DiffSnapshots compares the inventory in from to the one in to as
+// DiffStorage does, naming each by its ID. When either holds a single item,
+// only that item is compared.
+func DiffSnapshots(from Snapshot, to Snapshot) StorageDiff {
+	return DiffStorage(from.ID, to.Scope(&from.Storage), to.ID, from.Scope(&to.Storage))
+}
+
+// RestoreSnapshot replaces the inventory with the snapshot with id and
+// returns the snapshot of the inventory taken just before, which undoes
+// the restore. The items, packs and stock of the snapshot are swapped in
+// at once, so requests see the inventory either before or after it. A
+// snapshot of a single item only replaces that item.
+//
+// Orders are kept. ErrItemInUse is returned when an item that the
+// snapshot does not hold has open orders, since they may still take packs
+// out of stock.
+func (i *Inventory) RestoreSnapshot(ctx context.Context, id string) (SnapshotInfo, error) {
+	log.Info("Restore inventory snapshot start", "snapshotID", id)
+	if i.snapshots == nil {
+		return SnapshotInfo{}, ErrSnapshotsDisabled
+	}
+
+	snapshot, err := GetSnapshot(ctx, i.snapshots, id)
+	if err != nil {
+		log.Error("Failed to load inventory snapshot", "snapshotID", id, "error", err)
+		return SnapshotInfo{}, err
+	}
+	items, data := snapshot.Storage.catalog()
+
+	i.lock()
+	for _, order := range i.orders {
+		if snapshot.ItemID != "" && order.ItemID != snapshot.ItemID {
+			continue
+		}
+		if _, ok := items[order.ItemID]; !ok && order.isOpen() {
+			i.unLock()
+			return SnapshotInfo{}, fmt.Errorf("%w: order %s is %s", ErrItemInUse, order.Id, order.State)
+		}
+	}
+
+	backup, err := i.saveSnapshot(ctx, "before restoring snapshot "+id, true, snapshot.ItemID)
+	if err != nil {
+		i.unLock()
+		return SnapshotInfo{}, fmt.Errorf("%w: %v", ErrPersistFailed, err)
+	}
+
+	if snapshot.ItemID != "" {
+		err = i.restoreItemSnapshot(snapshot.ItemID, items, data)
+	} else {
+		err = i.restoreStorageSnapshot(&backup.Storage, items, data)
+	}
+	i.unLock()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if snapshot.ItemID == "" {
+		go i.rebuildCaches()
+	} else if _, ok := items[snapshot.ItemID]; ok {
+		go i.rebuildCache(snapshot.ItemID)
+	}
+	i.pruneSnapshots(ctx)
+
+	log.Info("Restore inventory snapshot success", "snapshotID", id, "backupID", backup.ID, "items", len(items))
+	return backup.SnapshotInfo, nil
+}
+
+// restoreStorageSnapshot replaces the whole inventory with items and data,
+// which previous held before. It must be called with the Inventory lock
+// held.
+func (i *Inventory) restoreStorageSnapshot(previous *StorageJSONFormat, items map[string]Item, data ItemPackMap) error {
+	previousItems, previousData := i.items, i.data
+	i.items, i.data = items, data
+	if err := i.logRestore(previous); err != nil {
+		i.items, i.data = previousItems, previousData
+		return err
+	}
+	for itemID := range previousData {
+		if _, ok := data[itemID]; !ok {
+			i.cache.drop(itemID)
+		}
+	}
+	return nil
+}
+
+// restoreItemSnapshot replaces the item with itemID with the one in items
+// and data, and removes it when they do not hold it. It must be called
+// with the Inventory lock held.
+func (i *Inventory) restoreItemSnapshot(itemID string, items map[string]Item, data ItemPackMap) error {
+	if i.items == nil {
+		i.items = map[string]Item{}
+	}
+	if i.data == nil {
+		i.data = ItemPackMap{}
+	}
+
+	before := i.itemState(itemID)
+	kind := MUTATION_ITEM_REPLACED
+	if item, ok := items[itemID]; ok {
+		i.items[itemID] = item
+	} else {
+		delete(i.items, itemID)
+		kind = MUTATION_ITEM_DELETED
+	}
+	if packSet, ok := data[itemID]; ok {
+		i.data[itemID] = packSet
+	} else {
+		delete(i.data, itemID)
+	}
+	if err := i.logMutation(kind, itemID, before); err != nil {
+		return err
+	}
+	if kind == MUTATION_ITEM_DELETED {
+		i.cache.drop(itemID)
+	}
+	return nil
+}
+
+// pruneSnapshots removes the snapshots that the retention policy does not
+// keep.
+func (i *Inventory) pruneSnapshots(ctx context.Context) {
+	infos, err := i.ListSnapshots(ctx)
+	if err != nil {
+		log.Error("Failed to list inventory snapshots", "error", err)
+		return
+	}
+
+	for _, info := range i.snapshotPolicy.expired(infos, time.Now()) {
+		err := i.snapshots.Delete(ctx, info.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Error("Failed to remove inventory snapshot", "snapshotID", info.ID, "error", err)
+			continue
+		}
+		log.Info("Removed inventory snapshot", "snapshotID", info.ID, "createdAt", info.CreatedAt)
+	}
+}
+
+// runSnapshots takes a snapshot every interval when the inventory changed
+// since the last one, until ctx is done.
+func (i *Inventory) runSnapshots(ctx context.Context, interval time.Duration) {
+	if i.snapshots == nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.lock()
+			changed := i.sequence != i.snapshotSequence
+			i.unLock()
+			if changed {
+				i.TakeSnapshot(ctx, "scheduled")
+			}
+		}
+	}
+}
+
+// ItemDiff describes how an item differs between two states of the
+// inventory.
+type ItemDiff struct {
+	ItemID string `json:"itemId"`
+	// Before and After are the item in each state. Before is nil for an
+	// added item and After is nil for a removed one.
+	Before *Item `json:"before,omitempty"`
+	After  *Item `json:"after,omitempty"`
+	// StrategyChanged is set when the item is packed with another
+	// strategy.
+	StrategyChanged bool `json:"strategyChanged,omitempty"`
+	// AddedPacks, RemovedPacks and ChangedPacks list the sizes of the packs
+	// that were added, removed or changed, such as in price or stock.
+	AddedPacks   []uint `json:"addedPacks,omitempty"`
+	RemovedPacks []uint `json:"removedPacks,omitempty"`
+	ChangedPacks []uint `json:"changedPacks,omitempty"`
+}
+
+// StorageDiff lists how the items in one state of the inventory differ
+// from those in another.
+type StorageDiff struct {
+	// From and To name the states compared. An empty name is the inventory
+	// as it is now.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Added lists the items only in To, Removed the items only in From and
+	// Changed the items that differ, ordered by ID.
+	Added   []ItemDiff `json:"added"`
+	Removed []ItemDiff `json:"removed"`
+	Changed []ItemDiff `json:"changed"`
+}
+
+// DiffStorage compares the inventory in from, named fromName, to the one in
+// to, named toName.
+func DiffStorage(fromName string, from *StorageJSONFormat, toName string, to *StorageJSONFormat) StorageDiff {
+	diff := StorageDiff{From: fromName, To: toName, Added: []ItemDiff{}, Removed: []ItemDiff{}, Changed: []ItemDiff{}}
+
+	for id, after := range to.Items {
+		after := after
+		before, ok := from.Items[id]
+		if !ok {
+			diff.Added = append(diff.Added, ItemDiff{ItemID: id, After: &after})
+			continue
+		}
+
+		itemDiff := diffPacks(id, from.Packs[id], to.Packs[id])
+		if before != after || itemDiff.StrategyChanged || len(itemDiff.AddedPacks)+len(itemDiff.RemovedPacks)+len(itemDiff.ChangedPacks) > 0 {
+			itemDiff.Before, itemDiff.After = &before, &after
+			diff.Changed = append(diff.Changed, itemDiff)
+		}
+	}
+	for id, before := range from.Items {
+		before := before
+		if _, ok := to.Items[id]; !ok {
+			diff.Removed = append(diff.Removed, ItemDiff{ItemID: id, Before: &before})
+		}
+	}
+
+	for _, list := range [][]ItemDiff{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(list, func(a, b int) bool {
+			return list[a].ItemID < list[b].ItemID
+		})
+	}
+	return diff
+}
+
+// diffPacks compares the packs of the item with id in before to those in
+// after.
+func diffPacks(id string, before StoredPackSet, after StoredPackSet) ItemDiff {
+	diff := ItemDiff{ItemID: id, StrategyChanged: before.Strategy != after.Strategy}
+
+	beforeBySize := map[uint]StoredPack{}
+	for _, pack := range before.Packs {
+		beforeBySize[pack.Size] = pack
+	}
+	afterBySize := map[uint]StoredPack{}
+	for _, pack := range after.Packs {
+		afterBySize[pack.Size] = pack
+		previous, ok := beforeBySize[pack.Size]
+		if !ok {
+			diff.AddedPacks = append(diff.AddedPacks, pack.Size)
+		} else if previous != pack {
+			diff.ChangedPacks = append(diff.ChangedPacks, pack.Size)
+		}
+	}
+	for _, pack := range before.Packs {
+		if _, ok := afterBySize[pack.Size]; !ok {
+			diff.RemovedPacks = append(diff.RemovedPacks, pack.Size)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,317 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	var (
+		id  = item1.Id.String()
+		id2 = item2.Id.String()
+		ctx = context.Background()
+	)
+
+	// setup returns an inventory that keeps its snapshots in a temporary
+	// directory.
+	setup := func() *Inventory {
+		inv := &Inventory{}
+		if err := inv.openSnapshots(t.TempDir()); err != nil {
+			assertEqual(t, NO_ERROR, err)
+		}
+		inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+		return inv
+	}
+
+	t.Run("Inventory.TakeSnapshot()", func(t *testing.T) {
+		t.Run("Should list snapshots newest first", func(t *testing.T) {
+			inv := setup()
+			first, err := inv.TakeSnapshot(ctx, "first")
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			inv.AddPack(id, Pack{Size: 500})
+			second, _ := inv.TakeSnapshot(ctx, "second")
+
+			infos, err := inv.ListSnapshots(ctx)
+			if err != nil || len(infos) != 2 || infos[0] != second || infos[1] != first {
+				assertEqual(t, []SnapshotInfo{second, first}, infos)
+			}
+			if second.Items != 1 || second.Sequence != inv.sequence {
+				assertEqual(t, "snapshot of 1 item", second)
+			}
+		})
+
+		t.Run("Should remove the snapshots the policy does not keep", func(t *testing.T) {
+			inv := setup()
+			inv.snapshotPolicy = SnapshotPolicy{Keep: 2}
+			inv.TakeSnapshot(ctx, "first")
+			second, _ := inv.TakeSnapshot(ctx, "second")
+			third, _ := inv.TakeSnapshot(ctx, "third")
+
+			infos, _ := inv.ListSnapshots(ctx)
+			if len(infos) != 2 || infos[0] != third || infos[1] != second {
+				assertEqual(t, []SnapshotInfo{third, second}, infos)
+			}
+		})
+	})
+
+	t.Run("SnapshotPolicy.expired()", func(t *testing.T) {
+		t.Run("Should keep the newest snapshots within the age", func(t *testing.T) {
+			now := time.Now()
+			infos := []SnapshotInfo{
+				{ID: "d", CreatedAt: now.Add(-3 * time.Hour)},
+				{ID: "c", CreatedAt: now.Add(-4 * time.Hour)},
+				{ID: "b", CreatedAt: now.Add(-5 * time.Hour)},
+				{ID: "a", CreatedAt: now.Add(-6 * time.Hour)},
+			}
+			cases := []struct {
+				policy   SnapshotPolicy
+				expected string
+			}{
+				{SnapshotPolicy{}, "[]"},
+				{SnapshotPolicy{Keep: 2}, "[b a]"},
+				{SnapshotPolicy{MaxAge: 4*time.Hour + time.Minute}, "[b a]"},
+				{SnapshotPolicy{Keep: 3, MaxAge: 5*time.Hour + time.Minute}, "[a]"},
+				// The newest snapshot is kept whatever its age.
+				{SnapshotPolicy{MaxAge: time.Hour}, "[c b a]"},
+			}
+
+			for _, tc := range cases {
+				ids := []string{}
+				for _, info := range tc.policy.expired(infos, now) {
+					ids = append(ids, info.ID)
+				}
+				if fmt.Sprint(ids) != tc.expected {
+					t.Fatalf("%+v: expected: %+v; got: %+v", tc.policy, tc.expected, ids)
+				}
+			}
+		})
+
+		t.Run("Should count snapshots taken before a change apart from the others", func(t *testing.T) {
+			now := time.Now()
+			infos := []SnapshotInfo{
+				{ID: "e", CreatedAt: now.Add(-time.Hour), BeforeChange: true},
+				{ID: "d", CreatedAt: now.Add(-2 * time.Hour), BeforeChange: true},
+				{ID: "c", CreatedAt: now.Add(-3 * time.Hour)},
+				{ID: "b", CreatedAt: now.Add(-4 * time.Hour)},
+				{ID: "a", CreatedAt: now.Add(-5 * time.Hour), BeforeChange: true},
+			}
+			cases := []struct {
+				policy   SnapshotPolicy
+				expected string
+			}{
+				{SnapshotPolicy{Keep: 1}, "[b]"},
+				{SnapshotPolicy{Keep: 2}, "[]"},
+				{SnapshotPolicy{Keep: 2, MaxAge: 90 * time.Minute}, "[d c b a]"},
+				{SnapshotPolicy{KeepBeforeChange: 1}, "[d a]"},
+				{SnapshotPolicy{Keep: 1, KeepBeforeChange: 2}, "[b a]"},
+			}
+
+			for _, tc := range cases {
+				ids := []string{}
+				for _, info := range tc.policy.expired(infos, now) {
+					ids = append(ids, info.ID)
+				}
+				if fmt.Sprint(ids) != tc.expected {
+					t.Fatalf("%+v: expected: %+v; got: %+v", tc.policy, tc.expected, ids)
+				}
+			}
+		})
+	})
+
+	t.Run("Inventory.snapshotBefore()", func(t *testing.T) {
+		t.Run("Should keep the inventory from before destructive changes", func(t *testing.T) {
+			inv := setup()
+			inv.AddPack(id, Pack{Size: 500})
+			inv.RemovePack(id, 500)
+			inv.DeleteItem(id)
+
+			infos, _ := inv.ListSnapshots(ctx)
+			if len(infos) != 2 || infos[0].Items != 1 || infos[1].Items != 1 || !infos[0].BeforeChange {
+				assertEqual(t, "snapshots before removing a pack and deleting the item", infos)
+			}
+			snapshot, _ := GetSnapshot(ctx, inv.snapshots, infos[1].ID)
+			if len(snapshot.Storage.Packs[id].Packs) != 2 {
+				assertEqual(t, 2, len(snapshot.Storage.Packs[id].Packs))
+			}
+		})
+
+		t.Run("Should only keep the item that changes", func(t *testing.T) {
+			inv := setup()
+			inv.CreateItem(item2, PackSetJSONFormat{Packs: []Pack{{Size: 10}}})
+			inv.DeleteItem(id)
+
+			infos, _ := inv.ListSnapshots(ctx)
+			if len(infos) != 1 || infos[0].ItemID != id || infos[0].Items != 1 {
+				assertEqual(t, "snapshot of item1", infos)
+			}
+			snapshot, _ := GetSnapshot(ctx, inv.snapshots, infos[0].ID)
+			if _, ok := snapshot.Storage.Items[id2]; ok || len(snapshot.Storage.Items) != 1 {
+				assertEqual(t, "only item1", snapshot.Storage.Items)
+			}
+		})
+	})
+
+	t.Run("Inventory.RestoreSnapshot()", func(t *testing.T) {
+		t.Run("Should swap in the inventory of the snapshot", func(t *testing.T) {
+			inv := setup()
+			snapshot, _ := inv.TakeSnapshot(ctx, "before changes")
+			inv.AddPack(id, Pack{Size: 500})
+			inv.CreateItem(item2, PackSetJSONFormat{})
+
+			backup, err := inv.RestoreSnapshot(ctx, snapshot.ID)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item, _ := inv.GetItem(id); len(item.Packs) != 1 {
+				assertEqual(t, 1, len(item.Packs))
+			}
+			if _, err := inv.GetItem(id2); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+
+			// The backup undoes the restore.
+			if _, err := inv.RestoreSnapshot(ctx, backup.ID); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item, _ := inv.GetItem(id); len(item.Packs) != 2 {
+				assertEqual(t, 2, len(item.Packs))
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+
+		t.Run("Should save the restored inventory", func(t *testing.T) {
+			inv, storagePath, walPath := openNewStorage(t)
+			snapshotPath := filepath.Join(filepath.Dir(storagePath), "snapshots")
+			inv.openSnapshots(snapshotPath)
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			snapshot, _ := inv.TakeSnapshot(ctx, "before changes")
+			inv.DeleteItem(id)
+			inv.CreateItem(item2, PackSetJSONFormat{})
+			if _, err := inv.RestoreSnapshot(ctx, snapshot.ID); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			inv.wal.Close()
+
+			reopened := openStorage(t, storagePath, walPath)
+			reopened.openSnapshots(snapshotPath)
+			if item, err := reopened.GetItem(id); err != nil || len(item.Packs) != 1 {
+				assertEqual(t, "item1 with 1 pack", item)
+			}
+			if _, err := reopened.GetItem(id2); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+
+		t.Run("Should refuse while a removed item has open orders", func(t *testing.T) {
+			inv := setup()
+			snapshot, _ := inv.TakeSnapshot(ctx, "before item2")
+			inv.CreateItem(item2, PackSetJSONFormat{Packs: []Pack{{Size: 10}}})
+			if _, err := inv.CreateOrder(id2, 10, true); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if _, err := inv.RestoreSnapshot(ctx, snapshot.ID); !errors.Is(err, ErrItemInUse) {
+				assertEqual(t, ErrItemInUse, err)
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+
+		t.Run("Should only replace the item of a snapshot of one item", func(t *testing.T) {
+			inv := setup()
+			inv.AddPack(id, Pack{Size: 500})
+			inv.CreateItem(item2, PackSetJSONFormat{Packs: []Pack{{Size: 10}}})
+			inv.DeleteItem(id)
+			infos, _ := inv.ListSnapshots(ctx)
+
+			backup, err := inv.RestoreSnapshot(ctx, infos[0].ID)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item, _ := inv.GetItem(id); len(item.Packs) != 2 {
+				assertEqual(t, 2, len(item.Packs))
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			// The backup holds the item as it was deleted, so it undoes the
+			// restore by removing the item again.
+			if backup.ItemID != id || backup.Items != 0 {
+				assertEqual(t, "backup without item1", backup)
+			}
+			if _, err := inv.RestoreSnapshot(ctx, backup.ID); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if _, err := inv.GetItem(id); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+			if _, err := inv.GetItem(id2); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+		})
+
+		t.Run("Should return an error for an unknown snapshot", func(t *testing.T) {
+			inv := setup()
+			if _, err := inv.RestoreSnapshot(ctx, "missing"); !errors.Is(err, ErrSnapshotNotFound) {
+				assertEqual(t, ErrSnapshotNotFound, err)
+			}
+		})
+	})
+
+	t.Run("DiffSnapshots()", func(t *testing.T) {
+		t.Run("Should only compare the item of a snapshot of one item", func(t *testing.T) {
+			from := Snapshot{
+				SnapshotInfo: SnapshotInfo{ID: "a", ItemID: id},
+				Storage:      StorageJSONFormat{Items: map[string]Item{id: item1}},
+			}
+			to := Snapshot{Storage: StorageJSONFormat{Items: map[string]Item{id2: item2}}}
+
+			diff := DiffSnapshots(from, to)
+			if len(diff.Added) != 0 || len(diff.Removed) != 1 || diff.Removed[0].ItemID != id || len(diff.Changed) != 0 {
+				assertEqual(t, "item1 removed", diff)
+			}
+		})
+	})
+
+	t.Run("DiffStorage()", func(t *testing.T) {
+		t.Run("Should list added, removed and changed items", func(t *testing.T) {
+			changed := item1
+			changed.Price++
+			from := StorageJSONFormat{
+				Items: map[string]Item{id: item1, id2: item2},
+				Packs: map[string]StoredPackSet{
+					id: {Packs: []StoredPack{{ItemID: item1.Id, Size: 250}, {ItemID: item1.Id, Size: 500, Stock: 1}}},
+				},
+			}
+			to := StorageJSONFormat{
+				Items: map[string]Item{id: changed},
+				Packs: map[string]StoredPackSet{
+					id: {Packs: []StoredPack{{ItemID: item1.Id, Size: 500, Stock: 2}, {ItemID: item1.Id, Size: 1000}}},
+				},
+			}
+
+			diff := DiffStorage("a", &from, "", &to)
+			if len(diff.Added) != 0 || len(diff.Removed) != 1 || diff.Removed[0].ItemID != id2 || len(diff.Changed) != 1 {
+				assertEqual(t, "item2 removed and item1 changed", diff)
+			}
+			item := diff.Changed[0]
+			if *item.Before != item1 || *item.After != changed || fmt.Sprint(item.AddedPacks, item.RemovedPacks, item.ChangedPacks) != "[1000] [250] [500]" {
+				assertEqual(t, "price and packs of item1 changed", item)
+			}
+
+			if diff := DiffStorage("a", &from, "b", &from); len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+				assertEqual(t, "no differences", diff)
+			}
+		})
+	})
+}
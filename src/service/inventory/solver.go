@@ -0,0 +1,442 @@
+package inventory
+
+import (
+	"slices"
+)
+
+// unreachable marks a total in a packTable that cannot be made up from
+// any combination of packs.
+const unreachable = -1
+
+// packWeight returns the cost of adding a single pack to a combination.
+type packWeight func(pack Pack) uint64
+
+// countPacks weighs every pack the same, so the cheapest combination is
+// the one with the fewest packs.
+func countPacks(Pack) uint64 {
+	return 1
+}
+
+// packTable is a dynamic programming table over every total between 0 and
+// limit. For each total, it records the cheapest combination of packs that
+// adds up to that total exactly. Combinations that cost the same are told
+// apart by their number of packs.
+//
+// The table is built one pack at a time, and used records how many of
+// each pack the best combination holds at that point. This makes it
+// possible to walk back from any total to the packs that produced it, and
+// to limit how many of each pack can be used.
+type packTable struct {
+	packs    []Pack
+	cost     []uint64
+	minPacks []int64
+	used     [][]int32
+}
+
+// newPackTable builds a packTable for totals up to and including limit.
+func newPackTable(packs []Pack, limit int, weight packWeight) *packTable {
+	table := &packTable{
+		packs:    packs,
+		cost:     make([]uint64, limit+1),
+		minPacks: make([]int64, limit+1),
+		used:     make([][]int32, len(packs)),
+	}
+
+	// Before any pack is added, only an empty combination exists.
+	for total := 1; total <= limit; total++ {
+		table.minPacks[total] = unreachable
+	}
+
+	previous := &packTable{
+		cost:     make([]uint64, limit+1),
+		minPacks: make([]int64, limit+1),
+	}
+	for index, pack := range packs {
+		// Keep the table as it was before this pack so that each total is
+		// built from combinations without it.
+		copy(previous.cost, table.cost)
+		copy(previous.minPacks, table.minPacks)
+
+		table.used[index] = make([]int32, limit+1)
+		table.addPack(previous, index, pack, limit, weight(pack))
+	}
+
+	return table
+}
+
+// windowKey orders the combinations a pack can be added to. Adding q packs
+// raises the cost and pack count in proportion to q, so subtracting that
+// share for the position of each total lets combinations at different
+// totals be compared directly.
+type windowKey struct {
+	cost  int64
+	packs int64
+}
+
+func (a windowKey) less(b windowKey) bool {
+	return a.cost < b.cost || (a.cost == b.cost && a.packs < b.packs)
+}
+
+// addPack updates the table with combinations that use the pack at index
+// between the least and most times that are allowed.
+//
+// A pack with a quantity step is added a step at a time, as if the step
+// were a single larger pack. The totals that the pack can take a
+// combination to are then one stride apart, so they are visited in runs
+// that share a remainder. Along a run, the best combination to add the
+// pack to is the cheapest one within a sliding window of positions, which
+// a monotonic queue keeps track of.
+func (pt *packTable) addPack(previous *packTable, index int, pack Pack, limit int, weight uint64) {
+	least, most, ok := pack.quantityRange()
+	if !ok {
+		return
+	}
+
+	// Positions and quantities along a run are counted in steps.
+	step := int(pack.step())
+	stride := int(pack.Size) * step
+	leastSteps, mostSteps := int(least)/step, limit/stride
+	if allowed := most / uint(step); allowed < uint(mostSteps) {
+		mostSteps = int(allowed)
+	}
+	if leastSteps > mostSteps {
+		return
+	}
+	stepWeight := weight * uint64(step)
+
+	queue := make([]int, 0, limit/stride+1)
+	for remainder := 0; remainder < stride && remainder <= limit; remainder++ {
+		key := func(position int) windowKey {
+			total := remainder + position*stride
+			return windowKey{
+				cost:  int64(previous.cost[total]) - int64(position)*int64(stepWeight),
+				packs: previous.minPacks[total] - int64(position)*int64(step),
+			}
+		}
+
+		queue = queue[:0]
+		for position := 0; remainder+position*stride <= limit; position++ {
+			total := remainder + position*stride
+
+			// The window holds positions least to most steps back.
+			if entering := position - leastSteps; entering >= 0 && previous.minPacks[remainder+entering*stride] != unreachable {
+				for len(queue) > 0 && !key(queue[len(queue)-1]).less(key(entering)) {
+					queue = queue[:len(queue)-1]
+				}
+				queue = append(queue, entering)
+			}
+			for len(queue) > 0 && queue[0] < position-mostSteps {
+				queue = queue[1:]
+			}
+			if len(queue) == 0 {
+				continue
+			}
+
+			from := queue[0]
+			quantity := (position - from) * step
+			source := remainder + from*stride
+			cost := previous.cost[source] + uint64(quantity)*weight
+			packCount := previous.minPacks[source] + int64(quantity)
+
+			if pt.minPacks[total] == unreachable || cost < pt.cost[total] ||
+				(cost == pt.cost[total] && packCount < pt.minPacks[total]) {
+				pt.cost[total] = cost
+				pt.minPacks[total] = packCount
+				pt.used[index][total] = int32(quantity)
+			}
+		}
+	}
+}
+
+// reachable reports whether total can be made up from the packs.
+func (pt *packTable) reachable(total int) bool {
+	return total >= 0 && total < len(pt.minPacks) && pt.minPacks[total] != unreachable
+}
+
+// limit returns the largest total held by the table.
+func (pt *packTable) limit() int {
+	return len(pt.minPacks) - 1
+}
+
+// order walks back from total to the packs that make it up.
+func (pt *packTable) order(total int) InventoryOrder {
+	result := InventoryOrder{}
+	for index := len(pt.packs) - 1; index >= 0 && total > 0; index-- {
+		quantity := pt.used[index][total]
+		if quantity > 0 {
+			pack := pt.packs[index]
+			result[pack] += uint(quantity)
+			total -= int(quantity) * int(pack.Size)
+		}
+	}
+
+	return result
+}
+
+// candidate is a total that the packs can make up exactly, along with the
+// cost and number of packs of the cheapest combination for it.
+type candidate struct {
+	total int
+	cost  uint64
+	packs int64
+}
+
+// candidate returns the candidate for total.
+func (pt *packTable) candidate(total int) candidate {
+	return candidate{total: total, cost: pt.cost[total], packs: pt.minPacks[total]}
+}
+
+// covering returns a candidate for every total from count up to the limit
+// of the table that can be made up from the packs.
+func (pt *packTable) covering(count int) []candidate {
+	candidates := []candidate{}
+	for total := count; total <= pt.limit(); total++ {
+		if pt.reachable(total) {
+			candidates = append(candidates, pt.candidate(total))
+		}
+	}
+
+	return candidates
+}
+
+// shortfall returns the candidate that ships the most items below count. It
+// is used when the packs in stock cannot cover count.
+func (pt *packTable) shortfall(count int) (candidate, bool) {
+	for total := min(count-1, pt.limit()); total > 0; total-- {
+		if pt.reachable(total) {
+			return pt.candidate(total), true
+		}
+	}
+
+	return candidate{}, false
+}
+
+// solverTables holds a slot for each table in use, so that no more than
+// MAX_CONCURRENT_SOLVER_TABLES are held in memory at once.
+var solverTables = make(chan struct{}, MAX_CONCURRENT_SOLVER_TABLES)
+
+// buildPackTable builds the table needed to fulfill count from packs.
+//
+// Any combination worth shipping holds fewer than count plus the largest
+// pack size items. If it held more, removing any one of its packs would
+// still cover count with less overshoot, fewer packs and no extra cost.
+// This bounds the table the solver has to build.
+//
+// Quantity rules can stop a single pack from being removed. A pack that is
+// held at least its minimum plus one step can still lose a step of packs,
+// and one that is held less than that can lose all of them, so the largest
+// pack size is widened to the most items either of those removes.
+func buildPackTable(packs []Pack, count int, weight packWeight) (*packTable, error) {
+	var largest uint
+	for _, pack := range packs {
+		least, _, _ := pack.quantityRange()
+		largest = max(largest, pack.Size*(least+pack.step()-1))
+	}
+	if largest == 0 {
+		return nil, ErrNoPacks
+	}
+
+	limit := count + int(largest) - 1
+	if limit > MAX_SOLVER_TABLE_SIZE {
+		return nil, ErrOrderTooLarge
+	}
+
+	solverTables <- struct{}{}
+	return newPackTable(packs, limit, weight), nil
+}
+
+// release gives back the slot taken by buildPackTable. The table must not
+// be used afterwards.
+func (pt *packTable) release() {
+	<-solverTables
+}
+
+// objective describes what a strategy minimises when it picks one of the
+// candidates that cover an order.
+type objective struct {
+	// rule describes the objective in a SolverTrace.
+	rule string
+	// weight is the cost of each pack.
+	weight packWeight
+	// less reports whether a is preferred over b.
+	less func(a, b candidate) bool
+}
+
+var (
+	// minimalOvershoot ships as few items beyond the count as possible and
+	// then uses the fewest packs.
+	minimalOvershoot = objective{
+		rule:   RULE_MINIMAL_OVERSHOOT,
+		weight: countPacks,
+		less: func(a, b candidate) bool {
+			return a.total < b.total || (a.total == b.total && a.packs < b.packs)
+		},
+	}
+
+	// fewestPacks uses as few packs as possible and then ships as few items
+	// beyond the count as possible.
+	fewestPacks = objective{
+		rule:   RULE_FEWEST_PACKS,
+		weight: countPacks,
+		less: func(a, b candidate) bool {
+			return a.packs < b.packs || (a.packs == b.packs && a.total < b.total)
+		},
+	}
+
+	// lowestPrice charges as little as possible for the packs, then ships
+	// as few items beyond the count as possible and then uses the fewest
+	// packs.
+	lowestPrice = objective{
+		rule:   RULE_LOWEST_PRICE,
+		weight: packPrice,
+		less: func(a, b candidate) bool {
+			if a.cost != b.cost {
+				return a.cost < b.cost
+			}
+			return a.total < b.total || (a.total == b.total && a.packs < b.packs)
+		},
+	}
+)
+
+// solve returns the packs that fulfill count and are preferred by goal.
+//
+// When the packs in stock cannot cover count, the order ships as many
+// items as it can instead. When trace is not nil, it records the
+// candidates that were considered and why the packs were chosen.
+func solve(packs []Pack, count int, goal objective, trace *SolverTrace) (InventoryOrder, error) {
+	if count <= 0 {
+		return InventoryOrder{}, nil
+	}
+
+	// Large orders are mostly filled with one pack so that only the rest
+	// has to be solved exactly.
+	bulk, bulkCount := bulkFill(packs, count, goal.weight)
+	remainder := count - bulkCount*int(bulk.Size)
+
+	table, err := buildPackTable(packs, remainder, goal.weight)
+	if err != nil {
+		return InventoryOrder{}, err
+	}
+	defer table.release()
+	order := func(total int) InventoryOrder {
+		result := table.order(total)
+		if bulkCount > 0 {
+			result[bulk] += uint(bulkCount)
+		}
+		return result
+	}
+
+	rule := goal.rule
+	candidates := table.covering(remainder)
+	if len(candidates) == 0 {
+		rule = RULE_SHORTFALL
+		if best, ok := table.shortfall(remainder); ok {
+			candidates = append(candidates, best)
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case goal.less(a, b):
+			return -1
+		case goal.less(b, a):
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	result := InventoryOrder{}
+	if len(candidates) > 0 {
+		result = order(candidates[0].total)
+	}
+
+	if trace != nil {
+		trace.Rule = rule
+		if bulkCount > 0 {
+			trace.Bulk = map[uint]uint{bulk.Size: uint(bulkCount)}
+		}
+		trace.Considered = len(candidates)
+		trace.Candidates = []TraceCandidate{}
+		for _, candidate := range candidates[:min(len(candidates), MAX_TRACE_CANDIDATES)] {
+			trace.Candidates = append(trace.Candidates, newTraceCandidate(order(candidate.total), count))
+		}
+		trace.Chosen = newTraceCandidate(result, count)
+	}
+
+	return result, nil
+}
+
+// bulkFill returns the pack that fills the bulk of an order for count
+// items and how many of it can be set aside before the rest of the order
+// is solved exactly. The number is zero when nothing can be set aside.
+//
+// The bulk pack is the one that costs the least for each item it holds,
+// which is the largest pack when every pack weighs the same. Say it holds
+// B items. If a best combination held B/gcd(s, B) or more packs of some
+// other size s, swapping those for s/gcd(s, B) bulk packs would keep the
+// same total at a lower cost or with fewer packs. So every best
+// combination holds fewer than B/gcd(s, B) packs of each other size s, and
+// those packs add up to at most a window of items. Everything beyond the
+// window is bulk packs, and setting them aside gives exactly the same
+// answer as solving the whole order.
+//
+// Packs with a quantity step are swapped a step at a time, and packs with
+// a minimum quantity can keep up to that many more packs when swapping
+// would leave them under it, so the window grows to include those.
+//
+// This only holds when the bulk pack does not track its stock and has no
+// quantity rules, so orders for those items are always solved in full. It
+// also stops helping when pack sizes share few factors with the bulk pack
+// and the window itself is larger than MAX_SOLVER_TABLE_SIZE, in which case
+// ErrOrderTooLarge is returned for large orders.
+func bulkFill(packs []Pack, count int, weight packWeight) (Pack, int) {
+	var bulk Pack
+	for _, pack := range packs {
+		if _, _, ok := pack.quantityRange(); !ok {
+			continue
+		}
+
+		// Compare the cost per item of both packs without dividing.
+		packCost := weight(pack) * uint64(bulk.Size)
+		bulkCost := weight(bulk) * uint64(pack.Size)
+		if bulk.Size == 0 || packCost < bulkCost || (packCost == bulkCost && pack.Size > bulk.Size) {
+			bulk = pack
+		}
+	}
+	if bulk.Size == 0 || bulk.TrackStock || bulk.hasRules() {
+		return bulk, 0
+	}
+
+	var window uint64
+	for _, pack := range packs {
+		if pack.Size == 0 || pack.key() == bulk.key() {
+			continue
+		}
+
+		least, _, _ := pack.quantityRange()
+		stride := pack.Size * pack.step()
+		steps := uint64(bulk.Size/gcd(stride, bulk.Size) - 1)
+		if leastSteps := least / pack.step(); leastSteps > 1 {
+			steps += uint64(leastSteps)
+		}
+
+		window += steps * uint64(stride)
+		if window > MAX_SOLVER_TABLE_SIZE {
+			return bulk, 0
+		}
+	}
+
+	if uint64(count) <= window {
+		return bulk, 0
+	}
+	return bulk, int((uint64(count) - window) / uint64(bulk.Size))
+}
+
+// gcd returns the greatest common divisor of a and b.
+func gcd(a, b uint) uint {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
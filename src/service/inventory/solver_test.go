@@ -0,0 +1,406 @@
+package inventory
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// packCase is a randomly generated set of pack sizes and an order count.
+// Stock, when set, holds the number of each pack on hand, with -1 for an
+// unlimited supply. Rules, when set, holds the minimum, maximum and step
+// quantity of each pack.
+type packCase struct {
+	Sizes []uint
+	Stock []int
+	Rules [][3]uint
+	Count int
+}
+
+// Generate implements quick.Generator so that quick.Check produces pack
+// sets small enough to be checked by brute force.
+func (packCase) Generate(rand *rand.Rand, size int) reflect.Value {
+	seen := map[uint]bool{}
+	sizes := []uint{}
+	for n := 1 + rand.Intn(4); len(sizes) < n; {
+		packSize := uint(1 + rand.Intn(60))
+		if !seen[packSize] {
+			seen[packSize] = true
+			sizes = append(sizes, packSize)
+		}
+	}
+
+	// Half of the cases limit the stock of some packs.
+	var stock []int
+	if rand.Intn(2) == 0 {
+		for range sizes {
+			stock = append(stock, rand.Intn(8)-1)
+		}
+	}
+
+	// A third of the cases set quantity rules on the packs.
+	var rules [][3]uint
+	if rand.Intn(3) == 0 {
+		for range sizes {
+			step := uint(1 + rand.Intn(3))
+			least := step * uint(rand.Intn(3))
+			most := uint(0)
+			if rand.Intn(2) == 0 {
+				most = least + step*uint(1+rand.Intn(3))
+			}
+			rules = append(rules, [3]uint{least, most, step})
+		}
+	}
+
+	return reflect.ValueOf(packCase{Sizes: sizes, Stock: stock, Rules: rules, Count: 1 + rand.Intn(300)})
+}
+
+func (pc packCase) packs() []Pack {
+	packs := []Pack{}
+	for index, size := range pc.Sizes {
+		pack := Pack{Type: item1, Size: size}
+		if index < len(pc.Stock) && pc.Stock[index] >= 0 {
+			pack.TrackStock = true
+			pack.Stock = uint(pc.Stock[index])
+		}
+		if index < len(pc.Rules) {
+			pack.MinQuantity = pc.Rules[index][0]
+			pack.MaxQuantity = pc.Rules[index][1]
+			pack.QuantityStep = pc.Rules[index][2]
+		}
+		packs = append(packs, pack)
+	}
+	return packs
+}
+
+// bruteForce tries every combination of packs that could cover count and
+// returns the least overshoot and, for that overshoot, the fewest packs.
+// When the stock cannot cover count, the overshoot is negative and as
+// close to zero as the stock allows.
+func bruteForce(packs []Pack, count int) (overshoot int, packCount int) {
+	found := false
+	better := func(total, used int) bool {
+		if !found {
+			return true
+		}
+		// Covering the count always beats falling short of it.
+		if (total >= count) != (overshoot >= 0) {
+			return total >= count
+		}
+		difference := total - count
+		if difference < 0 {
+			difference = -difference
+		}
+		current := overshoot
+		if current < 0 {
+			current = -current
+		}
+		return difference < current || (difference == current && used < packCount)
+	}
+
+	var search func(index, total, used int)
+	search = func(index, total, used int) {
+		if total >= count || index == len(packs) {
+			if better(total, used) {
+				found, overshoot, packCount = true, total-count, used
+			}
+			return
+		}
+
+		// Skip the current pack or use it as many times as its stock and
+		// rules allow before moving on.
+		search(index+1, total, used)
+
+		size := int(packs[index].Size)
+		least, most, ok := packs[index].quantityRange()
+		for n := least; ok && n <= most; n += packs[index].step() {
+			search(index+1, total+int(n)*size, used+int(n))
+			if total+int(n)*size >= count {
+				break
+			}
+		}
+	}
+	search(0, 0, 0)
+
+	return overshoot, packCount
+}
+
+func summarize(order InventoryOrder, count int) (overshoot int, packCount int) {
+	total := 0
+	for pack, frequency := range order {
+		total += int(pack.Size) * int(frequency)
+		packCount += int(frequency)
+	}
+	return total - count, packCount
+}
+
+func TestSolver(t *testing.T) {
+	t.Run("buildPackTable()", func(t *testing.T) {
+		t.Run("Should refuse a table over the solver budget", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{MAX_SOLVER_TABLE_SIZE}}.packs()
+
+			if _, err := buildPackTable(packs, 2, minimalOvershoot.weight); err != ErrOrderTooLarge {
+				assertEqual(t, ErrOrderTooLarge, err)
+			}
+		})
+
+		t.Run("Should wait for a table to be released when all are in use", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500}}.packs()
+
+			tables := []*packTable{}
+			for len(tables) < MAX_CONCURRENT_SOLVER_TABLES {
+				table, err := buildPackTable(packs, 1000, minimalOvershoot.weight)
+				if err != nil {
+					assertEqual(t, NO_ERROR, err)
+				}
+				tables = append(tables, table)
+			}
+
+			built := make(chan *packTable)
+			go func() {
+				table, _ := buildPackTable(packs, 1000, minimalOvershoot.weight)
+				built <- table
+			}()
+
+			select {
+			case <-built:
+				t.Fatal("expected the table to wait for a free slot")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			tables[0].release()
+			select {
+			case table := <-built:
+				table.release()
+			case <-time.After(time.Second):
+				t.Fatal("expected the table to be built once a slot was freed")
+			}
+			for _, table := range tables[1:] {
+				table.release()
+			}
+		})
+	})
+
+	t.Run("solve()", func(t *testing.T) {
+		t.Run("Should match brute force on random pack sets", func(t *testing.T) {
+			property := func(pc packCase) bool {
+				order, err := solve(pc.packs(), pc.Count, minimalOvershoot, nil)
+				if err != nil {
+					t.Logf("case %+v: unexpected error %v", pc, err)
+					return false
+				}
+
+				expectedOvershoot, expectedPacks := bruteForce(pc.packs(), pc.Count)
+				actualOvershoot, actualPacks := summarize(order, pc.Count)
+				if expectedOvershoot != actualOvershoot || expectedPacks != actualPacks {
+					t.Logf("case %+v: expected overshoot %d in %d packs; got overshoot %d in %d packs",
+						pc, expectedOvershoot, expectedPacks, actualOvershoot, actualPacks)
+					return false
+				}
+				return true
+			}
+
+			if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run("Should find the exact fit for 23, 31 and 53", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{23, 31, 53}}.packs()
+
+			order, err := solve(packs, 500000, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			overshoot, packCount := summarize(order, 500000)
+			if overshoot != 0 {
+				assertEqual(t, 0, overshoot)
+			}
+			if packCount != 9438 {
+				assertEqual(t, 9438, packCount)
+			}
+		})
+
+		t.Run("Should prefer less overshoot over fewer packs", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 280, 300}}.packs()
+
+			order, err := solve(packs, 530, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if order[packs[0]] != 1 || order[packs[1]] != 1 || len(order) != 2 {
+				assertEqual(t, "1x250 1x280", order)
+			}
+		})
+
+		t.Run("Should fall back to other packs when a size runs out", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000}, Stock: []int{-1, 0, 1}}.packs()
+
+			// 1x500 would fit 500 exactly, but there are none left.
+			order, err := solve(packs, 500, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[0]] != 2 || len(order) != 1 {
+				assertEqual(t, "2x250", order)
+			}
+		})
+
+		t.Run("Should ship what is in stock when the order cannot be covered", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500}, Stock: []int{1, 2}}.packs()
+
+			order, err := solve(packs, 2000, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order.Items() != 1250 {
+				assertEqual(t, 1250, order.Items())
+			}
+		})
+
+		t.Run("Should explain the candidates it considered", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000, 2000, 5000}}.packs()
+
+			trace := &SolverTrace{}
+			order, err := solve(packs, 12001, minimalOvershoot, trace)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			if trace.Rule != RULE_MINIMAL_OVERSHOOT {
+				assertEqual(t, RULE_MINIMAL_OVERSHOOT, trace.Rule)
+			}
+			if trace.Chosen.Overshoot != 249 || trace.Chosen.PackCount != 4 {
+				assertEqual(t, "overshoot 249 in 4 packs", trace.Chosen)
+			}
+			if trace.Chosen.Items != order.Items() || trace.Candidates[0].Items != order.Items() {
+				assertEqual(t, order.Items(), trace.Chosen.Items)
+			}
+			// Every multiple of 250 from 12250 to 17000 was considered.
+			if trace.Considered != 20 {
+				assertEqual(t, 20, trace.Considered)
+			}
+		})
+
+		t.Run("Should match the full solve when packs are set aside for large orders", func(t *testing.T) {
+			property := func(sizes [3]uint8, rules [3]uint8, count uint16) bool {
+				packs := []Pack{}
+				seen := map[uint]bool{}
+				for index, size := range sizes {
+					packSize := uint(size%30) + 1
+					if !seen[packSize] {
+						seen[packSize] = true
+
+						// Some packs are sold in steps and with a minimum.
+						step := uint(rules[index]%3) + 1
+						least := step * uint(rules[index]/3%3)
+						packs = append(packs, Pack{Type: item1, Size: packSize, Price: uint64(index) + 1, MinQuantity: least, QuantityStep: step})
+					}
+				}
+
+				// Tracking stock on every pack stops any from being set
+				// aside, so the whole order is solved.
+				full := []Pack{}
+				for _, pack := range packs {
+					pack.TrackStock = true
+					pack.Stock = uint(count) + 1
+					full = append(full, pack)
+				}
+
+				for _, goal := range []objective{minimalOvershoot, fewestPacks, lowestPrice} {
+					expected, _ := solve(full, int(count)+1, goal, nil)
+					actual, err := solve(packs, int(count)+1, goal, nil)
+					if err != nil {
+						t.Logf("sizes %v rules %v count %d: unexpected error %v", sizes, rules, count, err)
+						return false
+					}
+
+					_, expectedPacks := summarize(expected, 0)
+					_, actualPacks := summarize(actual, 0)
+					if expected.Items() != actual.Items() || expectedPacks != actualPacks || expected.Price() != actual.Price() {
+						t.Logf("sizes %v rules %v count %d: expected %d items in %d packs for %d; got %d items in %d packs for %d",
+							sizes, rules, count, expected.Items(), expectedPacks, expected.Price(), actual.Items(), actualPacks, actual.Price())
+						return false
+					}
+				}
+				return true
+			}
+
+			if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		t.Run("Should solve a billion items", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000, 2000, 5000}}.packs()
+
+			trace := &SolverTrace{}
+			order, err := solve(packs, 1000000001, minimalOvershoot, trace)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			overshoot, packCount := summarize(order, 1000000001)
+			if overshoot != 249 {
+				assertEqual(t, 249, overshoot)
+			}
+			if packCount != 200001 {
+				assertEqual(t, 200001, packCount)
+			}
+			if trace.Bulk[5000] == 0 {
+				assertEqual(t, "packs of 5000 set aside", trace.Bulk)
+			}
+		})
+
+		t.Run("Should follow the quantity rules of each pack", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 5000}, Rules: [][3]uint{{0, 0, 2}, {0, 3, 0}}}.packs()
+
+			// At most 3 of the 5000 pack, and the rest in pairs of 250.
+			order, err := solve(packs, 16001, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[1]] != 3 || order[packs[0]] != 6 || len(order) != 2 {
+				assertEqual(t, "3x5000 6x250", order)
+			}
+		})
+
+		t.Run("Should ship more than needed to reach a minimum quantity", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250}, Rules: [][3]uint{{3, 0, 0}}}.packs()
+
+			order, err := solve(packs, 1, minimalOvershoot, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[0]] != 3 {
+				assertEqual(t, 3, order[packs[0]])
+			}
+		})
+
+		t.Run("Should return an error when there are no packs", func(t *testing.T) {
+			_, err := solve([]Pack{}, 10, minimalOvershoot, nil)
+			if err != ErrNoPacks {
+				assertEqual(t, ErrNoPacks, err)
+			}
+		})
+	})
+}
+
+func BenchmarkSolve(b *testing.B) {
+	packs := packCase{Sizes: []uint{23, 31, 53, 250, 500, 1000, 2000, 5000}}.packs()
+
+	for _, count := range []int{1000, 1000000, 1000000000} {
+		b.Run(strconv.Itoa(count), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if _, err := solve(packs, count, minimalOvershoot, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
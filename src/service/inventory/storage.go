@@ -0,0 +1,282 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"eikcalb.dev/shark/src/store"
+	"github.com/google/uuid"
+)
+
+// StoredPack is the representation of a Pack in storage. It refers to its
+// Item by ID, and the Item itself is kept once in the catalog.
+type StoredPack struct {
+	ItemID       uuid.UUID `json:"itemId"`
+	Size         uint      `json:"size"`
+	Price        uint64    `json:"price,omitempty"`
+	Weight       uint      `json:"weight,omitempty"`
+	Volume       uint      `json:"volume,omitempty"`
+	TrackStock   bool      `json:"trackStock,omitempty"`
+	Stock        uint      `json:"stock,omitempty"`
+	MinQuantity  uint      `json:"minQuantity,omitempty"`
+	MaxQuantity  uint      `json:"maxQuantity,omitempty"`
+	QuantityStep uint      `json:"quantityStep,omitempty"`
+}
+
+// newStoredPack returns the representation of pack in storage.
+func newStoredPack(pack Pack) StoredPack {
+	return StoredPack{
+		ItemID:       pack.Type.Id,
+		Size:         pack.Size,
+		Price:        pack.Price,
+		Weight:       pack.Weight,
+		Volume:       pack.Volume,
+		TrackStock:   pack.TrackStock,
+		Stock:        pack.Stock,
+		MinQuantity:  pack.MinQuantity,
+		MaxQuantity:  pack.MaxQuantity,
+		QuantityStep: pack.QuantityStep,
+	}
+}
+
+// pack returns the Pack that holds item.
+func (sp StoredPack) pack(item Item) Pack {
+	return Pack{
+		Type:         item,
+		Size:         sp.Size,
+		Price:        sp.Price,
+		Weight:       sp.Weight,
+		Volume:       sp.Volume,
+		TrackStock:   sp.TrackStock,
+		Stock:        sp.Stock,
+		MinQuantity:  sp.MinQuantity,
+		MaxQuantity:  sp.MaxQuantity,
+		QuantityStep: sp.QuantityStep,
+	}
+}
+
+// StoredPackSet is the representation of a PackSet in storage.
+type StoredPackSet struct {
+	// Strategy is the name of the PackingStrategy used for the item.
+	Strategy string `json:"strategy,omitempty"`
+	// Packs holds every pack in the set.
+	Packs []StoredPack `json:"packs"`
+}
+
+// StorageJSONFormat is the representation of the inventory in storage.
+type StorageJSONFormat struct {
+	// Items is the catalog of every item, keyed by Item.Id.
+	Items map[string]Item `json:"items"`
+	// Packs holds the packs of each item, keyed by Item.Id.
+	Packs map[string]StoredPackSet `json:"packs"`
+	// Sequence is the sequence of the last Mutation that the data holds.
+	Sequence uint64 `json:"sequence,omitempty"`
+
+	// migrated is set when the data was loaded from an older version of
+	// StorageSchema and should be saved again.
+	migrated bool
+}
+
+// SetMigratedFrom marks the data as loaded from an older version of
+// StorageSchema.
+func (f *StorageJSONFormat) SetMigratedFrom(version int) {
+	f.migrated = true
+}
+
+// StorageSchema is the schema of the inventory storage file. Migrations
+// are only ever added to the end.
+var StorageSchema = store.Schema{
+	Name: "storage",
+	Migrations: []store.Migration{
+		{Version: 1, Description: "keep items in a catalog and refer to them from packs by ID", Migrate: migrateToCatalog},
+	},
+}
+
+// StorageFile returns the store of the inventory storage file at path
+// along with its key.
+func StorageFile(path string) (*store.FileStore[string, StorageJSONFormat], string) {
+	storage, key := store.ForFile[StorageJSONFormat](path)
+	storage.Schema = StorageSchema
+	return storage, key
+}
+
+// migrateToCatalog converts data stored as an InventoryJSONFormat object,
+// which is how the inventory was stored before the catalog existed and
+// every pack held a copy of its item. Data that already has a catalog is
+// left as it is.
+func migrateToCatalog(data json.RawMessage) (json.RawMessage, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	_, hasItems := keys["items"]
+	_, hasPacks := keys["packs"]
+	if hasItems || hasPacks || len(keys) == 0 {
+		return data, nil
+	}
+
+	var legacy InventoryJSONFormat
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	return json.Marshal(migrateStorage(legacy))
+}
+
+// migrateStorage converts the inventory from the format used before the
+// catalog existed.
+//
+// Each item is taken from its first pack. The key of the item is what
+// orders and requests use, so when a pack names another item ID, or the
+// packs of an item disagree about its details, the key and the first pack
+// win and the difference is logged.
+func migrateStorage(legacy InventoryJSONFormat) StorageJSONFormat {
+	log.Info("Migrate storage to item catalog start", "items", len(legacy))
+
+	result := StorageJSONFormat{
+		Items: map[string]Item{},
+		Packs: map[string]StoredPackSet{},
+	}
+	for id, packSetJSON := range legacy {
+		itemID, err := uuid.Parse(id)
+		if err != nil {
+			log.Error("Failed to migrate item with an ID that is not a UUID, will skip", "itemID", id, "error", err)
+			continue
+		}
+
+		item := Item{Id: itemID}
+		if len(packSetJSON.Packs) > 0 {
+			item = packSetJSON.Packs[0].Type
+			if item.Id != itemID {
+				log.Error("Item ID of pack does not match its key, will use key", "itemID", id, "packItemID", item.Id)
+				item.Id = itemID
+			}
+		}
+
+		stored := StoredPackSet{Strategy: packSetJSON.Strategy, Packs: []StoredPack{}}
+		for _, pack := range packSetJSON.Packs {
+			pack.Type.Id = itemID
+			if pack.Type != item {
+				log.Error("Pack holds a different copy of its item, will use the first", "itemID", id, "pack", pack)
+			}
+			pack.Type = item
+			stored.Packs = append(stored.Packs, newStoredPack(pack))
+		}
+
+		result.Items[id] = item
+		result.Packs[id] = stored
+	}
+
+	log.Info("Migrate storage to item catalog end", "items", len(result.Items))
+	return result
+}
+
+// newStorageJSONFormat returns the representation in storage of the
+// catalog items and the packs in data.
+func newStorageJSONFormat(items map[string]Item, data ItemPackMap) StorageJSONFormat {
+	result := StorageJSONFormat{
+		Items: map[string]Item{},
+		Packs: map[string]StoredPackSet{},
+	}
+	for id, item := range items {
+		result.Items[id] = item
+	}
+	for id, packSet := range data {
+		result.Packs[id] = newStoredPackSet(packSet)
+	}
+
+	return result
+}
+
+// newStoredPackSet returns the representation of packSet in storage.
+func newStoredPackSet(packSet PackSet) StoredPackSet {
+	stored := StoredPackSet{Strategy: packSet.strategy, Packs: []StoredPack{}}
+	for _, pack := range packSet.values {
+		stored.Packs = append(stored.Packs, newStoredPack(pack))
+	}
+	return stored
+}
+
+// PackSet returns the PackSet of the item with itemID, with every pack
+// holding the item from the catalog. It returns ErrItemNotFound when the
+// item is not in the catalog. An unknown strategy or a pack that cannot be
+// added is logged and left out, so that one bad entry does not stop the
+// rest of the inventory from loading.
+func (f *StorageJSONFormat) PackSet(itemID string) (*PackSet, error) {
+	item, ok := f.Items[itemID]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+
+	stored := f.Packs[itemID]
+	packSet := NewPackSet()
+	if err := packSet.SetStrategy(stored.Strategy); err != nil {
+		log.Error("Failed to set packing strategy, will use default", "strategy", stored.Strategy, "error", err)
+	}
+	for _, storedPack := range stored.Packs {
+		if storedPack.ItemID != item.Id {
+			log.Error("Stored pack refers to another item, will use its key", "itemID", itemID, "packItemID", storedPack.ItemID)
+		}
+
+		pack := storedPack.pack(item)
+		log.Info("Add new pack to inventory", "pack", pack)
+		if err := packSet.Add(pack); err != nil {
+			log.Error("Failed to add new pack to inventory", "pack", pack, "error", err)
+		}
+	}
+	packSet.Sort()
+
+	return packSet, nil
+}
+
+// validate returns ErrInvalidStorage listing every entry of the data that
+// cannot be loaded as it is. Loading skips such entries instead, so that
+// one bad entry does not stop the service from starting.
+func (f *StorageJSONFormat) validate() error {
+	problems := []string{}
+	for id, item := range f.Items {
+		if _, err := uuid.Parse(id); err != nil {
+			problems = append(problems, fmt.Sprintf("item %s: key is not a UUID", id))
+			continue
+		}
+		if item.Id.String() != id {
+			problems = append(problems, fmt.Sprintf("item %s: ID %s does not match its key", id, item.Id))
+		}
+		// Items without a name are loaded as they are, since the service
+		// saves them when they were migrated from packs without one.
+	}
+
+	for id, stored := range f.Packs {
+		item, ok := f.Items[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("packs of %s: item is not in the catalog", id))
+			continue
+		}
+
+		packSet := NewPackSet()
+		if err := packSet.SetStrategy(stored.Strategy); err != nil {
+			problems = append(problems, fmt.Sprintf("packs of %s: %v", id, err))
+		}
+		for _, storedPack := range stored.Packs {
+			// Packs may leave out the item they hold.
+			if storedPack.ItemID != uuid.Nil && storedPack.ItemID != item.Id {
+				problems = append(problems, fmt.Sprintf("pack %d of %s: holds item %s", storedPack.Size, id, storedPack.ItemID))
+			}
+			if storedPack.Size == 0 {
+				problems = append(problems, fmt.Sprintf("pack of %s: size must be greater than zero", id))
+				continue
+			}
+			if err := packSet.Add(storedPack.pack(item)); err != nil {
+				problems = append(problems, fmt.Sprintf("pack %d of %s: %v", storedPack.Size, id, err))
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%w: %s", ErrInvalidStorage, strings.Join(problems, "; "))
+}
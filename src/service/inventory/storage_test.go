@@ -0,0 +1,177 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStorage(t *testing.T) {
+	var (
+		pack1 = Pack{Type: item1, Size: 250, Price: 100}
+		pack2 = Pack{Type: item1, Size: 500, TrackStock: true, Stock: 3}
+		id    = item1.Id.String()
+	)
+
+	// load saves content as the storage file and loads it.
+	load := func(t *testing.T, content []byte) StorageJSONFormat {
+		path := filepath.Join(t.TempDir(), "storage.json")
+		os.WriteFile(path, content, 0o644)
+
+		storage, key := StorageFile(path)
+		stored, err := storage.Get(context.Background(), key)
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+		}
+		return stored
+	}
+
+	t.Run("StorageSchema", func(t *testing.T) {
+		t.Run("Should migrate packs that hold copies of their item", func(t *testing.T) {
+			legacy, _ := json.Marshal(InventoryJSONFormat{
+				id: {Strategy: "fewest-packs", Packs: []Pack{pack1, pack2}},
+			})
+
+			stored := load(t, legacy)
+			if !stored.migrated {
+				assertEqual(t, true, stored.migrated)
+			}
+			if stored.Items[id] != item1 {
+				assertEqual(t, item1, stored.Items[id])
+			}
+			packs := stored.Packs[id]
+			if packs.Strategy != "fewest-packs" || len(packs.Packs) != 2 || packs.Packs[1] != newStoredPack(pack2) {
+				assertEqual(t, []StoredPack{newStoredPack(pack1), newStoredPack(pack2)}, packs)
+			}
+		})
+
+		t.Run("Should use the key when a pack names another item", func(t *testing.T) {
+			legacy, _ := json.Marshal(InventoryJSONFormat{
+				id: {Packs: []Pack{{Type: item2, Size: 250}}},
+			})
+
+			stored := load(t, legacy)
+			if stored.Items[id].Id != item1.Id || stored.Packs[id].Packs[0].ItemID != item1.Id {
+				assertEqual(t, item1.Id, stored.Items[id].Id)
+			}
+			if stored.Items[id].Name != item2.Name {
+				assertEqual(t, item2.Name, stored.Items[id].Name)
+			}
+		})
+
+		t.Run("Should read unversioned catalog data as it is", func(t *testing.T) {
+			expected := newStorageJSONFormat(map[string]Item{id: item1}, ItemPackMap{})
+			data, _ := json.Marshal(expected)
+
+			stored := load(t, data)
+			if !stored.migrated || len(stored.Items) != 1 || stored.Items[id] != item1 {
+				assertEqual(t, expected, stored)
+			}
+		})
+
+		t.Run("Should not migrate data saved with the latest version", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			storage, key := StorageFile(path)
+			storage.Set(context.Background(), key, newStorageJSONFormat(map[string]Item{id: item1}, ItemPackMap{}))
+
+			stored, err := storage.Get(context.Background(), key)
+			if err != nil || stored.migrated || stored.Items[id] != item1 {
+				assertEqual(t, "data as it was saved", stored)
+			}
+		})
+	})
+
+	t.Run("StorageJSONFormat.PackSet()", func(t *testing.T) {
+		t.Run("Should give every pack the item from the catalog", func(t *testing.T) {
+			renamed := item1
+			renamed.Name = "Ankle Boot"
+			stored := StorageJSONFormat{
+				Items: map[string]Item{id: renamed},
+				Packs: map[string]StoredPackSet{
+					id: {Packs: []StoredPack{newStoredPack(pack2), newStoredPack(pack1)}},
+				},
+			}
+
+			packSet, err := stored.PackSet(id)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			packs := packSet.getPacks()
+			if len(packs) != 2 || packs[0].Size != 250 || packs[0].Type != renamed || packs[1].Type != renamed {
+				assertEqual(t, "250 and 500 holding the renamed item", packs)
+			}
+		})
+
+		t.Run("Should return an error for items not in the catalog", func(t *testing.T) {
+			stored := StorageJSONFormat{}
+
+			_, err := stored.PackSet(id)
+			if !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+	})
+
+	t.Run("Inventory.unserialize()", func(t *testing.T) {
+		t.Run("Should load the catalog and the packs of each item", func(t *testing.T) {
+			ps := NewPackSet()
+			ps.Add(pack1)
+			ps.Add(pack2)
+			stored := newStorageJSONFormat(map[string]Item{id: item1, item2.Id.String(): item2}, ItemPackMap{id: *ps})
+
+			inv := Inventory{}
+			inv.unserialize(&stored)
+
+			if len(inv.items) != 2 || inv.items[item2.Id.String()] != item2 {
+				assertEqual(t, stored.Items, inv.items)
+			}
+			packs := inv.data[id].values
+			if len(packs) != 2 || packs[0] != pack1 || packs[1] != pack2 {
+				assertEqual(t, []Pack{pack1, pack2}, packs)
+			}
+			if serialized := *inv.serialize(ItemFilter{}); len(serialized[item2.Id.String()].Packs) != 0 {
+				assertEqual(t, "item without packs", serialized)
+			}
+		})
+	})
+
+	t.Run("Inventory.SetPacks()", func(t *testing.T) {
+		t.Run("Should add new items to the catalog", func(t *testing.T) {
+			inv := Inventory{}
+
+			err := inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{pack1, {Size: 500}}})
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if inv.items[id] != item1 || inv.data[id].values[1].Type != item1 {
+				assertEqual(t, item1, inv.items[id])
+			}
+		})
+
+		t.Run("Should return an error for packs of another item", func(t *testing.T) {
+			cases := []struct {
+				name   string
+				itemID string
+				packs  []Pack
+				err    error
+			}{
+				{"item ID not a UUID", "unknown", []Pack{{Size: 250}}, ErrInvalidRequest},
+				{"pack of another item", id, []Pack{{Type: item2, Size: 250}}, ErrItemMismatch},
+				{"pack of nil item", uuid.Nil.String(), []Pack{{Type: item1, Size: 250}}, ErrItemMismatch},
+			}
+
+			for _, tc := range cases {
+				inv := Inventory{}
+				err := inv.SetPacks(tc.itemID, PackSetJSONFormat{Packs: tc.packs})
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, tc.err, err)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,268 @@
+package inventory
+
+import (
+	"slices"
+)
+
+const (
+	STRATEGY_GREEDY            = "greedy"
+	STRATEGY_MINIMAL_OVERSHOOT = "minimal-overshoot"
+	STRATEGY_FEWEST_PACKS      = "fewest-packs"
+	STRATEGY_CHEAPEST          = "cheapest-total-price"
+
+	// DEFAULT_STRATEGY is used for items that do not name a strategy.
+	DEFAULT_STRATEGY = STRATEGY_MINIMAL_OVERSHOOT
+)
+
+// PackingStrategy decides which packs are used to fulfill an order.
+type PackingStrategy interface {
+	// Name is the identifier of the strategy in storage and requests.
+	Name() string
+	// Solve returns the packs used to fulfill count items from packs.
+	// The packs are sorted by size in ascending order. Packs that track
+	// their stock must not be used more times than they are in stock, and
+	// when stock cannot cover count, the order ships as much as it can.
+	// When trace is not nil, the strategy records how it chose the packs.
+	Solve(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error)
+}
+
+// strategies holds every PackingStrategy that can be selected by name.
+var strategies = map[string]PackingStrategy{
+	STRATEGY_GREEDY:            greedyStrategy{},
+	STRATEGY_MINIMAL_OVERSHOOT: minimalOvershootStrategy{},
+	STRATEGY_FEWEST_PACKS:      fewestPacksStrategy{},
+	STRATEGY_CHEAPEST:          cheapestStrategy{},
+}
+
+// strategyAliases maps names that strategies were once registered with to
+// the names they have now, so that stored pack sets and callers using them
+// keep working.
+var strategyAliases = map[string]string{
+	"cheapest": STRATEGY_CHEAPEST,
+}
+
+// objectiveStrategy is implemented by strategies that rank combinations
+// of packs with an objective.
+type objectiveStrategy interface {
+	objective() objective
+}
+
+// exactObjective returns the objective used to pick between combinations
+// that fill a count exactly for strategy. Strategies without an objective
+// use minimalOvershoot, which picks the fewest packs since every exact fit
+// has the same overshoot.
+func exactObjective(strategy PackingStrategy) objective {
+	if ranked, ok := strategy.(objectiveStrategy); ok {
+		return ranked.objective()
+	}
+	return minimalOvershoot
+}
+
+// GetStrategy returns the PackingStrategy registered with name or with
+// one of its aliases. An empty name selects the default strategy.
+func GetStrategy(name string) (PackingStrategy, error) {
+	if name == "" {
+		name = DEFAULT_STRATEGY
+	}
+	if alias, ok := strategyAliases[name]; ok {
+		name = alias
+	}
+
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, ErrUnknownStrategy
+	}
+
+	return strategy, nil
+}
+
+// greedyStrategy walks the packs from the largest down and fills as much
+// of the order as it can with each one.
+//
+// This is how orders were originally processed. It is fast but gives
+// poor answers for some pack sizes, such as 23, 31 and 53.
+type greedyStrategy struct{}
+
+func (greedyStrategy) Name() string {
+	return STRATEGY_GREEDY
+}
+
+// Solve finds the smallest pack that is greater than or equal to the count,
+// or the largest pack when there is none. If the pack found is less than
+// the required count, it repeats this logic for what is left.
+//
+// The best mental model to help understand is to imagine a truck that
+// helps deliver goods. When no single pack can represent the entire
+// items, we use the nearest largest pack to get most of the items and
+// then get smaller packs so the truck is not overloaded.
+//
+// Packs are taken in quantities that their rules allow. When a pack runs
+// out of stock or reaches its maximum, the rest of the order is fulfilled
+// from the packs that are left. If every pack runs out, the order is only
+// partly fulfilled. Orders that need more than MAX_UNBOUNDED_ITERATION_COUNT
+// steps return ErrOrderTooLarge.
+func (greedyStrategy) Solve(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error) {
+	var result = InventoryOrder{}
+	if trace != nil {
+		// Greedy only ever considers the combination it builds.
+		defer func() {
+			trace.Rule = RULE_GREEDY
+			trace.Considered = 1
+			trace.Chosen = newTraceCandidate(result, count)
+			trace.Candidates = []TraceCandidate{trace.Chosen}
+		}()
+	}
+	if count <= 0 {
+		return result, nil
+	}
+
+	// Only packs that are in stock and allowed by their quantity rules can
+	// be used.
+	packsSlice := []Pack{}
+	for _, pack := range packs {
+		if _, _, ok := pack.quantityRange(); ok {
+			packsSlice = append(packsSlice, pack)
+		}
+	}
+	if len(packsSlice) == 0 {
+		// Nothing is in stock, so nothing can be sent.
+		if slices.ContainsFunc(packs, func(pack Pack) bool { return pack.Size > 0 }) {
+			return result, nil
+		}
+		return result, ErrNoPacks
+	}
+
+	slices.SortStableFunc(packsSlice, func(a, b Pack) int {
+		return int(a.Size - b.Size)
+	})
+
+	// Now we will iterate the packs available and find the maximum pack to fulfill
+	// this order. When found, we will store it's index and check for smaller packs
+	// when count is less than the current pack.
+	currentCount := count
+	selectPack := func() int {
+		for index := range packsSlice {
+			if int(packsSlice[index].Size) >= currentCount {
+				// Find first pack that is greater or equal to the current order count.
+				return index
+			}
+		}
+		// If we are at the end of the loop, we use the largest pack.
+		return len(packsSlice) - 1
+	}
+	currentIndex := selectPack()
+
+	// Prevents endless loops.
+	iterCount := 0
+	// We will continue decrementing the order count until it is less than or equal to 0.
+	for currentCount > 0 && iterCount <= MAX_UNBOUNDED_ITERATION_COUNT {
+		iterCount++
+
+		// We need to check if the remaining orders fit into this pack or we need a
+		// smaller pack. If the current count is less than the current pack size then
+		// we need to check for a smaller pack or we continue using the last pack
+		// available.
+		//
+		// We will also check that the lowest pack has enough used only when there is no
+		// bigger pack.
+		currentPack := packsSlice[currentIndex]
+		currentPackSize := int(currentPack.Size)
+		if currentCount < currentPackSize && currentIndex > 0 &&
+			(currentIndex > 1 || int(packsSlice[0].Size) >= currentCount) {
+			// If this is not the last pack, try using the next lower pack.
+			currentIndex--
+
+			continue
+		}
+
+		// Either this pack can contain the items, or we are already at the smallest
+		// possible pack and we still have orders to fulfill, so we use what we have.
+		// Every pack that fits whole is taken in one step so that large orders
+		// do not need a step for each pack. The quantity is then rounded up to
+		// one that the rules of the pack allow, without going over its limit.
+		least, most, _ := currentPack.quantityRange()
+		step := currentPack.step()
+		quantity := result[currentPack] + uint(max(1, currentCount/currentPackSize))
+		quantity = (max(quantity, least) + step - 1) / step * step
+		quantity = min(quantity, most)
+
+		used := quantity - result[currentPack]
+		currentCount -= currentPackSize * int(used)
+		result[currentPack] = quantity
+
+		// When a pack runs out, we start again with the packs that are left.
+		if quantity == most {
+			packsSlice = slices.Delete(packsSlice, currentIndex, currentIndex+1)
+			if len(packsSlice) == 0 {
+				break
+			}
+			currentIndex = selectPack()
+		}
+	}
+
+	// The order was cut off before it could be fulfilled.
+	if currentCount > 0 && len(packsSlice) > 0 {
+		return result, ErrOrderTooLarge
+	}
+
+	return result, nil
+}
+
+// minimalOvershootStrategy ships as few items beyond the count as possible
+// and then uses the fewest packs.
+type minimalOvershootStrategy struct{}
+
+func (minimalOvershootStrategy) Name() string {
+	return STRATEGY_MINIMAL_OVERSHOOT
+}
+
+func (minimalOvershootStrategy) Solve(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error) {
+	return solve(packs, count, minimalOvershoot, trace)
+}
+
+func (minimalOvershootStrategy) objective() objective {
+	return minimalOvershoot
+}
+
+// fewestPacksStrategy uses as few packs as possible and then ships as few
+// items beyond the count as possible.
+type fewestPacksStrategy struct{}
+
+func (fewestPacksStrategy) Name() string {
+	return STRATEGY_FEWEST_PACKS
+}
+
+func (fewestPacksStrategy) Solve(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error) {
+	return solve(packs, count, fewestPacks, trace)
+}
+
+func (fewestPacksStrategy) objective() objective {
+	return fewestPacks
+}
+
+// cheapestStrategy charges the customer as little as possible for the
+// packs shipped while still covering the count. Packs with a bulk price
+// can make it cheaper to ship more items than are needed.
+type cheapestStrategy struct{}
+
+func (cheapestStrategy) Name() string {
+	return STRATEGY_CHEAPEST
+}
+
+func (cheapestStrategy) Solve(packs []Pack, count int, trace *SolverTrace) (InventoryOrder, error) {
+	return solve(packs, count, lowestPrice, trace)
+}
+
+func (cheapestStrategy) objective() objective {
+	return lowestPrice
+}
+
+// packPrice returns the price of a whole pack in the price*100 convention
+// used by Item.Price. Packs without a price of their own cost the price of
+// the items they hold.
+func packPrice(pack Pack) uint64 {
+	if pack.Price > 0 {
+		return pack.Price
+	}
+	return uint64(pack.Size) * uint64(pack.Type.Price)
+}
@@ -0,0 +1,178 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPackingStrategy(t *testing.T) {
+	t.Run("GetStrategy()", func(t *testing.T) {
+		t.Run("Should return the default strategy for an empty name", func(t *testing.T) {
+			strategy, err := GetStrategy("")
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if strategy.Name() != DEFAULT_STRATEGY {
+				assertEqual(t, DEFAULT_STRATEGY, strategy.Name())
+			}
+		})
+
+		t.Run("Should return a strategy by its alias", func(t *testing.T) {
+			strategy, err := GetStrategy("cheapest")
+			if err != nil || strategy.Name() != STRATEGY_CHEAPEST {
+				assertEqual(t, STRATEGY_CHEAPEST, strategy)
+			}
+
+			packSet := NewPackSet()
+			if err := packSet.SetStrategy("cheapest"); err != nil || packSet.Strategy() != "cheapest-total-price" {
+				assertEqual(t, "cheapest-total-price", packSet.Strategy())
+			}
+		})
+
+		t.Run("Should not return an unknown strategy", func(t *testing.T) {
+			_, err := GetStrategy("random")
+			if !errors.Is(err, ErrUnknownStrategy) {
+				assertEqual(t, ErrUnknownStrategy, err)
+			}
+		})
+	})
+
+	t.Run("greedyStrategy.Solve()", func(t *testing.T) {
+		t.Run("Should use the largest packs first", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{23, 31, 53}}.packs()
+
+			// Greedy sends 1x53, 1x31 and 1x23 for 100, although 1x31 and
+			// 3x23 would fit exactly.
+			order, err := greedyStrategy{}.Solve(packs, 100, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[0]] != 1 || order[packs[1]] != 1 || order[packs[2]] != 1 {
+				assertEqual(t, "1x53 1x31 1x23", order)
+			}
+		})
+
+		t.Run("Should use smaller packs when a pack runs out", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000}, Stock: []int{-1, 3, 1}}.packs()
+
+			order, err := greedyStrategy{}.Solve(packs, 3000, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[2]] != 1 || order[packs[1]] != 3 || order[packs[0]] != 2 {
+				assertEqual(t, "1x1000 3x500 2x250", order)
+			}
+		})
+
+		t.Run("Should follow the quantity rules of each pack", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 1000}, Rules: [][3]uint{{0, 0, 2}, {0, 2, 0}}}.packs()
+
+			// Only 2 of the 1000 pack can be sent, and 250 packs are sent
+			// in pairs.
+			order, err := greedyStrategy{}.Solve(packs, 2300, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[1]] != 2 || order[packs[0]] != 2 || len(order) != 2 {
+				assertEqual(t, "2x1000 2x250", order)
+			}
+		})
+
+		t.Run("Should take many packs of a size in one step", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 500, 1000}}.packs()
+
+			order, err := greedyStrategy{}.Solve(packs, 10000001, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[2]] != 10000 || order[packs[0]] != 1 || len(order) != 2 {
+				assertEqual(t, "10000x1000 1x250", order)
+			}
+		})
+	})
+
+	t.Run("fewestPacksStrategy.Solve()", func(t *testing.T) {
+		t.Run("Should prefer fewer packs over less overshoot", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{250, 280, 300}}.packs()
+
+			order, err := fewestPacksStrategy{}.Solve(packs, 260, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[packs[1]] != 1 || len(order) != 1 {
+				assertEqual(t, "1x280", order)
+			}
+		})
+	})
+
+	t.Run("cheapestStrategy.Solve()", func(t *testing.T) {
+		t.Run("Should ship the fewest items when all items cost the same", func(t *testing.T) {
+			packs := packCase{Sizes: []uint{23, 31, 53}}.packs()
+
+			order, err := cheapestStrategy{}.Solve(packs, 100, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+
+			overshoot, _ := summarize(order, 100)
+			if overshoot != 0 {
+				assertEqual(t, 0, overshoot)
+			}
+		})
+
+		t.Run("Should use bulk prices even when more items are shipped", func(t *testing.T) {
+			item := Item{Id: item1.Id, Name: item1.Name, ForSale: true, Price: 100}
+			small := Pack{Type: item, Size: 100}
+			bulk := Pack{Type: item, Size: 300, Price: 15000}
+
+			order, err := cheapestStrategy{}.Solve([]Pack{small, bulk}, 150, nil)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if order[bulk] != 1 || len(order) != 1 {
+				assertEqual(t, "1x300", order)
+			}
+			if order.Price() != 15000 {
+				assertEqual(t, 15000, order.Price())
+			}
+		})
+	})
+
+	t.Run("packPrice()", func(t *testing.T) {
+		t.Run("Should fall back to the price of the items", func(t *testing.T) {
+			pack := Pack{Type: item1, Size: 3}
+
+			expected := 3 * uint64(item1.Price)
+			if packPrice(pack) != expected {
+				assertEqual(t, expected, packPrice(pack))
+			}
+		})
+	})
+}
+
+func TestPackSetJSONFormat(t *testing.T) {
+	t.Run("PackSetJSONFormat.UnmarshalJSON()", func(t *testing.T) {
+		t.Run("Should read a plain array of packs", func(t *testing.T) {
+			var format PackSetJSONFormat
+			err := json.Unmarshal([]byte(`[{"size": 250}, {"size": 500}]`), &format)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if len(format.Packs) != 2 || format.Strategy != "" {
+				assertEqual(t, "2 packs and no strategy", format)
+			}
+		})
+
+		t.Run("Should read packs with a strategy", func(t *testing.T) {
+			var format PackSetJSONFormat
+			err := json.Unmarshal([]byte(`{"strategy": "greedy", "packs": [{"size": 250}]}`), &format)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if len(format.Packs) != 1 || format.Strategy != STRATEGY_GREEDY {
+				assertEqual(t, "1 pack and the greedy strategy", format)
+			}
+		})
+	})
+}
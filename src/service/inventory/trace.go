@@ -0,0 +1,61 @@
+package inventory
+
+const (
+	RULE_GREEDY            = "largest pack first, then the next smaller pack for what is left"
+	RULE_MINIMAL_OVERSHOOT = "least items beyond the count, then fewest packs"
+	RULE_FEWEST_PACKS      = "fewest packs, then least items beyond the count"
+	RULE_LOWEST_PRICE      = "lowest price, then least items beyond the count, then fewest packs"
+	RULE_EXACT_FIT         = "only combinations that add up to the count exactly"
+	RULE_SHORTFALL         = "stock cannot cover the count, so the most items in stock are sent"
+)
+
+// SolverTrace explains how a PackingStrategy chose the packs for an order.
+type SolverTrace struct {
+	// Strategy is the name of the strategy that solved the order.
+	Strategy string `json:"strategy"`
+	// Count is the number of items requested.
+	Count int `json:"count"`
+	// Rule describes how the chosen candidate was picked.
+	Rule string `json:"rule"`
+	// Bulk maps the size of the pack that filled most of a large order to
+	// the number of those packs. They are part of every candidate.
+	Bulk map[uint]uint `json:"bulk,omitempty"`
+	// Considered is the number of candidates the strategy compared. Only
+	// the best of them are listed in Candidates.
+	Considered int `json:"considered"`
+	// Candidates lists the best candidates, best first.
+	Candidates []TraceCandidate `json:"candidates"`
+	// Chosen is the candidate used to fulfill the order.
+	Chosen TraceCandidate `json:"chosen"`
+}
+
+// TraceCandidate is a combination of packs that a strategy considered.
+type TraceCandidate struct {
+	// Packs maps each pack size to the number of packs of that size.
+	Packs map[uint]uint `json:"packs"`
+	// Items is the number of items the packs hold.
+	Items uint `json:"items"`
+	// Overshoot is the number of items beyond the count. It is negative
+	// when the packs do not cover the count.
+	Overshoot int `json:"overshoot"`
+	// PackCount is the number of packs.
+	PackCount uint `json:"packCount"`
+	// Price is the cost of the packs in the price*100 convention.
+	Price uint64 `json:"price"`
+}
+
+// newTraceCandidate describes order as a candidate for count items.
+func newTraceCandidate(order InventoryOrder, count int) TraceCandidate {
+	var packCount uint
+	for _, frequency := range order {
+		packCount += frequency
+	}
+
+	return TraceCandidate{
+		Packs:     order.bySize(),
+		Items:     order.Items(),
+		Overshoot: int(order.Items()) - count,
+		PackCount: packCount,
+		Price:     order.Price(),
+	}
+}
@@ -0,0 +1,310 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+// MutationKind names a change to an item recorded in the write-ahead log.
+type MutationKind string
+
+const (
+	MUTATION_ITEM_REPLACED MutationKind = "item_replaced"
+	MUTATION_ITEM_DELETED  MutationKind = "item_deleted"
+	MUTATION_PACK_ADDED    MutationKind = "pack_added"
+	MUTATION_PACK_REMOVED  MutationKind = "pack_removed"
+	MUTATION_STOCK_CHANGED MutationKind = "stock_changed"
+)
+
+// Mutation is a record in the write-ahead log. It holds the whole item
+// and packs after the change rather than the change itself, so replaying a
+// record twice gives the same inventory.
+type Mutation struct {
+	// Sequence orders the records. Records at or below the sequence of the
+	// snapshot are already part of it.
+	Sequence uint64       `json:"sequence"`
+	Kind     MutationKind `json:"kind"`
+	ItemID   string       `json:"itemId"`
+	// Item is nil when the item is not in the catalog anymore.
+	Item *Item `json:"item,omitempty"`
+	// Packs is nil when the item has no pack set anymore.
+	Packs *StoredPackSet `json:"packs,omitempty"`
+}
+
+// itemState is a copy of everything the inventory holds for an item, used
+// to undo a change that could not be logged.
+type itemState struct {
+	item      Item
+	inCatalog bool
+	packSet   PackSet
+	hasPacks  bool
+}
+
+// clonePackSet returns a copy of packSet that shares nothing with it.
+func clonePackSet(packSet PackSet) PackSet {
+	return PackSet{
+		keys:     maps.Clone(packSet.keys),
+		values:   slices.Clone(packSet.values),
+		strategy: packSet.strategy,
+	}
+}
+
+// itemState returns a copy of what the inventory holds for the item. It
+// must be called with the Inventory lock held.
+func (i *Inventory) itemState(itemID string) itemState {
+	state := itemState{}
+	state.item, state.inCatalog = i.items[itemID]
+	if packSet, ok := i.data[itemID]; ok {
+		state.packSet, state.hasPacks = clonePackSet(packSet), true
+	}
+	return state
+}
+
+// restoreItem puts back what the inventory held for the item. It must be
+// called with the Inventory lock held.
+func (i *Inventory) restoreItem(itemID string, state itemState) {
+	if state.inCatalog {
+		i.items[itemID] = state.item
+	} else {
+		delete(i.items, itemID)
+	}
+	if state.hasPacks {
+		i.data[itemID] = state.packSet
+	} else {
+		delete(i.data, itemID)
+	}
+}
+
+// logMutation appends the item as it is now to the write-ahead log, or
+// saves it to the item store, and waits for it to reach the disk. When the
+// record cannot be written, the item is restored to before so that the
+// inventory only holds changes that are durable, and ErrPersistFailed is
+// returned. It must be called with the Inventory lock held.
+func (i *Inventory) logMutation(kind MutationKind, itemID string, before itemState) error {
+	if i.wal == nil && i.itemStore == nil {
+		return nil
+	}
+
+	mutation := Mutation{Sequence: i.sequence + 1, Kind: kind, ItemID: itemID}
+	if item, ok := i.items[itemID]; ok {
+		mutation.Item = &item
+	}
+	if packSet, ok := i.data[itemID]; ok {
+		stored := newStoredPackSet(packSet)
+		mutation.Packs = &stored
+	}
+
+	var err error
+	if i.itemStore != nil {
+		err = i.storeMutation(mutation)
+	} else {
+		err = i.wal.Append(mutation)
+	}
+	if err != nil {
+		log.Error("Failed to log inventory change, will undo it", "itemID", itemID, "kind", kind, "error", err)
+		i.restoreItem(itemID, before)
+		return fmt.Errorf("%w: %v", ErrPersistFailed, err)
+	}
+	i.sequence = mutation.Sequence
+
+	if i.wal != nil && i.wal.Len() >= WAL_COMPACTION_THRESHOLD {
+		i.inBackground(i.compact)
+	}
+	return nil
+}
+
+// logRestore saves the inventory after it was replaced with a snapshot,
+// which previous held before, and waits for it to reach the disk. The
+// caller swaps the inventory back when ErrPersistFailed is returned. It
+// must be called with the Inventory lock held.
+func (i *Inventory) logRestore(previous *StorageJSONFormat) error {
+	if i.wal == nil && i.itemStore == nil {
+		return nil
+	}
+
+	stored := newStorageJSONFormat(i.items, i.data)
+	stored.Sequence = i.sequence + 1
+	var err error
+	if i.itemStore != nil {
+		if err = i.storeStorage(&stored, previous); err != nil {
+			// Put back the items that were saved, so the store holds the
+			// inventory that is kept in memory.
+			if undoErr := i.storeStorage(previous, &stored); undoErr != nil {
+				log.Error("Failed to undo inventory restore in item store", "error", undoErr)
+			}
+		}
+	} else {
+		// The whole inventory changes, so it is saved as a snapshot rather
+		// than logged.
+		err = i.storage.Set(context.Background(), i.storageKey, stored)
+		if err == nil {
+			i.markStorage()
+		}
+	}
+	if err != nil {
+		log.Error("Failed to save inventory restore, will undo it", "error", err)
+		return fmt.Errorf("%w: %v", ErrPersistFailed, err)
+	}
+	i.sequence = stored.Sequence
+
+	// The records in the log are older than the snapshot, so they are
+	// skipped by sequence even when it cannot be emptied.
+	if i.wal != nil {
+		if err := i.wal.Truncate(); err != nil {
+			log.Error("Failed to empty inventory log", "error", err)
+		}
+	}
+	return nil
+}
+
+// applyMutation changes the inventory to hold the item as recorded in
+// mutation. It must be called with the Inventory lock held.
+func (i *Inventory) applyMutation(mutation Mutation) {
+	id := mutation.ItemID
+	if mutation.Item == nil {
+		delete(i.items, id)
+		delete(i.data, id)
+		return
+	}
+
+	stored := StorageJSONFormat{
+		Items: map[string]Item{id: *mutation.Item},
+		Packs: map[string]StoredPackSet{},
+	}
+	if mutation.Packs != nil {
+		stored.Packs[id] = *mutation.Packs
+	}
+	packSet, err := stored.PackSet(id)
+	if err != nil {
+		log.Error("Failed to replay inventory change", "mutation", mutation, "error", err)
+		return
+	}
+
+	i.items[id] = *mutation.Item
+	if mutation.Packs == nil {
+		delete(i.data, id)
+	} else {
+		i.data[id] = *packSet
+	}
+}
+
+// replay applies every record in the write-ahead log that is newer than
+// the snapshot and returns the number applied.
+func (i *Inventory) replay() (int, error) {
+	i.lock()
+	defer i.unLock()
+
+	applied := 0
+	err := i.wal.Replay(func(mutation Mutation) error {
+		if mutation.Sequence <= i.sequence {
+			// The snapshot was saved after this record was logged.
+			return nil
+		}
+
+		i.applyMutation(mutation)
+		i.sequence = mutation.Sequence
+		applied++
+		return nil
+	})
+
+	return applied, err
+}
+
+// compact saves a snapshot of the inventory and empties the write-ahead
+// log, whose records the snapshot now holds. Changes wait until it is done
+// so that no record is dropped without being saved.
+func (i *Inventory) compact() {
+	if i.storage == nil {
+		return
+	}
+
+	i.lock()
+	defer i.unLock()
+
+	log.Info("Compact inventory log start", "sequence", i.sequence)
+	snapshot := newStorageJSONFormat(i.items, i.data)
+	snapshot.Sequence = i.sequence
+	if err := i.storage.Set(context.Background(), i.storageKey, snapshot); err != nil {
+		log.Error("Failed to save inventory snapshot", "error", err)
+		return
+	}
+	i.markStorage()
+
+	// A crash before the log is emptied is harmless, since the records are
+	// skipped by sequence when they are replayed.
+	if i.wal != nil {
+		if err := i.wal.Truncate(); err != nil {
+			log.Error("Failed to empty inventory log", "error", err)
+			return
+		}
+	}
+	log.Info("Compact inventory log success", "sequence", i.sequence)
+}
+
+// runCompaction compacts the write-ahead log every interval while it has
+// records, until ctx is done.
+func (i *Inventory) runCompaction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if i.wal != nil && i.wal.Len() > 0 {
+				i.compact()
+			}
+		}
+	}
+}
+
+// apply changes f to hold the item as recorded in mutation.
+func (f *StorageJSONFormat) apply(mutation Mutation) {
+	if f.Items == nil {
+		f.Items = map[string]Item{}
+	}
+	if f.Packs == nil {
+		f.Packs = map[string]StoredPackSet{}
+	}
+
+	id := mutation.ItemID
+	if mutation.Item == nil {
+		delete(f.Items, id)
+	} else {
+		f.Items[id] = *mutation.Item
+	}
+	if mutation.Packs == nil {
+		delete(f.Packs, id)
+	} else {
+		f.Packs[id] = *mutation.Packs
+	}
+	f.Sequence = mutation.Sequence
+}
+
+// ReadStorage reads the snapshot stored with key in storage along with the
+// changes logged at walPath since it was saved. Nothing is changed, so it
+// can be used while the service is running.
+func ReadStorage(ctx context.Context, storage store.Store[string, StorageJSONFormat], key string, walPath string) (*StorageJSONFormat, error) {
+	stored, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.ReadLog(walPath, func(mutation Mutation) error {
+		if mutation.Sequence > stored.Sequence {
+			stored.apply(mutation)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
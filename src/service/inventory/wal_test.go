@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"eikcalb.dev/shark/src/store"
+)
+
+// openStorage opens an inventory from the storage file and log at the
+// paths, and closes the log once the test is done.
+func openStorage(t *testing.T, storagePath string, walPath string) *Inventory {
+	inv := &Inventory{}
+	storage, key := StorageFile(storagePath)
+	if err := inv.open(context.Background(), storage, key, walPath); err != nil {
+		t.Fatalf("expected: %+v; got: %+v", NO_ERROR, err)
+	}
+	t.Cleanup(func() { inv.wal.Close() })
+	return inv
+}
+
+// openNewStorage opens an inventory with an empty snapshot in a new
+// directory, and returns it with the paths of its storage file and log.
+func openNewStorage(t *testing.T) (*Inventory, string, string) {
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "storage.json")
+	walPath := filepath.Join(dir, "storage.wal")
+	os.WriteFile(storagePath, []byte(`{"items":{},"packs":{}}`), 0o644)
+
+	return openStorage(t, storagePath, walPath), storagePath, walPath
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	var (
+		id = item1.Id.String()
+	)
+
+	t.Run("Inventory.open()", func(t *testing.T) {
+		t.Run("Should replay changes made since the snapshot", func(t *testing.T) {
+			inv, storagePath, walPath := openNewStorage(t)
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.AddPack(id, Pack{Size: 500, TrackStock: true, Stock: 3})
+			inv.AddPack(id, Pack{Size: 1000})
+			inv.RemovePack(id, 1000)
+			order, _ := inv.CreateOrder(id, 500, true)
+			if _, err := inv.CommitOrder(id, order.Id); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			expected, _ := inv.GetItem(id)
+			inv.wal.Close()
+
+			reopened := openStorage(t, storagePath, walPath)
+			item, err := reopened.GetItem(id)
+			if err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			if item.Item != expected.Item || len(item.Packs) != 2 || item.Packs[1] != expected.Packs[1] || item.Packs[1].Stock != 2 {
+				assertEqual(t, expected, item)
+			}
+
+			// The replayed changes are folded into the snapshot.
+			if reopened.wal.Len() != 0 || reopened.sequence != 5 {
+				assertEqual(t, 5, reopened.sequence)
+			}
+			storage, key := StorageFile(storagePath)
+			stored, _ := ReadStorage(context.Background(), storage, key, walPath)
+			if stored.Sequence != 5 || len(stored.Packs[id].Packs) != 2 {
+				assertEqual(t, "snapshot at sequence 5", stored)
+			}
+		})
+
+		t.Run("Should replay a deleted item", func(t *testing.T) {
+			inv, storagePath, walPath := openNewStorage(t)
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.DeleteItem(id)
+			inv.wal.Close()
+
+			reopened := openStorage(t, storagePath, walPath)
+			if _, err := reopened.GetItem(id); !errors.Is(err, ErrItemNotFound) {
+				assertEqual(t, ErrItemNotFound, err)
+			}
+		})
+
+		t.Run("Should skip changes that the snapshot already holds", func(t *testing.T) {
+			inv, storagePath, walPath := openNewStorage(t)
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.AddPack(id, Pack{Size: 500})
+
+			// The process stops after the snapshot is saved but before the
+			// log is emptied.
+			logged, _ := os.ReadFile(walPath)
+			inv.compact()
+			inv.wal.Close()
+			os.WriteFile(walPath, logged, 0o644)
+
+			reopened := openStorage(t, storagePath, walPath)
+			if reopened.sequence != 2 || reopened.wal.Len() != 2 {
+				assertEqual(t, "2 records skipped", reopened.wal.Len())
+			}
+			if packs := reopened.data[id].values; len(packs) != 2 {
+				assertEqual(t, 2, len(packs))
+			}
+		})
+	})
+
+	t.Run("Inventory.compact()", func(t *testing.T) {
+		t.Run("Should save the snapshot to the store it was opened with", func(t *testing.T) {
+			storage := store.NewMemoryStore(map[string]StorageJSONFormat{"inventory": {}})
+			inv := &Inventory{}
+			if err := inv.open(context.Background(), storage, "inventory", filepath.Join(t.TempDir(), "storage.wal")); err != nil {
+				assertEqual(t, NO_ERROR, err)
+			}
+			defer inv.wal.Close()
+
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.compact()
+
+			stored, _ := storage.Get(context.Background(), "inventory")
+			if stored.Sequence != 1 || stored.Items[id] != item1 || inv.wal.Len() != 0 {
+				assertEqual(t, "snapshot at sequence 1", stored)
+			}
+		})
+	})
+
+	t.Run("Inventory.logMutation()", func(t *testing.T) {
+		t.Run("Should undo changes that cannot be logged", func(t *testing.T) {
+			inv, _, _ := openNewStorage(t)
+			inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{{Type: item1, Size: 250}}})
+			inv.wal.Close()
+
+			cases := []struct {
+				name   string
+				change func() error
+			}{
+				{"add pack", func() error { _, err := inv.AddPack(id, Pack{Size: 500}); return err }},
+				{"remove pack", func() error { _, err := inv.RemovePack(id, 250); return err }},
+				{"set packs", func() error { return inv.SetPacks(id, PackSetJSONFormat{Packs: []Pack{}}) }},
+				{"delete item", func() error { return inv.DeleteItem(id) }},
+			}
+
+			for _, tc := range cases {
+				err := tc.change()
+				if !errors.Is(err, ErrPersistFailed) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, ErrPersistFailed, err)
+				}
+
+				item, err := inv.GetItem(id)
+				if err != nil || len(item.Packs) != 1 || item.Packs[0].Size != 250 {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, "a 250 pack", item)
+				}
+			}
+		})
+	})
+}
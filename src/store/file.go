@@ -0,0 +1,70 @@
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// file is the part of *os.File that JSONFileStore writes through.
+type file interface {
+	io.Writer
+	Name() string
+	Chmod(mode os.FileMode) error
+	Sync() error
+	Close() error
+}
+
+// fileSystem is the part of the os package that JSONFileStore saves
+// through, so that tests can make any step fail.
+type fileSystem interface {
+	CreateTemp(dir, pattern string) (file, error)
+	Rename(oldPath, newPath string) error
+	Remove(name string) error
+	// Copy makes newPath hold the content of oldPath.
+	Copy(oldPath, newPath string) error
+	// SyncDir flushes the entries of the directory at path to disk.
+	SyncDir(path string) error
+}
+
+// osFileSystem is the fileSystem of the operating system.
+type osFileSystem struct{}
+
+func (osFileSystem) CreateTemp(dir, pattern string) (file, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+func (osFileSystem) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (osFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+// Copy links newPath to the content of oldPath, which stays with newPath
+// when oldPath is replaced. Content is copied where links are not
+// supported.
+func (osFileSystem) Copy(oldPath, newPath string) error {
+	if err := os.Remove(newPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(oldPath, newPath); err == nil {
+		return nil
+	}
+
+	content, err := os.ReadFile(oldPath)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(newPath, content, FILE_MODE)
+}
+
+func (osFileSystem) SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore is a Store that keeps each value as a JSON file in a
+// directory, named after its key. Files are saved with JSONFileStore, so
+// every Set is atomic.
+//
+// The files are read on every Get and List, so changes made to them from
+// outside are seen. The store expects to own every file in the directory
+// that ends with its suffix.
+type FileStore[K ~string, V interface{}] struct {
+	// Dir is the directory that holds the files.
+	Dir string
+	// Suffix ends the name of every file. It is ".json" when empty.
+	Suffix string
+	// Backups is the number of copies of each file kept from before each
+	// save, as described by JSONFileStore.
+	Backups int
+	// Schema is the schema of every value, as described by JSONFileStore.
+	Schema Schema
+
+	// mutex orders the changes to the files, and is held while their
+	// events are queued for watchers so that they see them in the order
+	// they were made.
+	mutex    sync.Mutex
+	watchers watchers[K, V]
+}
+
+// NewFileStore returns a FileStore for the files in dir.
+func NewFileStore[K ~string, V interface{}](dir string) *FileStore[K, V] {
+	return &FileStore[K, V]{Dir: dir}
+}
+
+// suffix returns the suffix of the files of the store.
+func (fs *FileStore[K, V]) suffix() string {
+	if fs.Suffix == "" {
+		return ".json"
+	}
+	return fs.Suffix
+}
+
+// file returns the JSONFileStore of the value stored with key.
+func (fs *FileStore[K, V]) file(key K) (JSONFileStore[V], error) {
+	name := string(key)
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return JSONFileStore[V]{}, ErrInvalidKey
+	}
+
+	return JSONFileStore[V]{Path: filepath.Join(fs.Dir, name+fs.suffix()), Backups: fs.Backups, Schema: fs.Schema}, nil
+}
+
+// Path returns the path of the file that holds the value stored with key.
+func (fs *FileStore[K, V]) Path(key K) (string, error) {
+	jfs, err := fs.file(key)
+	return jfs.Path, err
+}
+
+func (fs *FileStore[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	jfs, err := fs.file(key)
+	if err != nil {
+		return zero, err
+	}
+	value, err := jfs.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return zero, ErrNotFound
+	}
+	if err != nil {
+		return zero, err
+	}
+	return *value, nil
+}
+
+func (fs *FileStore[K, V]) Set(ctx context.Context, key K, value V) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	jfs, err := fs.file(key)
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if err := jfs.Save(value); err != nil {
+		return err
+	}
+	fs.watchers.notify(Event[K, V]{Kind: EVENT_SET, Key: key, Value: value})
+	return nil
+}
+
+func (fs *FileStore[K, V]) Delete(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	jfs, err := fs.file(key)
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	err = os.Remove(jfs.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	fs.watchers.notify(Event[K, V]{Kind: EVENT_DELETE, Key: key})
+	return nil
+}
+
+func (fs *FileStore[K, V]) List(ctx context.Context) (map[K]V, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(fs.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[K]V{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fs.suffix())
+		if !ok || entry.IsDir() || name == "" {
+			continue
+		}
+
+		value, err := fs.Get(ctx, K(name))
+		if errors.Is(err, ErrNotFound) {
+			// The file was deleted after the directory was read.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[K(name)] = value
+	}
+	return values, nil
+}
+
+// Watch returns a channel that receives the changes made through the
+// store. Changes made to the files from outside are not sent.
+func (fs *FileStore[K, V]) Watch(ctx context.Context) (<-chan Event[K, V], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return fs.watchers.add(ctx), nil
+}
+
+// ForFile returns a FileStore for the directory of the file at path along
+// with the key that the file is stored with.
+func ForFile[V interface{}](path string) (*FileStore[string, V], string) {
+	fs := NewFileStore[string, V](filepath.Dir(path))
+	name := filepath.Base(path)
+	fs.Suffix = filepath.Ext(name)
+	return fs, strings.TrimSuffix(name, fs.Suffix)
+}
@@ -5,26 +5,96 @@ data.
 package store
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 )
 
-type Store interface {
-	// Get is used to retrieve data from the implementation store.
-	Get(id string) interface{}
+var (
+	ErrNotFound   = errors.New("key was not found in the store")
+	ErrInvalidKey = errors.New("key is not valid for the store")
+)
+
+// Store holds values of type V by keys of type K. Every method returns the
+// error of ctx when it is done before the method starts.
+type Store[K comparable, V interface{}] interface {
+	// Get returns the value stored with key, or ErrNotFound.
+	Get(ctx context.Context, key K) (V, error)
+
+	// Set stores value with key, replacing any value stored before.
+	Set(ctx context.Context, key K, value V) error
+
+	// Delete removes the value stored with key, or returns ErrNotFound.
+	Delete(ctx context.Context, key K) error
 
-	// Set is used to store data using the provided id as its key.
-	Set(id string, data interface{})
+	// List returns every value in the store by its key.
+	List(ctx context.Context) (map[K]V, error)
+
+	// Watch returns a channel that receives an Event for every change to
+	// the store until ctx is done, when the channel is closed.
+	Watch(ctx context.Context) (<-chan Event[K, V], error)
 }
 
+// EventKind names a change to a Store.
+type EventKind string
+
+const (
+	EVENT_SET    EventKind = "set"
+	EVENT_DELETE EventKind = "delete"
+)
+
+// Event describes a change to a Store. Value is the zero value when the
+// key was deleted.
+type Event[K comparable, V interface{}] struct {
+	Kind  EventKind
+	Key   K
+	Value V
+}
+
+const (
+	// FILE_MODE is the permission of files saved by JSONFileStore.
+	FILE_MODE os.FileMode = 0o644
+	// WATCH_BUFFER_SIZE is the number of events the channel of a watcher
+	// of a Store holds. Events beyond it are queued until the watcher
+	// reads, so changes never wait for it.
+	WATCH_BUFFER_SIZE = 64
+)
+
 // Implementation of Store that is used to store data in JSON format
 // in the file system.
 type JSONFileStore[T interface{}] struct {
 	Path string
+
+	// Backups is the number of copies of the file as it was before each
+	// save to keep. The latest is kept at Path with a .bak suffix and older
+	// ones add .1, .2 and so on. Zero keeps none.
+	Backups int
+
+	// Schema is saved with the data in an Envelope and migrates data saved
+	// with an older version of it when it is loaded.
+	Schema Schema
+
+	// fs performs the file operations. The operating system is used when
+	// it is nil.
+	fs fileSystem
+}
+
+// files returns the fileSystem that the store saves through.
+func (jfs JSONFileStore[T]) files() fileSystem {
+	if jfs.fs == nil {
+		return osFileSystem{}
+	}
+	return jfs.fs
 }
 
 // Load reads the file content from the path specified and creates
 // a JSON representation of the content using the provided type T.
+//
+// Data saved with an older version of the schema is migrated first, and
+// when T implements Migrated it is told the version it was saved with.
 func (jfs JSONFileStore[T]) Load() (*T, error) {
 	rawJSON, err := os.ReadFile(jfs.Path)
 	if err != nil {
@@ -32,24 +102,127 @@ func (jfs JSONFileStore[T]) Load() (*T, error) {
 		return nil, err
 	}
 
+	data, version, err := jfs.Schema.load(rawJSON)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", jfs.Path, err)
+	}
+
 	var parsedJSON T
-	err = json.Unmarshal(rawJSON, &parsedJSON)
+	err = json.Unmarshal(data, &parsedJSON)
 	if err != nil {
 		// Failed to convert JSON string to Config struct.
 		return nil, err
 	}
 
+	if migrated, ok := any(&parsedJSON).(Migrated); ok && version < jfs.Schema.Version() {
+		migrated.SetMigratedFrom(version)
+	}
+
 	return &parsedJSON, nil
 }
 
+// Save replaces the file with the JSON representation of data, in an
+// Envelope with the latest version of the schema.
+//
+// The data is written to a temporary file in the same directory, flushed
+// to disk and then renamed over the file. A rename is atomic, so if the
+// process dies at any point the file holds either the old or the new data
+// and never a part of it. When Backups is set, the old file is kept as a
+// backup before it is replaced.
 func (jfs JSONFileStore[T]) Save(data T) error {
-	rawJSON, err := json.Marshal(data)
+	rawData, err := json.Marshal(data)
 	if err != nil {
 		// Failed to stringify JSON.
 		return err
 	}
+	rawJSON, err := json.Marshal(jfs.Schema.wrap(rawData))
+	if err != nil {
+		return err
+	}
 
-	os.WriteFile(jfs.Path, rawJSON, os.ModePerm)
+	fs := jfs.files()
+	dir, base := filepath.Split(jfs.Path)
+	if dir == "" {
+		dir = "."
+	}
+
+	temp, err := fs.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file for %s: %w", jfs.Path, err)
+	}
+	if err := writeFile(temp, rawJSON); err != nil {
+		// The file is left as it was, so only the temporary file needs to
+		// be cleaned up.
+		if removeErr := fs.Remove(temp.Name()); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+		return fmt.Errorf("write %s: %w", jfs.Path, err)
+	}
+
+	if err := jfs.rotateBackups(fs); err != nil {
+		if removeErr := fs.Remove(temp.Name()); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+		return fmt.Errorf("back up %s: %w", jfs.Path, err)
+	}
+
+	if err := fs.Rename(temp.Name(), jfs.Path); err != nil {
+		if removeErr := fs.Remove(temp.Name()); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+		return fmt.Errorf("replace %s: %w", jfs.Path, err)
+	}
+
+	// The rename is only durable once the directory is flushed too.
+	if err := fs.SyncDir(dir); err != nil {
+		return fmt.Errorf("sync directory of %s: %w", jfs.Path, err)
+	}
 
 	return nil
 }
+
+// writeFile writes content to f, flushes it to disk and closes it. f is
+// closed even when a step fails.
+func writeFile(f file, content []byte) error {
+	_, err := f.Write(content)
+	if err == nil {
+		err = f.Chmod(FILE_MODE)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// backupPath returns the path of the backup at index, where 0 is the
+// latest.
+func (jfs JSONFileStore[T]) backupPath(index int) string {
+	if index == 0 {
+		return jfs.Path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", jfs.Path, index)
+}
+
+// rotateBackups moves every backup one place older, dropping the oldest,
+// and keeps the current file as the latest backup. Nothing is done when
+// Backups is zero or the file does not exist yet.
+func (jfs JSONFileStore[T]) rotateBackups(fs fileSystem) error {
+	if jfs.Backups <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(jfs.Path); os.IsNotExist(err) {
+		return nil
+	}
+
+	for index := jfs.Backups - 2; index >= 0; index-- {
+		err := fs.Rename(jfs.backupPath(index), jfs.backupPath(index+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return fs.Copy(jfs.Path, jfs.backupPath(0))
+}
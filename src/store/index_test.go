@@ -0,0 +1,209 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errSimulated = errors.New("simulated failure")
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// failingFile writes up to limit bytes before it fails, as a disk that
+// fills up or a process that dies would.
+type failingFile struct {
+	file
+	limit    int
+	failSync bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.limit >= 0 && len(p) > f.limit {
+		n, _ := f.file.Write(p[:f.limit])
+		return n, errSimulated
+	}
+	return f.file.Write(p)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		return errSimulated
+	}
+	return f.file.Sync()
+}
+
+// failingFileSystem makes the step named by failAt fail.
+type failingFileSystem struct {
+	osFileSystem
+	failAt string
+	// limit is the number of bytes written before a "write" failure.
+	limit int
+}
+
+func (fs failingFileSystem) CreateTemp(dir, pattern string) (file, error) {
+	if fs.failAt == "create" {
+		return nil, errSimulated
+	}
+	f, err := fs.osFileSystem.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	failing := &failingFile{file: f, limit: -1, failSync: fs.failAt == "sync"}
+	if fs.failAt == "write" {
+		failing.limit = fs.limit
+	}
+	return failing, nil
+}
+
+func (fs failingFileSystem) Rename(oldPath, newPath string) error {
+	if fs.failAt == "rename" {
+		return errSimulated
+	}
+	return fs.osFileSystem.Rename(oldPath, newPath)
+}
+
+func (fs failingFileSystem) Copy(oldPath, newPath string) error {
+	if fs.failAt == "backup" {
+		return errSimulated
+	}
+	return fs.osFileSystem.Copy(oldPath, newPath)
+}
+
+func (fs failingFileSystem) SyncDir(path string) error {
+	if fs.failAt == "syncDir" {
+		return errSimulated
+	}
+	return fs.osFileSystem.SyncDir(path)
+}
+
+// assertFiles fails unless dir holds exactly the files in names.
+func assertFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected: %+v; got: %+v", nil, err)
+	}
+	found := []string{}
+	for _, entry := range entries {
+		found = append(found, entry.Name())
+	}
+	if strings.Join(found, ",") != strings.Join(names, ",") {
+		t.Fatalf("expected: %+v; got: %+v", names, found)
+	}
+}
+
+func TestJSONFileStore(t *testing.T) {
+	var (
+		old     = record{Name: "old", Count: 1}
+		updated = record{Name: strings.Repeat("new", 100), Count: 2}
+	)
+
+	setup := func(t *testing.T) JSONFileStore[record] {
+		jfs := JSONFileStore[record]{Path: filepath.Join(t.TempDir(), "storage.json")}
+		if err := jfs.Save(old); err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		return jfs
+	}
+
+	t.Run("JSONFileStore.Save()", func(t *testing.T) {
+		t.Run("Should replace the file", func(t *testing.T) {
+			jfs := setup(t)
+
+			if err := jfs.Save(updated); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			loaded, err := jfs.Load()
+			if err != nil || *loaded != updated {
+				t.Fatalf("expected: %+v; got: %+v", updated, loaded)
+			}
+
+			info, _ := os.Stat(jfs.Path)
+			if info.Mode().Perm() != FILE_MODE {
+				t.Fatalf("expected: %+v; got: %+v", FILE_MODE, info.Mode().Perm())
+			}
+			assertFiles(t, filepath.Dir(jfs.Path), "storage.json")
+		})
+
+		t.Run("Should keep the old file when a step fails", func(t *testing.T) {
+			cases := []struct {
+				name   string
+				failAt string
+				limit  int
+			}{
+				{"temporary file not created", "create", 0},
+				{"nothing written", "write", 0},
+				{"write stopped partway", "write", 10},
+				{"sync failed", "sync", 0},
+				{"rename failed", "rename", 0},
+			}
+
+			for _, tc := range cases {
+				jfs := setup(t)
+				jfs.fs = failingFileSystem{failAt: tc.failAt, limit: tc.limit}
+
+				err := jfs.Save(updated)
+				if !errors.Is(err, errSimulated) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, errSimulated, err)
+				}
+
+				loaded, err := jfs.Load()
+				if err != nil || *loaded != old {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.name, old, loaded)
+				}
+				assertFiles(t, filepath.Dir(jfs.Path), "storage.json")
+			}
+		})
+
+		t.Run("Should return an error when the rename is not flushed", func(t *testing.T) {
+			jfs := setup(t)
+			jfs.fs = failingFileSystem{failAt: "syncDir"}
+
+			if err := jfs.Save(updated); !errors.Is(err, errSimulated) {
+				t.Fatalf("expected: %+v; got: %+v", errSimulated, err)
+			}
+		})
+
+		t.Run("Should rotate backups of the old file", func(t *testing.T) {
+			jfs := setup(t)
+			jfs.Backups = 2
+
+			for count := 2; count <= 4; count++ {
+				if err := jfs.Save(record{Count: count}); err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+			}
+			assertFiles(t, filepath.Dir(jfs.Path), "storage.json", "storage.json.bak", "storage.json.bak.1")
+
+			for index, expected := range []int{3, 2} {
+				backup := JSONFileStore[record]{Path: jfs.backupPath(index)}
+				loaded, err := backup.Load()
+				if err != nil || loaded.Count != expected {
+					t.Fatalf("backup %d: expected: %+v; got: %+v", index, expected, loaded)
+				}
+			}
+		})
+
+		t.Run("Should keep the old file when the backup fails", func(t *testing.T) {
+			jfs := setup(t)
+			jfs.Backups = 1
+			jfs.fs = failingFileSystem{failAt: "backup"}
+
+			if err := jfs.Save(updated); !errors.Is(err, errSimulated) {
+				t.Fatalf("expected: %+v; got: %+v", errSimulated, err)
+			}
+			loaded, _ := jfs.Load()
+			if *loaded != old {
+				t.Fatalf("expected: %+v; got: %+v", old, loaded)
+			}
+		})
+	})
+}
@@ -0,0 +1,639 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrReadOnly = errors.New("store was opened read-only")
+	ErrClosed   = errors.New("store is closed")
+)
+
+const (
+	// KV_SEGMENT_SIZE is the size a segment of a KVStore grows to before
+	// another is started, when no size is given.
+	KV_SEGMENT_SIZE = 64 << 20
+	// KV_DIR_MODE is the permission of the directory of a KVStore.
+	KV_DIR_MODE os.FileMode = 0o755
+)
+
+// KVOptions changes how a KVStore is opened.
+type KVOptions struct {
+	// SegmentSize is the size a segment grows to before another is
+	// started. KV_SEGMENT_SIZE is used when it is zero.
+	SegmentSize int64
+	// ReadOnly opens the store without changing its files, so that it can
+	// be read while another process writes to it. Changes return
+	// ErrReadOnly.
+	ReadOnly bool
+}
+
+// KVStore is a Store that keeps values in a log-structured file format in
+// a directory, so that each value can be read and written on its own.
+//
+// Every change appends a record to the active segment and flushes it to
+// disk before it returns, so the time it takes does not depend on the
+// number of keys. An index in memory holds where the latest record of each
+// key is. When a segment reaches its size, another is started, and once
+// most of the bytes in the segments belong to values that were replaced or
+// deleted, the older segments are compacted into one that only holds the
+// latest records.
+//
+// Values are stored as JSON. Keys can be any string that is not empty, and
+// Scan reads the keys with a prefix in order.
+type KVStore[K ~string, V interface{}] struct {
+	Dir string
+
+	options KVOptions
+
+	// mutex guards the index and the segments. Reads share it, and
+	// changes hold it alone.
+	mutex    sync.RWMutex
+	segments map[uint64]*kvSegment
+	active   *kvSegment
+	index    map[string]kvLocation
+	// size is the number of bytes in every segment, and live is the number
+	// of bytes held by the latest record of each key.
+	size int64
+	live int64
+	// compacting is set while a compaction started by a change runs.
+	compacting bool
+	closed     bool
+
+	// compactMutex is held while older segments are compacted.
+	compactMutex sync.Mutex
+
+	// keysMutex guards keys, which holds the keys of the index in order
+	// when sorted is set. Scan sorts them again after keys are added or
+	// removed.
+	keysMutex sync.Mutex
+	keys      []string
+	sorted    bool
+
+	// watchers are handed the events of each change while mutex is held,
+	// which only queues them, so a watcher that reads the store back does
+	// not hold up changes.
+	watchers watchers[K, V]
+}
+
+// OpenKVStore opens the KVStore in dir, creating it when it does not
+// exist. Changes that a crash stopped part way are dropped.
+func OpenKVStore[K ~string, V interface{}](dir string, options KVOptions) (*KVStore[K, V], error) {
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = KV_SEGMENT_SIZE
+	}
+	kv := &KVStore[K, V]{
+		Dir:      dir,
+		options:  options,
+		segments: map[uint64]*kvSegment{},
+		index:    map[string]kvLocation{},
+	}
+
+	if !options.ReadOnly {
+		if err := os.MkdirAll(dir, KV_DIR_MODE); err != nil {
+			return nil, err
+		}
+		if err := finishCompaction(dir); err != nil {
+			return nil, fmt.Errorf("finish compaction of %s: %w", dir, err)
+		}
+	}
+
+	files, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for n, segmentFile := range files {
+		if err := kv.load(segmentFile, n == len(files)-1); err != nil {
+			kv.Close()
+			return nil, err
+		}
+	}
+
+	if !options.ReadOnly && kv.active == nil {
+		if err := kv.startSegment(1); err != nil {
+			kv.Close()
+			return nil, err
+		}
+	}
+
+	return kv, nil
+}
+
+// load reads the segment in segmentFile into the index. The last segment
+// becomes the active one.
+func (kv *KVStore[K, V]) load(segmentFile kvSegmentFile, last bool) error {
+	flag := os.O_RDWR
+	if kv.options.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(segmentFile.path, flag, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	segment := &kvSegment{id: segmentFile.id, file: f}
+	kv.segments[segment.id] = segment
+
+	// Only the last segment was being appended to when the process
+	// stopped.
+	size, err := readSegment(f, segment.id, last, kv.indexRecord)
+	if err != nil {
+		return err
+	}
+	segment.size = size
+	kv.size += size
+
+	if last {
+		if !kv.options.ReadOnly {
+			// Drop the record that was cut short.
+			if err := truncateFile(f, size); err != nil {
+				return err
+			}
+		}
+		kv.active = segment
+	}
+	return nil
+}
+
+// indexRecord points the index at record, which is at location. It must
+// be called with the store lock held.
+func (kv *KVStore[K, V]) indexRecord(record kvRecord, location kvLocation) {
+	previous, ok := kv.index[record.key]
+	if ok {
+		kv.live -= previous.size
+	}
+
+	if record.kind == KV_RECORD_DELETE {
+		if ok {
+			delete(kv.index, record.key)
+			kv.unsort()
+		}
+		return
+	}
+
+	kv.index[record.key] = location
+	kv.live += location.size
+	if !ok {
+		kv.unsort()
+	}
+}
+
+// unsort marks the keys as needing to be sorted again.
+func (kv *KVStore[K, V]) unsort() {
+	kv.keysMutex.Lock()
+	defer kv.keysMutex.Unlock()
+
+	kv.sorted = false
+}
+
+// startSegment creates the segment with id and makes it the active one. It
+// must be called with the store lock held.
+func (kv *KVStore[K, V]) startSegment(id uint64) error {
+	path := filepath.Join(kv.Dir, kvSegmentName(id, KV_SEGMENT_SUFFIX))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, FILE_MODE)
+	if err != nil {
+		return err
+	}
+
+	// A segment that was just created is only durable once its directory
+	// is flushed.
+	if err := (osFileSystem{}).SyncDir(kv.Dir); err != nil {
+		f.Close()
+		return fmt.Errorf("sync directory of %s: %w", path, err)
+	}
+
+	kv.active = &kvSegment{id: id, file: f}
+	kv.segments[id] = kv.active
+	return nil
+}
+
+// truncateFile cuts f after size bytes and flushes it to disk.
+func truncateFile(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("truncate %s: %w", f.Name(), err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// check returns the error that stops the store from being used.
+func (kv *KVStore[K, V]) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if kv.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// checkKey returns ErrInvalidKey for a key that cannot be stored.
+func checkKey(key string) error {
+	if key == "" || uint64(len(key)) > math.MaxUint32 {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+func (kv *KVStore[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var zero V
+	if err := checkKey(string(key)); err != nil {
+		return zero, err
+	}
+
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+
+	if err := kv.check(ctx); err != nil {
+		return zero, err
+	}
+	location, ok := kv.index[string(key)]
+	if !ok {
+		return zero, ErrNotFound
+	}
+	return kv.read(location)
+}
+
+// read returns the value of the record at location. It must be called with
+// the store lock held.
+func (kv *KVStore[K, V]) read(location kvLocation) (V, error) {
+	var value V
+	segment, ok := kv.segments[location.segment]
+	if !ok {
+		return value, fmt.Errorf("%w: segment %d is missing", ErrCorruptLog, location.segment)
+	}
+
+	record, err := readKVRecord(segment.file, location)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(record.value, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+func (kv *KVStore[K, V]) Set(ctx context.Context, key K, value V) error {
+	if err := checkKey(string(key)); err != nil {
+		return err
+	}
+	rawJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	if err := kv.append(ctx, encodeKVRecord(KV_RECORD_SET, string(key), rawJSON)); err != nil {
+		return err
+	}
+	kv.watchers.notify(Event[K, V]{Kind: EVENT_SET, Key: key, Value: value})
+	return nil
+}
+
+func (kv *KVStore[K, V]) Delete(ctx context.Context, key K) error {
+	if err := checkKey(string(key)); err != nil {
+		return err
+	}
+
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	if err := kv.check(ctx); err != nil {
+		return err
+	}
+	if _, ok := kv.index[string(key)]; !ok {
+		return ErrNotFound
+	}
+	if err := kv.append(ctx, encodeKVRecord(KV_RECORD_DELETE, string(key), nil)); err != nil {
+		return err
+	}
+	kv.watchers.notify(Event[K, V]{Kind: EVENT_DELETE, Key: key})
+	return nil
+}
+
+// append writes raw to the end of the active segment, flushes it to disk
+// and indexes it. A new segment is started first when the active one is
+// full. It must be called with the store lock held.
+func (kv *KVStore[K, V]) append(ctx context.Context, raw []byte) error {
+	if err := kv.check(ctx); err != nil {
+		return err
+	}
+	if kv.options.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if kv.active.size > 0 && kv.active.size+int64(len(raw)) > kv.options.SegmentSize {
+		if err := kv.startSegment(kv.active.id + 1); err != nil {
+			return err
+		}
+	}
+
+	segment := kv.active
+	_, err := segment.file.WriteAt(raw, segment.size)
+	if err == nil {
+		err = segment.file.Sync()
+	}
+	if err != nil {
+		// The record may be partly written, and nothing after it could be
+		// read back, so it is cut off.
+		if truncateErr := truncateFile(segment.file, segment.size); truncateErr != nil {
+			err = errors.Join(err, truncateErr)
+		}
+		return fmt.Errorf("append to %s: %w", segment.file.Name(), err)
+	}
+
+	record, _ := decodeKVRecord(raw)
+	kv.indexRecord(record, kvLocation{segment: segment.id, offset: segment.size, size: int64(len(raw))})
+	segment.size += int64(len(raw))
+	kv.size += int64(len(raw))
+
+	if kv.shouldCompact() {
+		// Errors are dropped, since the compaction is tried again after the
+		// next change.
+		kv.compacting = true
+		go func() {
+			kv.compactMutex.Lock()
+			kv.compact()
+			kv.compactMutex.Unlock()
+
+			kv.mutex.Lock()
+			kv.compacting = false
+			kv.mutex.Unlock()
+		}()
+	}
+	return nil
+}
+
+// shouldCompact reports whether most of the bytes in the segments that are
+// not active belong to records that were replaced or deleted. It must be
+// called with the store lock held.
+func (kv *KVStore[K, V]) shouldCompact() bool {
+	garbage := kv.size - kv.live
+	return !kv.compacting && len(kv.segments) > 1 && garbage >= kv.options.SegmentSize && garbage > kv.live
+}
+
+func (kv *KVStore[K, V]) List(ctx context.Context) (map[K]V, error) {
+	values := map[K]V{}
+	err := kv.Scan(ctx, "", func(key K, value V) error {
+		values[key] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Scan calls fn with every key that starts with prefix and its value, in
+// the order of the keys, and stops at the first error fn returns. Changes
+// wait until the scan is done, so fn must not change the store.
+func (kv *KVStore[K, V]) Scan(ctx context.Context, prefix K, fn func(key K, value V) error) error {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+
+	if err := kv.check(ctx); err != nil {
+		return err
+	}
+
+	keys := kv.sortedKeys()
+	for n := sort.SearchStrings(keys, string(prefix)); n < len(keys) && strings.HasPrefix(keys[n], string(prefix)); n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		value, err := kv.read(kv.index[keys[n]])
+		if err != nil {
+			return err
+		}
+		if err := fn(K(keys[n]), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the index in order. It must be called
+// with the store lock held, and the keys must not be changed.
+func (kv *KVStore[K, V]) sortedKeys() []string {
+	kv.keysMutex.Lock()
+	defer kv.keysMutex.Unlock()
+
+	if !kv.sorted {
+		kv.keys = make([]string, 0, len(kv.index))
+		for key := range kv.index {
+			kv.keys = append(kv.keys, key)
+		}
+		sort.Strings(kv.keys)
+		kv.sorted = true
+	}
+	return kv.keys
+}
+
+// Watch returns a channel that receives the changes made through the
+// store. Changes made by another process are not sent.
+func (kv *KVStore[K, V]) Watch(ctx context.Context) (<-chan Event[K, V], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return kv.watchers.add(ctx), nil
+}
+
+// Len returns the number of keys in the store.
+func (kv *KVStore[K, V]) Len() int {
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+
+	return len(kv.index)
+}
+
+// Compact rewrites every segment before the active one into a single
+// segment that only holds the latest record of each key, and waits until
+// it is done. Changes can be made while it runs.
+func (kv *KVStore[K, V]) Compact(ctx context.Context) error {
+	kv.mutex.RLock()
+	err := kv.check(ctx)
+	kv.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	if kv.options.ReadOnly {
+		return ErrReadOnly
+	}
+
+	kv.compactMutex.Lock()
+	defer kv.compactMutex.Unlock()
+
+	return kv.compact()
+}
+
+// kvMove is a record that a compaction moves to another place.
+type kvMove struct {
+	key  string
+	from kvLocation
+	to   kvLocation
+}
+
+// compact rewrites the segments before the active one. It must be called
+// with compactMutex held.
+//
+// The records are written to a temporary file, which is renamed with the
+// compact suffix once it is flushed. From then on, the compaction is done:
+// should the process stop before the old segments are removed, opening the
+// store finishes it.
+func (kv *KVStore[K, V]) compact() error {
+	kv.mutex.Lock()
+	if kv.closed {
+		kv.mutex.Unlock()
+		return ErrClosed
+	}
+	// Every record to compact should be in a segment that does not change.
+	if kv.active.size > 0 {
+		if err := kv.startSegment(kv.active.id + 1); err != nil {
+			kv.mutex.Unlock()
+			return err
+		}
+	}
+	target := kv.active.id - 1
+	files := map[uint64]*os.File{}
+	for id, segment := range kv.segments {
+		if id <= target {
+			files[id] = segment.file
+		}
+	}
+	moves := []kvMove{}
+	for key, location := range kv.index {
+		if location.segment <= target {
+			moves = append(moves, kvMove{key: key, from: location})
+		}
+	}
+	kv.mutex.Unlock()
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Reading the records in the order they are in the files is faster.
+	sort.Slice(moves, func(a, b int) bool {
+		if moves[a].from.segment != moves[b].from.segment {
+			return moves[a].from.segment < moves[b].from.segment
+		}
+		return moves[a].from.offset < moves[b].from.offset
+	})
+
+	compactPath := filepath.Join(kv.Dir, kvSegmentName(target, KV_COMPACT_SUFFIX))
+	tempPath := compactPath + KV_TEMP_SUFFIX
+	temp, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	size, err := copyRecords(temp, files, moves, target)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tempPath, compactPath)
+	}
+	if err == nil {
+		err = (osFileSystem{}).SyncDir(kv.Dir)
+	}
+	if err != nil {
+		temp.Close()
+		if removeErr := os.Remove(tempPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = errors.Join(err, removeErr)
+		}
+		return fmt.Errorf("compact %s: %w", kv.Dir, err)
+	}
+
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	if kv.closed {
+		// Opening the store finishes the compaction.
+		temp.Close()
+		return ErrClosed
+	}
+
+	// Records that were changed while the compaction ran are in newer
+	// segments, and their index is left as it is.
+	for _, move := range moves {
+		if kv.index[move.key] == move.from {
+			kv.index[move.key] = move.to
+		}
+	}
+	for id, segment := range kv.segments {
+		if id <= target {
+			segment.file.Close()
+			delete(kv.segments, id)
+			kv.size -= segment.size
+		}
+	}
+	kv.segments[target] = &kvSegment{id: target, file: temp, size: size}
+	kv.size += size
+
+	// The file stays open through the rename, so only the names are left
+	// to change.
+	for id := range files {
+		err := os.Remove(filepath.Join(kv.Dir, kvSegmentName(id, KV_SEGMENT_SUFFIX)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("finish compaction of %s: %w", kv.Dir, err)
+		}
+	}
+	if err := os.Rename(compactPath, filepath.Join(kv.Dir, kvSegmentName(target, KV_SEGMENT_SUFFIX))); err != nil {
+		return fmt.Errorf("finish compaction of %s: %w", kv.Dir, err)
+	}
+	return (osFileSystem{}).SyncDir(kv.Dir)
+}
+
+// copyRecords copies the records of moves from files to f, which becomes
+// the segment with id, and sets where each one ends up. It returns the
+// number of bytes written.
+func copyRecords(f *os.File, files map[uint64]*os.File, moves []kvMove, id uint64) (int64, error) {
+	var offset int64
+	for n := range moves {
+		raw := make([]byte, moves[n].from.size)
+		if _, err := files[moves[n].from.segment].ReadAt(raw, moves[n].from.offset); err != nil {
+			return 0, err
+		}
+		if _, err := f.WriteAt(raw, offset); err != nil {
+			return 0, err
+		}
+
+		moves[n].to = kvLocation{segment: id, offset: offset, size: moves[n].from.size}
+		offset += moves[n].from.size
+	}
+	return offset, nil
+}
+
+// Close closes the files of the store. It fails every call made after it,
+// and waits for a compaction that is running so that nothing is written to
+// the directory once it returns.
+func (kv *KVStore[K, V]) Close() error {
+	kv.compactMutex.Lock()
+	defer kv.compactMutex.Unlock()
+	kv.mutex.Lock()
+	defer kv.mutex.Unlock()
+
+	if kv.closed {
+		return nil
+	}
+	kv.closed = true
+
+	var err error
+	for _, segment := range kv.segments {
+		err = errors.Join(err, segment.file.Close())
+	}
+	return err
+}
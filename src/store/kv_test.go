@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKVStore(t *testing.T) {
+	ctx := context.Background()
+
+	open := func(t *testing.T, dir string, options KVOptions) *KVStore[string, record] {
+		kv, err := OpenKVStore[string, record](dir, options)
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		t.Cleanup(func() { kv.Close() })
+		return kv
+	}
+
+	// segmentPaths returns the paths of the segments of the store in dir.
+	segmentPaths := func(t *testing.T, dir string) []string {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*"+KV_SEGMENT_SUFFIX))
+		return paths
+	}
+
+	t.Run("OpenKVStore()", func(t *testing.T) {
+		t.Run("Should read the values stored before", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{SegmentSize: 64})
+			for n := 0; n < 10; n++ {
+				kv.Set(ctx, fmt.Sprintf("item-%d", n), record{Count: n})
+			}
+			kv.Set(ctx, "item-1", record{Count: 100})
+			kv.Delete(ctx, "item-2")
+			kv.Close()
+
+			reopened := open(t, dir, KVOptions{SegmentSize: 64})
+			values, err := reopened.List(ctx)
+			if err != nil || len(values) != 9 || values["item-1"].Count != 100 || values["item-9"].Count != 9 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "9 values", values, err)
+			}
+			if _, ok := values["item-2"]; ok {
+				t.Fatalf("expected: %+v; got: %+v", "item-2 deleted", values["item-2"])
+			}
+			if paths := segmentPaths(t, dir); len(paths) < 2 {
+				t.Fatalf("expected: %+v; got: %+v", "several segments", paths)
+			}
+		})
+
+		t.Run("Should drop a last record that was cut short", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{})
+			kv.Set(ctx, "a", record{Count: 1})
+			kv.Set(ctx, "b", record{Count: 2})
+			kv.Close()
+
+			path := segmentPaths(t, dir)[0]
+			info, _ := os.Stat(path)
+			os.Truncate(path, info.Size()-3)
+
+			reopened := open(t, dir, KVOptions{})
+			if _, err := reopened.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expected: %+v; got: %+v", ErrNotFound, err)
+			}
+			if value, err := reopened.Get(ctx, "a"); err != nil || value.Count != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 1, value, err)
+			}
+
+			// The next record starts where the last whole one ended.
+			reopened.Set(ctx, "c", record{Count: 3})
+			reopened.Close()
+			if value, err := open(t, dir, KVOptions{}).Get(ctx, "c"); err != nil || value.Count != 3 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 3, value, err)
+			}
+		})
+
+		t.Run("Should return an error for a damaged record before others", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{})
+			kv.Set(ctx, "a", record{Count: 1})
+			kv.Set(ctx, "b", record{Count: 2})
+			kv.Close()
+
+			path := segmentPaths(t, dir)[0]
+			content, _ := os.ReadFile(path)
+			content[KV_HEADER_SIZE+1] ^= 0xff
+			os.WriteFile(path, content, FILE_MODE)
+
+			if _, err := OpenKVStore[string, record](dir, KVOptions{}); !errors.Is(err, ErrCorruptLog) {
+				t.Fatalf("expected: %+v; got: %+v", ErrCorruptLog, err)
+			}
+		})
+
+		t.Run("Should finish a compaction that was saved before a crash", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{SegmentSize: 64})
+			// Every key is set once, so that no compaction starts on its own.
+			for n := 0; n < 10; n++ {
+				kv.Set(ctx, fmt.Sprintf("k%d", n), record{Count: n})
+			}
+			kv.Set(ctx, "b", record{Count: 1})
+			kv.Delete(ctx, "b")
+			kv.Close()
+
+			// The compacted segment replaces every segment up to its ID, but
+			// the process stopped before they were removed. The last segment
+			// was written after it.
+			paths := segmentPaths(t, dir)
+			target, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(paths[len(paths)-2]), KV_SEGMENT_SUFFIX), 10, 64)
+			os.WriteFile(
+				filepath.Join(dir, kvSegmentName(target, KV_COMPACT_SUFFIX)),
+				encodeKVRecord(KV_RECORD_SET, "a", []byte(`{"count":9}`)),
+				FILE_MODE,
+			)
+			os.WriteFile(filepath.Join(dir, "stale"+KV_TEMP_SUFFIX), []byte("partial"), FILE_MODE)
+
+			reopened := open(t, dir, KVOptions{SegmentSize: 64})
+			values, err := reopened.List(ctx)
+			if _, ok := values["k0"]; err != nil || ok || values["a"].Count != 9 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "a=9", values, err)
+			}
+			if remaining := segmentPaths(t, dir); len(remaining) != 2 {
+				t.Fatalf("expected: %+v; got: %+v", 2, remaining)
+			}
+			if leftovers, _ := filepath.Glob(filepath.Join(dir, "*"+KV_TEMP_SUFFIX)); len(leftovers) != 0 {
+				t.Fatalf("expected: %+v; got: %+v", "no temporary files", leftovers)
+			}
+		})
+
+		t.Run("Should read without changing the files when read-only", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{})
+			kv.Set(ctx, "a", record{Count: 1})
+
+			path := segmentPaths(t, dir)[0]
+			f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, FILE_MODE)
+			f.Write([]byte{1, 2, 3})
+			f.Close()
+			before, _ := os.ReadFile(path)
+
+			reader := open(t, dir, KVOptions{ReadOnly: true})
+			if value, err := reader.Get(ctx, "a"); err != nil || value.Count != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 1, value, err)
+			}
+			if err := reader.Set(ctx, "b", record{}); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("expected: %+v; got: %+v", ErrReadOnly, err)
+			}
+			if after, _ := os.ReadFile(path); string(after) != string(before) {
+				t.Fatalf("expected: %+v; got: %+v", before, after)
+			}
+		})
+	})
+
+	t.Run("KVStore.Scan()", func(t *testing.T) {
+		t.Run("Should return the keys with the prefix in order", func(t *testing.T) {
+			kv := open(t, t.TempDir(), KVOptions{})
+			for _, key := range []string{"b/2", "a/1", "b/1", "c/1", "b/3"} {
+				kv.Set(ctx, key, record{Name: key})
+			}
+			kv.Delete(ctx, "b/3")
+
+			keys := []string{}
+			err := kv.Scan(ctx, "b/", func(key string, value record) error {
+				if value.Name != key {
+					t.Fatalf("expected: %+v; got: %+v", key, value)
+				}
+				keys = append(keys, key)
+				return nil
+			})
+			if err != nil || fmt.Sprint(keys) != "[b/1 b/2]" {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "[b/1 b/2]", keys, err)
+			}
+		})
+
+		t.Run("Should stop at the first error", func(t *testing.T) {
+			kv := open(t, t.TempDir(), KVOptions{})
+			kv.Set(ctx, "a", record{})
+			kv.Set(ctx, "b", record{})
+
+			calls := 0
+			err := kv.Scan(ctx, "", func(key string, value record) error {
+				calls++
+				return errSimulated
+			})
+			if !errors.Is(err, errSimulated) || calls != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%d calls)", errSimulated, err, calls)
+			}
+		})
+	})
+
+	t.Run("KVStore.Compact()", func(t *testing.T) {
+		t.Run("Should only keep the latest record of each key", func(t *testing.T) {
+			dir := t.TempDir()
+			kv := open(t, dir, KVOptions{SegmentSize: 128})
+			for n := 0; n < 50; n++ {
+				kv.Set(ctx, fmt.Sprintf("item-%d", n%5), record{Count: n})
+			}
+			kv.Set(ctx, "deleted", record{})
+			kv.Delete(ctx, "deleted")
+
+			if err := kv.Compact(ctx); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if kv.size != kv.live || len(segmentPaths(t, dir)) != 2 {
+				t.Fatalf("expected: %+v; got: %+v", kv.live, kv.size)
+			}
+
+			kv.Set(ctx, "item-0", record{Count: 100})
+			kv.Close()
+			values, err := open(t, dir, KVOptions{SegmentSize: 128}).List(ctx)
+			if err != nil || len(values) != 5 || values["item-0"].Count != 100 || values["item-4"].Count != 49 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "5 latest values", values, err)
+			}
+		})
+
+		t.Run("Should keep the size of the store bounded by its values", func(t *testing.T) {
+			kv := open(t, t.TempDir(), KVOptions{SegmentSize: 1024})
+			for n := 0; n < 5000; n++ {
+				if err := kv.Set(ctx, fmt.Sprintf("item-%d", n%10), record{Count: n}); err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+			}
+
+			// A compaction may still be running.
+			kv.Compact(ctx)
+			kv.mutex.RLock()
+			size, live := kv.size, kv.live
+			kv.mutex.RUnlock()
+			if size > 2*live+2*kv.options.SegmentSize {
+				t.Fatalf("expected: %+v; got: %+v", "at most twice the live bytes", size)
+			}
+		})
+	})
+}
@@ -0,0 +1,270 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// KV_RECORD_SET marks a record that stores a value with its key.
+	KV_RECORD_SET byte = 1
+	// KV_RECORD_DELETE marks a record that removes its key.
+	KV_RECORD_DELETE byte = 2
+
+	// KV_HEADER_SIZE is the size of the header of every record: a CRC-32
+	// of the rest of the record, its kind, and the length of its key and
+	// its value.
+	KV_HEADER_SIZE = 13
+
+	// KV_SEGMENT_SUFFIX ends the name of every segment of a KVStore.
+	KV_SEGMENT_SUFFIX = ".seg"
+	// KV_COMPACT_SUFFIX ends the name of a segment written by a compaction
+	// that replaces every segment up to its ID.
+	KV_COMPACT_SUFFIX = ".compact"
+	// KV_TEMP_SUFFIX ends the name of a segment being written by a
+	// compaction, which is dropped when the store is opened.
+	KV_TEMP_SUFFIX = ".tmp"
+)
+
+// kvSegment is a file of a KVStore. Records are only ever appended to the
+// active segment, and the others do not change until they are compacted.
+type kvSegment struct {
+	id   uint64
+	file *os.File
+	// size is the number of bytes of whole records in the file.
+	size int64
+}
+
+// kvLocation is where the latest record of a key is.
+type kvLocation struct {
+	segment uint64
+	offset  int64
+	size    int64
+}
+
+// kvSegmentName returns the name of the file of the segment with id.
+func kvSegmentName(id uint64, suffix string) string {
+	// IDs are padded so that the names sort in the order of the IDs.
+	return fmt.Sprintf("%020d%s", id, suffix)
+}
+
+// kvSegmentFile is a file of a segment found in the directory of a store.
+type kvSegmentFile struct {
+	id   uint64
+	path string
+}
+
+// listSegments returns the segments in dir, oldest first. A compaction
+// that was saved but not finished replaces every segment up to its ID, so
+// those are left out for it.
+func listSegments(dir string) ([]kvSegmentFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := []kvSegmentFile{}
+	var compacted *kvSegmentFile
+	for _, entry := range entries {
+		name := entry.Name()
+		suffix := filepath.Ext(name)
+		if entry.IsDir() || (suffix != KV_SEGMENT_SUFFIX && suffix != KV_COMPACT_SUFFIX) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segment := kvSegmentFile{id: id, path: filepath.Join(dir, name)}
+		if suffix == KV_COMPACT_SUFFIX {
+			if compacted == nil || id > compacted.id {
+				compacted = &segment
+			}
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	if compacted != nil {
+		kept := []kvSegmentFile{*compacted}
+		for _, segment := range segments {
+			if segment.id > compacted.id {
+				kept = append(kept, segment)
+			}
+		}
+		segments = kept
+	}
+	sort.Slice(segments, func(a, b int) bool {
+		return segments[a].id < segments[b].id
+	})
+
+	return segments, nil
+}
+
+// finishCompaction completes a compaction that was saved in dir before the
+// process stopped, by removing the segments it replaces and giving it the
+// name of a segment. Segments that a compaction did not finish writing are
+// removed.
+func finishCompaction(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), KV_TEMP_SUFFIX) {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 || filepath.Ext(segments[0].path) != KV_COMPACT_SUFFIX {
+		return nil
+	}
+
+	compacted := segments[0]
+	for _, entry := range entries {
+		name := entry.Name()
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, KV_SEGMENT_SUFFIX), 10, 64)
+		if err != nil || !strings.HasSuffix(name, KV_SEGMENT_SUFFIX) || id > compacted.id {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(compacted.path, filepath.Join(dir, kvSegmentName(compacted.id, KV_SEGMENT_SUFFIX))); err != nil {
+		return err
+	}
+
+	return (osFileSystem{}).SyncDir(dir)
+}
+
+// encodeKVRecord returns the bytes of a record of kind for key and value.
+func encodeKVRecord(kind byte, key string, value []byte) []byte {
+	record := make([]byte, KV_HEADER_SIZE+len(key)+len(value))
+	record[4] = kind
+	binary.LittleEndian.PutUint32(record[5:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[9:], uint32(len(value)))
+	copy(record[KV_HEADER_SIZE:], key)
+	copy(record[KV_HEADER_SIZE+len(key):], value)
+	binary.LittleEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+
+	return record
+}
+
+// kvRecord is a record read from a segment.
+type kvRecord struct {
+	kind  byte
+	key   string
+	value []byte
+}
+
+// decodeKVRecord reads the record in raw, which holds it whole.
+func decodeKVRecord(raw []byte) (kvRecord, error) {
+	if len(raw) < KV_HEADER_SIZE {
+		return kvRecord{}, io.ErrUnexpectedEOF
+	}
+	keyLength := int64(binary.LittleEndian.Uint32(raw[5:]))
+	valueLength := int64(binary.LittleEndian.Uint32(raw[9:]))
+	if int64(len(raw)) != KV_HEADER_SIZE+keyLength+valueLength {
+		return kvRecord{}, io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(raw[4:]) != binary.LittleEndian.Uint32(raw) {
+		return kvRecord{}, ErrCorruptLog
+	}
+
+	return kvRecord{
+		kind:  raw[4],
+		key:   string(raw[KV_HEADER_SIZE : KV_HEADER_SIZE+keyLength]),
+		value: raw[KV_HEADER_SIZE+keyLength:],
+	}, nil
+}
+
+// readSegment calls apply with every record in f, oldest first, along with
+// where it is. It returns the number of bytes of whole records.
+//
+// A process that dies while appending can leave the last record cut short
+// or with a part of its bytes missing. That record was never acknowledged,
+// so reading stops before it when tail is set. Anywhere else, a damaged
+// record returns ErrCorruptLog.
+func readSegment(f *os.File, id uint64, tail bool, apply func(record kvRecord, location kvLocation)) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(f)
+	header := make([]byte, KV_HEADER_SIZE)
+	var offset int64
+	for offset < info.Size() {
+		corrupt := func(reason error) (int64, error) {
+			if tail {
+				return offset, nil
+			}
+			return offset, fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, f.Name(), offset, reason)
+		}
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return corrupt(err)
+		}
+		size := KV_HEADER_SIZE + int64(binary.LittleEndian.Uint32(header[5:])) + int64(binary.LittleEndian.Uint32(header[9:]))
+		if offset+size > info.Size() {
+			return corrupt(io.ErrUnexpectedEOF)
+		}
+
+		raw := make([]byte, size)
+		copy(raw, header)
+		if _, err := io.ReadFull(reader, raw[KV_HEADER_SIZE:]); err != nil {
+			return corrupt(err)
+		}
+		record, err := decodeKVRecord(raw)
+		if err == nil && record.kind != KV_RECORD_SET && record.kind != KV_RECORD_DELETE {
+			err = fmt.Errorf("unknown record kind %d", record.kind)
+		}
+		if err != nil {
+			if offset+size == info.Size() {
+				return corrupt(err)
+			}
+			// Records after this one were written whole, so this one was
+			// damaged after it was written.
+			return offset, fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, f.Name(), offset, err)
+		}
+
+		apply(record, kvLocation{segment: id, offset: offset, size: size})
+		offset += size
+	}
+
+	return offset, nil
+}
+
+// readKVRecord reads the record at location in f.
+func readKVRecord(f *os.File, location kvLocation) (kvRecord, error) {
+	raw := make([]byte, location.size)
+	if _, err := f.ReadAt(raw, location.offset); err != nil {
+		return kvRecord{}, err
+	}
+
+	record, err := decodeKVRecord(raw)
+	if err != nil {
+		return kvRecord{}, fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, f.Name(), location.offset, err)
+	}
+	return record, nil
+}
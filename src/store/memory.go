@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// MemoryStore is a Store that holds its values in memory. The zero value
+// is an empty store that is ready to use.
+type MemoryStore[K comparable, V interface{}] struct {
+	// mutex is held while the events of a change are queued for watchers,
+	// so that they see the changes in the order they were made.
+	mutex    sync.RWMutex
+	values   map[K]V
+	watchers watchers[K, V]
+}
+
+// NewMemoryStore returns a MemoryStore that holds a copy of values.
+func NewMemoryStore[K comparable, V interface{}](values map[K]V) *MemoryStore[K, V] {
+	return &MemoryStore[K, V]{values: maps.Clone(values)}
+}
+
+func (ms *MemoryStore[K, V]) Get(ctx context.Context, key K) (V, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	value, ok := ms.values[key]
+	if !ok {
+		return zero, ErrNotFound
+	}
+	return value, nil
+}
+
+func (ms *MemoryStore[K, V]) Set(ctx context.Context, key K, value V) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if ms.values == nil {
+		ms.values = map[K]V{}
+	}
+	ms.values[key] = value
+	ms.watchers.notify(Event[K, V]{Kind: EVENT_SET, Key: key, Value: value})
+	return nil
+}
+
+func (ms *MemoryStore[K, V]) Delete(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if _, ok := ms.values[key]; !ok {
+		return ErrNotFound
+	}
+	delete(ms.values, key)
+	ms.watchers.notify(Event[K, V]{Kind: EVENT_DELETE, Key: key})
+	return nil
+}
+
+func (ms *MemoryStore[K, V]) List(ctx context.Context) (map[K]V, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	values := maps.Clone(ms.values)
+	if values == nil {
+		values = map[K]V{}
+	}
+	return values, nil
+}
+
+func (ms *MemoryStore[K, V]) Watch(ctx context.Context) (<-chan Event[K, V], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return ms.watchers.add(ctx), nil
+}
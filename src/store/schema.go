@@ -0,0 +1,262 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	ErrNewerVersion   = errors.New("data was saved by a newer version of its schema")
+	ErrSchemaMismatch = errors.New("data was saved with another schema")
+	ErrInvalidSchema  = errors.New("schema migrations are not in order")
+)
+
+// Envelope is how JSONFileStore saves a value: the value itself along with
+// the schema and version it was saved with, so that older data can be
+// migrated when it is loaded. Files saved before envelopes existed are at
+// version 0.
+type Envelope struct {
+	Schema  string          `json:"schema,omitempty"`
+	Version int             `json:"schemaVersion"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// decodeEnvelope reads the envelope in raw. Anything that is not an
+// envelope is data saved before envelopes existed.
+func decodeEnvelope(raw []byte) (Envelope, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err == nil {
+		if _, ok := keys["schemaVersion"]; ok {
+			var envelope Envelope
+			if err := json.Unmarshal(raw, &envelope); err != nil {
+				return Envelope{}, err
+			}
+			return envelope, nil
+		}
+	}
+
+	return Envelope{Data: raw}, nil
+}
+
+// Migration changes data saved with the version before Version to the
+// shape that Version expects.
+type Migration struct {
+	Version int
+	// Description says what the migration changes, for reports.
+	Description string
+	Migrate     func(data json.RawMessage) (json.RawMessage, error)
+}
+
+// Schema names a kind of stored data and lists the migrations that bring
+// data saved with an older version of it up to the latest, in ascending
+// order of their versions. The first version is 1, and a version without
+// a migration leaves the data as it is.
+type Schema struct {
+	Name       string
+	Migrations []Migration
+}
+
+// Version returns the latest version of the schema.
+func (s Schema) Version() int {
+	if len(s.Migrations) == 0 {
+		return 1
+	}
+	return max(1, s.Migrations[len(s.Migrations)-1].Version)
+}
+
+// Upgrade runs every migration after version on data, oldest first, and
+// returns the data in the latest version along with the migrations that
+// ran. Data from a version newer than the schema returns ErrNewerVersion.
+func (s Schema) Upgrade(data json.RawMessage, version int) (json.RawMessage, []Migration, error) {
+	return s.upgrade(data, version, nil)
+}
+
+// upgrade is Upgrade, calling step with the data before and after each
+// migration when it is not nil.
+func (s Schema) upgrade(data json.RawMessage, version int, step func(migration Migration, before json.RawMessage, after json.RawMessage)) (json.RawMessage, []Migration, error) {
+	if version > s.Version() {
+		return nil, nil, fmt.Errorf("%w: %s is at version %d, expected at most %d", ErrNewerVersion, s.Name, version, s.Version())
+	}
+
+	applied := []Migration{}
+	previous := 0
+	for _, migration := range s.Migrations {
+		if migration.Version <= previous {
+			return nil, nil, fmt.Errorf("%w: %s has version %d after %d", ErrInvalidSchema, s.Name, migration.Version, previous)
+		}
+		previous = migration.Version
+		if migration.Version <= version {
+			continue
+		}
+
+		migrated, err := migration.Migrate(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migrate %s to version %d: %w", s.Name, migration.Version, err)
+		}
+		if step != nil {
+			step(migration, data, migrated)
+		}
+		data = migrated
+		applied = append(applied, migration)
+	}
+
+	return data, applied, nil
+}
+
+// load reads the value saved in raw and migrates it to the latest version
+// of the schema. It returns the version the value was saved with.
+func (s Schema) load(raw []byte) (json.RawMessage, int, error) {
+	envelope, err := decodeEnvelope(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	if envelope.Schema != "" && s.Name != "" && envelope.Schema != s.Name {
+		return nil, 0, fmt.Errorf("%w: expected %s, got %s", ErrSchemaMismatch, s.Name, envelope.Schema)
+	}
+
+	data, _, err := s.Upgrade(envelope.Data, envelope.Version)
+	return data, envelope.Version, err
+}
+
+// wrap returns the envelope of data in the latest version of the schema.
+func (s Schema) wrap(data json.RawMessage) Envelope {
+	return Envelope{Schema: s.Name, Version: s.Version(), Data: data}
+}
+
+// Migrated is implemented by values that want to know when they were
+// loaded from an older version of their schema, such as to save themselves
+// again in the latest one.
+type Migrated interface {
+	SetMigratedFrom(version int)
+}
+
+// MigrationStep reports what a migration changed.
+type MigrationStep struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	// Added, Removed and Changed list the top-level keys of the data that
+	// the migration added, removed or changed.
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// MigrationReport describes the migration of a file.
+type MigrationReport struct {
+	Path   string          `json:"path"`
+	Schema string          `json:"schema"`
+	From   int             `json:"from"`
+	To     int             `json:"to"`
+	Steps  []MigrationStep `json:"steps"`
+	// Saved is set when the file was replaced with the migrated data.
+	Saved bool `json:"saved"`
+	// Backup is where the file was kept as it was before it was saved.
+	Backup string `json:"backup,omitempty"`
+}
+
+// MigrateFile migrates the file at path to the latest version of schema
+// and reports what changed. The file is only replaced when save is set
+// and it is not at the latest version already, and a backup of it is
+// kept.
+func MigrateFile(path string, schema Schema, save bool) (MigrationReport, error) {
+	report := MigrationReport{Path: path, Schema: schema.Name, Steps: []MigrationStep{}}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	envelope, err := decodeEnvelope(raw)
+	if err != nil {
+		return report, err
+	}
+	if envelope.Schema != "" && envelope.Schema != schema.Name {
+		return report, fmt.Errorf("%w: expected %s, got %s", ErrSchemaMismatch, schema.Name, envelope.Schema)
+	}
+	report.From = envelope.Version
+	report.To = schema.Version()
+
+	data, _, err := schema.upgrade(envelope.Data, envelope.Version, func(migration Migration, before json.RawMessage, after json.RawMessage) {
+		added, removed, changed := compareKeys(before, after)
+		report.Steps = append(report.Steps, MigrationStep{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Added:       added,
+			Removed:     removed,
+			Changed:     changed,
+		})
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if !save || (envelope.Version == schema.Version() && envelope.Schema == schema.Name) {
+		return report, nil
+	}
+
+	jfs := JSONFileStore[json.RawMessage]{Path: path, Backups: 1, Schema: schema}
+	if err := jfs.Save(data); err != nil {
+		return report, err
+	}
+	report.Saved = true
+	report.Backup = jfs.backupPath(0)
+
+	return report, nil
+}
+
+// compareKeys returns the top-level keys that after adds, removes and
+// changes from before. Data that is not an object has no keys.
+func compareKeys(before json.RawMessage, after json.RawMessage) ([]string, []string, []string) {
+	var beforeKeys, afterKeys map[string]json.RawMessage
+	json.Unmarshal(before, &beforeKeys)
+	json.Unmarshal(after, &afterKeys)
+
+	added, removed, changed := []string{}, []string{}, []string{}
+	for key, value := range afterKeys {
+		previous, ok := beforeKeys[key]
+		if !ok {
+			added = append(added, key)
+		} else if !jsonEqual(previous, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range beforeKeys {
+		if _, ok := afterKeys[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return added, removed, changed
+}
+
+// jsonEqual reports whether a and b hold the same JSON value, whatever
+// their spacing and the order of their keys.
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	var aValue, bValue interface{}
+	if json.Unmarshal(a, &aValue) != nil || json.Unmarshal(b, &bValue) != nil {
+		return bytes.Equal(a, b)
+	}
+	aJSON, _ := json.Marshal(aValue)
+	bJSON, _ := json.Marshal(bValue)
+	return bytes.Equal(aJSON, bJSON)
+}
+
+// SchemaOf returns the name of the schema that the file at path was saved
+// with. Files saved before envelopes existed have no name.
+func SchemaOf(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	envelope, err := decodeEnvelope(raw)
+	if err != nil {
+		return "", err
+	}
+	return envelope.Schema, nil
+}
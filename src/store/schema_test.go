@@ -0,0 +1,148 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	// renameKey returns a migration that moves the value of from to to.
+	renameKey := func(from string, to string) func(data json.RawMessage) (json.RawMessage, error) {
+		return func(data json.RawMessage) (json.RawMessage, error) {
+			var keys map[string]json.RawMessage
+			if err := json.Unmarshal(data, &keys); err != nil {
+				return nil, err
+			}
+			keys[to] = keys[from]
+			delete(keys, from)
+			return json.Marshal(keys)
+		}
+	}
+
+	schema := Schema{
+		Name: "record",
+		Migrations: []Migration{
+			{Version: 1, Description: "rename title to name", Migrate: renameKey("title", "name")},
+			{Version: 3, Description: "rename total to count", Migrate: renameKey("total", "count")},
+		},
+	}
+
+	t.Run("Schema.Upgrade()", func(t *testing.T) {
+		t.Run("Should run the migrations after the version in order", func(t *testing.T) {
+			cases := []struct {
+				version  int
+				data     string
+				expected string
+				applied  int
+			}{
+				{0, `{"title":"a","total":1}`, `{"count":1,"name":"a"}`, 2},
+				{2, `{"name":"a","total":1}`, `{"count":1,"name":"a"}`, 1},
+				{3, `{"name":"a","count":1}`, `{"name":"a","count":1}`, 0},
+			}
+
+			for _, tc := range cases {
+				data, applied, err := schema.Upgrade(json.RawMessage(tc.data), tc.version)
+				if err != nil || string(data) != tc.expected || len(applied) != tc.applied {
+					t.Fatalf("%d: expected: %+v; got: %+v (%v)", tc.version, tc.expected, string(data), err)
+				}
+			}
+		})
+
+		t.Run("Should return an error for data from a newer version", func(t *testing.T) {
+			if _, _, err := schema.Upgrade(json.RawMessage(`{}`), 4); !errors.Is(err, ErrNewerVersion) {
+				t.Fatalf("expected: %+v; got: %+v", ErrNewerVersion, err)
+			}
+		})
+
+		t.Run("Should return an error for migrations out of order", func(t *testing.T) {
+			unordered := Schema{Migrations: []Migration{schema.Migrations[1], schema.Migrations[0]}}
+			if _, _, err := unordered.Upgrade(json.RawMessage(`{}`), 0); !errors.Is(err, ErrInvalidSchema) {
+				t.Fatalf("expected: %+v; got: %+v", ErrInvalidSchema, err)
+			}
+		})
+	})
+
+	t.Run("JSONFileStore.Load()", func(t *testing.T) {
+		t.Run("Should migrate data saved before envelopes existed", func(t *testing.T) {
+			jfs := JSONFileStore[record]{Path: filepath.Join(t.TempDir(), "record.json"), Schema: schema}
+			os.WriteFile(jfs.Path, []byte(`{"title":"a","total":2}`), FILE_MODE)
+
+			loaded, err := jfs.Load()
+			if err != nil || loaded.Name != "a" || loaded.Count != 2 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", record{Name: "a", Count: 2}, loaded, err)
+			}
+		})
+
+		t.Run("Should save data in an envelope with the latest version", func(t *testing.T) {
+			jfs := JSONFileStore[record]{Path: filepath.Join(t.TempDir(), "record.json"), Schema: schema}
+			jfs.Save(record{Name: "a", Count: 2})
+
+			raw, _ := os.ReadFile(jfs.Path)
+			var envelope Envelope
+			json.Unmarshal(raw, &envelope)
+			if envelope.Schema != "record" || envelope.Version != 3 || string(envelope.Data) != `{"name":"a","count":2}` {
+				t.Fatalf("expected: %+v; got: %+v", "record at version 3", string(raw))
+			}
+			if loaded, err := jfs.Load(); err != nil || *loaded != (record{Name: "a", Count: 2}) {
+				t.Fatalf("expected: %+v; got: %+v (%v)", record{Name: "a", Count: 2}, loaded, err)
+			}
+		})
+
+		t.Run("Should return an error for data of another schema", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "record.json")
+			JSONFileStore[record]{Path: path, Schema: Schema{Name: "other"}}.Save(record{})
+
+			_, err := JSONFileStore[record]{Path: path, Schema: schema}.Load()
+			if !errors.Is(err, ErrSchemaMismatch) {
+				t.Fatalf("expected: %+v; got: %+v", ErrSchemaMismatch, err)
+			}
+		})
+	})
+
+	t.Run("MigrateFile()", func(t *testing.T) {
+		t.Run("Should report what each migration changed", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "record.json")
+			original := `{"title":"a","total":2}`
+			os.WriteFile(path, []byte(original), FILE_MODE)
+
+			report, err := MigrateFile(path, schema, false)
+			if err != nil || report.From != 0 || report.To != 3 || report.Saved || len(report.Steps) != 2 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "2 steps from 0 to 3", report, err)
+			}
+			if step := report.Steps[0]; step.Version != 1 || fmt.Sprint(step.Added, step.Removed) != "[name] [title]" {
+				t.Fatalf("expected: %+v; got: %+v", "title renamed to name", step)
+			}
+			if raw, _ := os.ReadFile(path); string(raw) != original {
+				t.Fatalf("expected: %+v; got: %+v", original, string(raw))
+			}
+		})
+
+		t.Run("Should save the migrated data and keep a backup", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "record.json")
+			original := `{"title":"a","total":2}`
+			os.WriteFile(path, []byte(original), FILE_MODE)
+
+			report, err := MigrateFile(path, schema, true)
+			if err != nil || !report.Saved {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "saved", report, err)
+			}
+			if raw, _ := os.ReadFile(report.Backup); string(raw) != original {
+				t.Fatalf("expected: %+v; got: %+v", original, string(raw))
+			}
+			if raw, _ := os.ReadFile(path); !strings.Contains(string(raw), `"schemaVersion":3`) {
+				t.Fatalf("expected: %+v; got: %+v", "version 3", string(raw))
+			}
+
+			// The file is at the latest version now.
+			report, err = MigrateFile(path, schema, true)
+			if err != nil || report.Saved || len(report.Steps) != 0 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", "nothing to migrate", report, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	_ Store[string, record] = (*MemoryStore[string, record])(nil)
+	_ Store[string, record] = (*FileStore[string, record])(nil)
+	_ Store[string, record] = (*KVStore[string, record])(nil)
+)
+
+func TestStore(t *testing.T) {
+	stores := []struct {
+		name  string
+		setup func(t *testing.T) Store[string, record]
+	}{
+		{"MemoryStore", func(t *testing.T) Store[string, record] {
+			return &MemoryStore[string, record]{}
+		}},
+		{"FileStore", func(t *testing.T) Store[string, record] {
+			return NewFileStore[string, record](t.TempDir())
+		}},
+		{"KVStore", func(t *testing.T) Store[string, record] {
+			kv, err := OpenKVStore[string, record](t.TempDir(), KVOptions{})
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			t.Cleanup(func() { kv.Close() })
+			return kv
+		}},
+	}
+
+	for _, s := range stores {
+		t.Run(s.name+".Get()", func(t *testing.T) {
+			t.Run("Should return the value that was set", func(t *testing.T) {
+				store := s.setup(t)
+				store.Set(context.Background(), "a", record{Name: "a", Count: 1})
+
+				value, err := store.Get(context.Background(), "a")
+				if err != nil || value.Count != 1 {
+					t.Fatalf("expected: %+v; got: %+v (%v)", 1, value, err)
+				}
+			})
+
+			t.Run("Should return ErrNotFound for a missing key", func(t *testing.T) {
+				store := s.setup(t)
+				if _, err := store.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected: %+v; got: %+v", ErrNotFound, err)
+				}
+			})
+
+			t.Run("Should return the error of a context that is done", func(t *testing.T) {
+				store := s.setup(t)
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				if _, err := store.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+					t.Fatalf("expected: %+v; got: %+v", context.Canceled, err)
+				}
+			})
+		})
+
+		t.Run(s.name+".Delete()", func(t *testing.T) {
+			t.Run("Should remove the value", func(t *testing.T) {
+				store := s.setup(t)
+				store.Set(context.Background(), "a", record{Count: 1})
+
+				if err := store.Delete(context.Background(), "a"); err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+				if _, err := store.Get(context.Background(), "a"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected: %+v; got: %+v", ErrNotFound, err)
+				}
+				if err := store.Delete(context.Background(), "a"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected: %+v; got: %+v", ErrNotFound, err)
+				}
+			})
+		})
+
+		t.Run(s.name+".List()", func(t *testing.T) {
+			t.Run("Should return every value by its key", func(t *testing.T) {
+				store := s.setup(t)
+				store.Set(context.Background(), "a", record{Count: 1})
+				store.Set(context.Background(), "b", record{Count: 2})
+
+				values, err := store.List(context.Background())
+				if err != nil || len(values) != 2 || values["a"].Count != 1 || values["b"].Count != 2 {
+					t.Fatalf("expected: %+v; got: %+v (%v)", "a and b", values, err)
+				}
+			})
+		})
+
+		t.Run(s.name+".Watch()", func(t *testing.T) {
+			t.Run("Should send every change in order until the context is done", func(t *testing.T) {
+				store := s.setup(t)
+				ctx, cancel := context.WithCancel(context.Background())
+				events, err := store.Watch(ctx)
+				if err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+
+				store.Set(context.Background(), "a", record{Count: 1})
+				store.Delete(context.Background(), "a")
+
+				if event := <-events; event.Kind != EVENT_SET || event.Key != "a" || event.Value.Count != 1 {
+					t.Fatalf("expected: %+v; got: %+v", EVENT_SET, event)
+				}
+				if event := <-events; event.Kind != EVENT_DELETE || event.Key != "a" {
+					t.Fatalf("expected: %+v; got: %+v", EVENT_DELETE, event)
+				}
+
+				cancel()
+				if _, ok := <-events; ok {
+					t.Fatalf("expected: %+v; got: %+v", "closed channel", ok)
+				}
+			})
+
+			t.Run("Should send concurrent changes in the order they were made", func(t *testing.T) {
+				store := s.setup(t)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				events, err := store.Watch(ctx)
+				if err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+
+				var group sync.WaitGroup
+				for count := 1; count <= 20; count++ {
+					group.Add(1)
+					go func(count int) {
+						defer group.Done()
+						store.Set(context.Background(), "a", record{Count: count})
+					}(count)
+				}
+				var last Event[string, record]
+				for received := 0; received < 20; received++ {
+					last = <-events
+				}
+				group.Wait()
+
+				// The last event holds the value that was set last.
+				if value, _ := store.Get(ctx, "a"); last.Value != value {
+					t.Fatalf("expected: %+v; got: %+v", value, last.Value)
+				}
+			})
+
+			t.Run("Should not hold changes while a watcher reads the store back", func(t *testing.T) {
+				store := s.setup(t)
+				store.Set(context.Background(), "a", record{Count: 0})
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				events, err := store.Watch(ctx)
+				if err != nil {
+					t.Fatalf("expected: %+v; got: %+v", nil, err)
+				}
+
+				// More changes are made than the watcher buffers before it
+				// starts to read.
+				changes := WATCH_BUFFER_SIZE * 4
+				go func() {
+					for count := 1; count <= changes; count++ {
+						store.Set(context.Background(), "a", record{Count: count})
+					}
+				}()
+				time.Sleep(10 * time.Millisecond)
+
+				done := make(chan error)
+				go func() {
+					for received := 0; received < changes; received++ {
+						if _, err := store.Get(ctx, "a"); err != nil {
+							done <- err
+							return
+						}
+						<-events
+					}
+					done <- nil
+				}()
+
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatalf("expected: %+v; got: %+v", nil, err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("expected: %+v; got: %+v", "every event read", "watcher blocked")
+				}
+			})
+		})
+	}
+
+	t.Run("FileStore.Set()", func(t *testing.T) {
+		t.Run("Should refuse keys that are not a file name", func(t *testing.T) {
+			store := NewFileStore[string, record](t.TempDir())
+			for _, key := range []string{"", ".", "..", "../a", "a/b", `a\b`} {
+				if err := store.Set(context.Background(), key, record{}); !errors.Is(err, ErrInvalidKey) {
+					t.Fatalf("%q: expected: %+v; got: %+v", key, ErrInvalidKey, err)
+				}
+			}
+		})
+	})
+
+	t.Run("ForFile()", func(t *testing.T) {
+		t.Run("Should store the value in the file at path", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			os.WriteFile(path, []byte(`{"count":1}`), FILE_MODE)
+
+			store, key := ForFile[record](path)
+			value, err := store.Get(context.Background(), key)
+			if err != nil || key != "storage" || value.Count != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 1, value, err)
+			}
+
+			store.Set(context.Background(), key, record{Count: 2})
+			stored, _ := JSONFileStore[record]{Path: path}.Load()
+			if stored.Count != 2 {
+				t.Fatalf("expected: %+v; got: %+v", 2, stored)
+			}
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrCorruptLog is returned when a record in the middle of a log cannot be
+// read. A damaged last record is expected after a crash and is dropped
+// instead.
+var ErrCorruptLog = errors.New("log record is corrupt")
+
+// logFile is the part of *os.File that WriteAheadLog reads and writes
+// through, so that tests can make any step fail.
+type logFile interface {
+	file
+	io.ReadSeeker
+	Truncate(size int64) error
+	Stat() (os.FileInfo, error)
+}
+
+// WriteAheadLog is an append-only log of records of type T in a file. Each
+// record is a line of JSON and is flushed to disk before Append returns,
+// so a record that was appended survives a crash.
+type WriteAheadLog[T interface{}] struct {
+	Path string
+
+	mutex sync.Mutex
+	file  logFile
+	// count is the number of records in the log.
+	count int
+}
+
+// OpenWriteAheadLog opens the log at path, creating it when it does not
+// exist. Replay should be called before the first Append.
+func OpenWriteAheadLog[T interface{}](path string) (*WriteAheadLog[T], error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, FILE_MODE)
+	if err != nil {
+		return nil, err
+	}
+
+	// A log that was just created is only durable once its directory is
+	// flushed.
+	if err := (osFileSystem{}).SyncDir(filepath.Dir(path)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("sync directory of %s: %w", path, err)
+	}
+
+	return &WriteAheadLog[T]{Path: path, file: f}, nil
+}
+
+// Replay calls apply with every record in the log, oldest first, and stops
+// at the first error it returns.
+//
+// A process that dies while appending can leave the last record cut short.
+// That record was never acknowledged, so it is dropped and the log is
+// truncated after the last whole record. A damaged record followed by
+// others returns ErrCorruptLog.
+func (w *WriteAheadLog[T]) Replay(apply func(record T) error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	offset, count, err := readRecords(w.file, w.Path, apply)
+	if err != nil {
+		return err
+	}
+	w.count = count
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > offset {
+		// The last record was not written in full.
+		return w.truncateAt(offset)
+	}
+	return nil
+}
+
+// ReadLog calls apply with every record in the log at path, oldest first,
+// like Replay does, but leaves the file as it is. A log that does not
+// exist has no records.
+func ReadLog[T interface{}](path string, apply func(record T) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, err = readRecords(f, path, apply)
+	return err
+}
+
+// readRecords calls apply with every whole record read from r and returns
+// the number of bytes and records that were read. A damaged last record is
+// not counted.
+func readRecords[T interface{}](r io.Reader, path string, apply func(record T) error) (int64, int, error) {
+	reader := bufio.NewReader(r)
+	var offset int64
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Anything after the last line break was not written in full.
+			return offset, count, nil
+		}
+		if err != nil {
+			return offset, count, err
+		}
+
+		var record T
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				// The last record was not written in full.
+				return offset, count, nil
+			}
+			return offset, count, fmt.Errorf("%w: %s at byte %d: %v", ErrCorruptLog, path, offset, err)
+		}
+		if err := apply(record); err != nil {
+			return offset, count, err
+		}
+
+		offset += int64(len(line))
+		count++
+	}
+}
+
+// Append writes record to the end of the log and flushes it to disk. When
+// it returns an error, the log is left as it was before.
+func (w *WriteAheadLog[T]) Append(record T) error {
+	rawJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	rawJSON = append(rawJSON, '\n')
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return fmt.Errorf("append to %s: %w", w.Path, err)
+	}
+
+	// The record is written at once so that a crash cuts at most the last
+	// record short.
+	_, err = w.file.Write(rawJSON)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		// The record may be partly or wholly written, but it was not
+		// acknowledged, so it is cut off before it can be replayed.
+		if truncateErr := w.truncateAt(info.Size()); truncateErr != nil {
+			err = errors.Join(err, truncateErr)
+		}
+		return fmt.Errorf("append to %s: %w", w.Path, err)
+	}
+	w.count++
+
+	return nil
+}
+
+// Len returns the number of records in the log.
+func (w *WriteAheadLog[T]) Len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.count
+}
+
+// Truncate removes every record from the log. It is called once the
+// records are saved somewhere else, such as a snapshot.
+func (w *WriteAheadLog[T]) Truncate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.truncateAt(0)
+}
+
+// truncateAt cuts the log after offset bytes. It must be called with the
+// log lock held.
+func (w *WriteAheadLog[T]) truncateAt(offset int64) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return fmt.Errorf("truncate %s: %w", w.Path, err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", w.Path, err)
+	}
+	if offset == 0 {
+		w.count = 0
+	}
+
+	return nil
+}
+
+// Close closes the file of the log.
+func (w *WriteAheadLog[T]) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.file.Close()
+}
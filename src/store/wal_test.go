@@ -0,0 +1,197 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingLog writes and syncs through failing, so that the log can be made
+// to fail like a file that JSONFileStore saves.
+type failingLog struct {
+	logFile
+	failing *failingFile
+}
+
+func (f *failingLog) Write(p []byte) (int, error) {
+	return f.failing.Write(p)
+}
+
+func (f *failingLog) Sync() error {
+	return f.failing.Sync()
+}
+
+func TestWriteAheadLog(t *testing.T) {
+	setup := func(t *testing.T, records ...record) *WriteAheadLog[record] {
+		wal, err := OpenWriteAheadLog[record](filepath.Join(t.TempDir(), "storage.wal"))
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		t.Cleanup(func() { wal.Close() })
+
+		for _, r := range records {
+			if err := wal.Append(r); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+		}
+		return wal
+	}
+
+	// replayed reopens the log at path and returns its records.
+	replayed := func(t *testing.T, path string) ([]record, *WriteAheadLog[record], error) {
+		wal, err := OpenWriteAheadLog[record](path)
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		t.Cleanup(func() { wal.Close() })
+
+		records := []record{}
+		err = wal.Replay(func(r record) error {
+			records = append(records, r)
+			return nil
+		})
+		return records, wal, err
+	}
+
+	appendRaw := func(t *testing.T, path string, raw string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, FILE_MODE)
+		if err != nil {
+			t.Fatalf("expected: %+v; got: %+v", nil, err)
+		}
+		defer f.Close()
+		f.WriteString(raw)
+	}
+
+	t.Run("WriteAheadLog.Replay()", func(t *testing.T) {
+		t.Run("Should return every record in order", func(t *testing.T) {
+			wal := setup(t, record{Count: 1}, record{Count: 2})
+			wal.Close()
+
+			records, reopened, err := replayed(t, wal.Path)
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			if len(records) != 2 || records[0].Count != 1 || records[1].Count != 2 || reopened.Len() != 2 {
+				t.Fatalf("expected: %+v; got: %+v", []int{1, 2}, records)
+			}
+		})
+
+		t.Run("Should drop a last record that was cut short", func(t *testing.T) {
+			wal := setup(t, record{Count: 1})
+			wal.Close()
+			appendRaw(t, wal.Path, `{"name":"cut","cou`)
+
+			records, reopened, err := replayed(t, wal.Path)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 1, records, err)
+			}
+
+			// The next record starts on a line of its own.
+			if err := reopened.Append(record{Count: 3}); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			reopened.Close()
+			records, _, err = replayed(t, wal.Path)
+			if err != nil || len(records) != 2 || records[1].Count != 3 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", []int{1, 3}, records, err)
+			}
+		})
+
+		t.Run("Should return an error for a damaged record before others", func(t *testing.T) {
+			wal := setup(t, record{Count: 1})
+			wal.Close()
+			appendRaw(t, wal.Path, "not json\n{\"count\":2}\n")
+
+			_, _, err := replayed(t, wal.Path)
+			if !errors.Is(err, ErrCorruptLog) {
+				t.Fatalf("expected: %+v; got: %+v", ErrCorruptLog, err)
+			}
+		})
+	})
+
+	t.Run("WriteAheadLog.Append()", func(t *testing.T) {
+		t.Run("Should leave the log as it was when a record cannot be written", func(t *testing.T) {
+			cases := []struct {
+				failAt string
+				limit  int
+			}{
+				// The record is cut short.
+				{"write", 5},
+				// The record is written in full but not flushed.
+				{"sync", -1},
+			}
+
+			for _, tc := range cases {
+				wal := setup(t, record{Count: 1})
+				osFile := wal.file
+				wal.file = &failingLog{
+					logFile: osFile,
+					failing: &failingFile{file: osFile, limit: tc.limit, failSync: tc.failAt == "sync"},
+				}
+
+				if err := wal.Append(record{Count: 2}); !errors.Is(err, errSimulated) {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.failAt, errSimulated, err)
+				}
+				wal.file = osFile
+				wal.Append(record{Count: 3})
+				if wal.Len() != 2 {
+					t.Fatalf("%s: expected: %+v; got: %+v", tc.failAt, 2, wal.Len())
+				}
+				wal.Close()
+
+				records, _, err := replayed(t, wal.Path)
+				if err != nil || len(records) != 2 || records[0].Count != 1 || records[1].Count != 3 {
+					t.Fatalf("%s: expected: %+v; got: %+v (%v)", tc.failAt, []int{1, 3}, records, err)
+				}
+			}
+		})
+	})
+
+	t.Run("WriteAheadLog.Truncate()", func(t *testing.T) {
+		t.Run("Should remove every record", func(t *testing.T) {
+			wal := setup(t, record{Count: 1}, record{Count: 2})
+
+			if err := wal.Truncate(); err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+			wal.Append(record{Count: 3})
+			wal.Close()
+
+			records, _, _ := replayed(t, wal.Path)
+			if len(records) != 1 || records[0].Count != 3 {
+				t.Fatalf("expected: %+v; got: %+v", []int{3}, records)
+			}
+		})
+	})
+
+	t.Run("ReadLog()", func(t *testing.T) {
+		t.Run("Should read the records without changing the file", func(t *testing.T) {
+			wal := setup(t, record{Count: 1})
+			appendRaw(t, wal.Path, `{"cou`)
+			before, _ := os.ReadFile(wal.Path)
+
+			count := 0
+			err := ReadLog(wal.Path, func(r record) error {
+				count++
+				return nil
+			})
+			if err != nil || count != 1 {
+				t.Fatalf("expected: %+v; got: %+v (%v)", 1, count, err)
+			}
+			if after, _ := os.ReadFile(wal.Path); string(after) != string(before) {
+				t.Fatalf("expected: %+v; got: %+v", string(before), string(after))
+			}
+		})
+
+		t.Run("Should read no records from a missing log", func(t *testing.T) {
+			err := ReadLog(filepath.Join(t.TempDir(), "missing.wal"), func(r record) error {
+				t.Fatalf("expected no records; got: %+v", r)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("expected: %+v; got: %+v", nil, err)
+			}
+		})
+	})
+}
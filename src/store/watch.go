@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// watchers hands the events of a Store to the channels returned by Watch.
+type watchers[K comparable, V interface{}] struct {
+	mutex    sync.Mutex
+	channels map[*watcher[K, V]]struct{}
+}
+
+// watcher queues the events for one channel returned by Watch and hands
+// them to the channel from its own goroutine, so that a store never waits
+// for a watcher to read.
+type watcher[K comparable, V interface{}] struct {
+	channel chan Event[K, V]
+
+	mutex   sync.Mutex
+	pending []Event[K, V]
+	// wake is signalled when events are queued.
+	wake chan struct{}
+}
+
+// add returns a channel that receives events until ctx is done.
+func (w *watchers[K, V]) add(ctx context.Context) <-chan Event[K, V] {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.channels == nil {
+		w.channels = map[*watcher[K, V]]struct{}{}
+	}
+	entry := &watcher[K, V]{
+		channel: make(chan Event[K, V], WATCH_BUFFER_SIZE),
+		wake:    make(chan struct{}, 1),
+	}
+	w.channels[entry] = struct{}{}
+
+	go func() {
+		entry.deliver(ctx)
+
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		delete(w.channels, entry)
+		close(entry.channel)
+	}()
+
+	return entry.channel
+}
+
+// notify queues event for every watcher without waiting for any of them.
+// Stores call it while they hold their lock, so watchers see the changes
+// in the order they were made, but the events are sent after the lock is
+// released. A watcher can then read the store back for each event.
+func (w *watchers[K, V]) notify(event Event[K, V]) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for entry := range w.channels {
+		entry.queue(event)
+	}
+}
+
+// queue adds event to the events waiting to be sent.
+func (w *watcher[K, V]) queue(event Event[K, V]) {
+	w.mutex.Lock()
+	w.pending = append(w.pending, event)
+	w.mutex.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver sends the queued events to the channel in order until ctx is
+// done.
+func (w *watcher[K, V]) deliver(ctx context.Context) {
+	for {
+		w.mutex.Lock()
+		events := w.pending
+		w.pending = nil
+		w.mutex.Unlock()
+
+		for _, event := range events {
+			select {
+			case w.channel <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-w.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}